@@ -0,0 +1,91 @@
+package application
+
+import (
+	"fmt"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// wordlistProgress tracks the wordlist labels checked under a root: all of
+// those before next, and the later ones in done, which validators finished
+// out of order
+type wordlistProgress struct {
+	next int64
+	done map[int64]bool
+}
+
+// bruteForce resolves every wordlist label under every root domain while
+// the crawl runs. Only names that resolve, and not just through a wildcard,
+// are enqueued for the HTTP crawl. A resumed crawl skips the labels its
+// checkpoint had checked under each root.
+func (uc *CrawlUseCase) bruteForce() {
+	defer uc.taskWG.Done()
+
+	inputs, roots := uc.inputRoots()
+	offsets := make(map[string]int64, len(roots))
+	uc.wordlistsLock.Lock()
+	for _, root := range roots {
+		if uc.config.Resume != nil {
+			offsets[root] = uc.config.Resume.BruteForceOffsets[root]
+		}
+		uc.wordlists[root] = &wordlistProgress{next: offsets[root], done: make(map[int64]bool)}
+	}
+	uc.wordlistsLock.Unlock()
+
+	index := int64(-1)
+	err := uc.wordlist.Each(func(label string) bool {
+		index++
+		for _, root := range roots {
+			if index < offsets[root] {
+				continue
+			}
+			// Input domains are crawled as roots already
+			name := label + "." + root
+			if inputs[name] {
+				uc.labelChecked(root, index)
+				continue
+			}
+			if !uc.submitCandidate(candidate{name: name, root: root, source: service.SourceBruteForce, index: index}) {
+				return false
+			}
+		}
+		return true
+	})
+
+	if err != nil {
+		fmt.Printf("Warning: failed to read wordlist: %v\n", err)
+	}
+}
+
+// labelChecked records that the wordlist label at index was checked under
+// root, and any name it found enqueued
+func (uc *CrawlUseCase) labelChecked(root string, index int64) {
+	uc.wordlistsLock.Lock()
+	defer uc.wordlistsLock.Unlock()
+
+	progress := uc.wordlists[root]
+	progress.done[index] = true
+	for progress.done[progress.next] {
+		delete(progress.done, progress.next)
+		progress.next++
+	}
+}
+
+// bruteForceOffsets returns the number of leading wordlist labels checked
+// under each root, carrying over those of the resumed checkpoint until the
+// wordlist is read again
+func (uc *CrawlUseCase) bruteForceOffsets() map[string]int64 {
+	offsets := make(map[string]int64)
+	if uc.config.Resume != nil {
+		for root, offset := range uc.config.Resume.BruteForceOffsets {
+			offsets[root] = offset
+		}
+	}
+
+	uc.wordlistsLock.Lock()
+	defer uc.wordlistsLock.Unlock()
+	for root, progress := range uc.wordlists {
+		offsets[root] = progress.next
+	}
+	return offsets
+}
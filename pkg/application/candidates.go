@@ -0,0 +1,130 @@
+package application
+
+import (
+	"sync/atomic"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// candidate is a guessed name under a root domain, resolved before it is
+// crawled
+type candidate struct {
+	name   string
+	root   string
+	source string
+	index  int64 // Position of the label in the wordlist, for brute force guesses
+}
+
+// startValidators starts the goroutines resolving guessed names, the one
+// forwarding the guesses of workers to them and, with recursion on, the zone
+// expander. They run until the crawl stops;
+// each queued candidate holds a task slot, so the crawl does not complete
+// while guesses are pending.
+func (uc *CrawlUseCase) startValidators() {
+	uc.candidates = make(chan candidate, uc.config.BruteForceWorkers)
+	uc.guesses = newHandoff[candidate](maxHandoffItems)
+	go uc.forwardGuesses()
+	if uc.config.RecursiveDepth > 0 {
+		go uc.expandZones()
+	}
+	for i := 0; i < uc.config.BruteForceWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case c := <-uc.candidates:
+					uc.checkCandidate(c)
+					if c.source == service.SourceBruteForce {
+						uc.labelChecked(c.root, c.index)
+					}
+					uc.taskWG.Done()
+				case <-uc.stopChan:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// submitCandidate queues a guessed name for resolution, reporting false if
+// the crawl is stopping
+func (uc *CrawlUseCase) submitCandidate(c candidate) bool {
+	uc.taskWG.Add(1)
+	select {
+	case uc.candidates <- c:
+		return true
+	case <-uc.stopChan:
+		uc.taskWG.Done()
+		return false
+	}
+}
+
+// guess hands guessed names to the validators without blocking; the caller
+// may be a worker, and the wordlist keeps the validators busy
+func (uc *CrawlUseCase) guess(candidates []candidate) {
+	uc.taskWG.Add(len(candidates))
+	uc.handoffDropped(uc.guesses.push(candidates...))
+}
+
+// forwardGuesses feeds the guesses of workers to the validators alongside
+// the wordlist
+func (uc *CrawlUseCase) forwardGuesses() {
+	for {
+		candidates, ok := uc.guesses.pop(uc.stopChan)
+		if !ok {
+			return
+		}
+		for _, c := range candidates {
+			select {
+			case uc.candidates <- c:
+			case <-uc.stopChan:
+				return
+			}
+		}
+	}
+}
+
+// permute queues the permutations of a name that resolved
+func (uc *CrawlUseCase) permute(name, root string) {
+	var candidates []candidate
+	for _, guess := range uc.permutator.Permute(name, root) {
+		candidates = append(candidates, candidate{name: guess, root: root, source: service.SourcePermutation})
+	}
+	uc.guess(candidates)
+}
+
+// checkCandidate resolves a guessed name and enqueues it if it exists
+func (uc *CrawlUseCase) checkCandidate(c candidate) {
+	if uc.filter.Contains(c.name) || !uc.validator.IsInScope(c.name, c.root) {
+		return
+	}
+	tried, found := &uc.metrics.BruteForced, &uc.metrics.BruteForceFound
+	switch c.source {
+	case service.SourcePermutation:
+		tried, found = &uc.metrics.Permutations, &uc.metrics.PermutationsFound
+	case service.SourceRecursive:
+		tried, found = &uc.metrics.Recursed, &uc.metrics.RecursedFound
+	}
+	atomic.AddInt64(tried, 1)
+
+	// Names without an IPv4 address may still have an IPv6 one
+	resolution, err := uc.resolver.ResolveTypes(c.name, []string{"A"})
+	if err == nil && len(resolution.IPs) == 0 && resolution.Rcode == "NOERROR" {
+		resolution, err = uc.resolver.ResolveTypes(c.name, []string{"AAAA"})
+	}
+	if err != nil || len(resolution.IPs)+len(resolution.IPv6) == 0 {
+		return
+	}
+
+	// Under a wildcard every label resolves; those names say nothing
+	if uc.wildcard != nil && uc.config.WildcardMode != WildcardModeOff && uc.wildcard.IsWildcard(c.name, c.root, resolution) {
+		return
+	}
+
+	// Misses would flood the DNS log; only confirmed names are logged
+	for _, message := range resolution.Messages {
+		uc.logWriter.WriteDNSLog(message)
+	}
+
+	atomic.AddInt64(found, 1)
+	uc.enqueueDiscovered(c.name, c.root, c.source)
+}
@@ -3,6 +3,9 @@ package application
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -22,6 +25,14 @@ type CrawlUseCase struct {
 	extractor  service.DomainExtractor
 	fetcher    service.HTTPFetcher
 	resolver   service.DNSResolver
+	wildcard   service.WildcardDetector
+	limiter    service.RateLimiter
+	transferer service.ZoneTransferer
+	walker     service.ZoneWalker
+	wordlist   service.Wordlist
+	permutator service.Permutator
+	sweeper    service.PTRSweeper
+	prober     service.VHostProber
 
 	// Repositories
 	filter       repository.DomainFilter
@@ -29,6 +40,8 @@ type CrawlUseCase struct {
 	resultQueue  repository.ResultQueue
 	resultWriter repository.ResultWriter
 	logWriter    repository.LogWriter
+	journal      repository.TaskJournal
+	checkpoints  repository.CheckpointStore
 
 	// State
 	metrics          *entity.Metrics
@@ -40,6 +53,51 @@ type CrawlUseCase struct {
 	taskWG           sync.WaitGroup
 	cleanupWG        sync.WaitGroup
 	metricsObservers []MetricsObserver
+
+	// candidates carries guessed names to the goroutines resolving them, and
+	// guesses the names guessed by workers, which must not wait for them
+	candidates chan candidate
+	guesses    *handoff[candidate]
+
+	// zones carries the subdomains to brute force recursively, expandedZones
+	// those expanded so far, probedZones those checked for NS and SOA
+	// records, and childCounts the resolving children seen under each
+	// subdomain
+	zones         *handoff[zoneExpansion]
+	expandedZones map[string]bool
+	probedZones   map[string]bool
+	childCounts   map[string]int
+	zonesLock     sync.Mutex
+
+	// dmarcChecked holds the roots whose DMARC policy was looked up
+	dmarcChecked map[string]bool
+	dmarcLock    sync.Mutex
+
+	// sweeps carries the addresses of crawled domains to the PTR sweepers
+	sweeps *handoff[ptrSweep]
+
+	// vhostIPs and vhostNames hold the addresses of each root and its names
+	// without addresses, probed for virtual hosts once the crawl is done
+	vhostIPs   map[string]map[string]bool
+	vhostNames map[string]map[string]bool
+	vhostLock  sync.Mutex
+
+	// zoneResults hold the zone findings of each root until their result is
+	// written; checkpoints keep those still pending
+	zoneResults     map[string]*entity.CrawlResult
+	zoneResultsLock sync.Mutex
+
+	// zonesEnumerated reports whether the zones of the roots were enumerated,
+	// and wordlists the wordlist labels checked under each root; checkpoints
+	// record both so a resumed crawl carries on from them
+	zonesEnumerated atomic.Bool
+	wordlists       map[string]*wordlistProgress
+	wordlistsLock   sync.Mutex
+
+	// checkpointLock is held for reading while discoveries move from the
+	// filter into the queue, and for writing while a checkpoint snapshots
+	// them, so checkpoints see both in a consistent state
+	checkpointLock sync.RWMutex
 }
 
 // Config holds the use case configuration
@@ -49,8 +107,41 @@ type Config struct {
 	Protocols       []string
 	RootDomains     []string
 	BloomFilterFile string
+	WildcardMode    string
+	// BruteForceWorkers is the number of concurrent resolutions of
+	// wordlist, permutation and recursive guesses
+	BruteForceWorkers int
+	// RecursiveDepth is the deepest discovered subdomain brute forced with
+	// RecursiveWords as a zone of its own; 0 disables recursion
+	RecursiveDepth int
+	// RecursiveMinChildren is the number of resolving children after which
+	// a subdomain is treated as a zone even without NS or SOA records
+	RecursiveMinChildren int
+	RecursiveWords       []string
+	// VHostMaxNames bounds the names probed per root for virtual hosts
+	VHostMaxNames int
+	// PTRBlocks is the number of address blocks swept at once
+	PTRBlocks int
+
+	// Checkpointing
+	OutputFile         string
+	HTTPLogFile        string
+	DNSLogFile         string
+	CheckpointInterval time.Duration
+	// Resume restores the crawl from a checkpoint instead of the root domains
+	Resume *entity.Checkpoint
 }
 
+// Wildcard handling modes
+const (
+	// WildcardModeOff disables wildcard detection
+	WildcardModeOff = "off"
+	// WildcardModeTag marks results that match a wildcard fingerprint
+	WildcardModeTag = "tag"
+	// WildcardModeDrop discards tasks that match a wildcard fingerprint
+	WildcardModeDrop = "drop"
+)
+
 // MetricsObserver observes metrics changes
 type MetricsObserver interface {
 	OnMetricsUpdate(metrics *entity.Metrics)
@@ -65,12 +156,42 @@ func NewCrawlUseCase(
 	extractor service.DomainExtractor,
 	fetcher service.HTTPFetcher,
 	resolver service.DNSResolver,
+	wildcard service.WildcardDetector,
+	limiter service.RateLimiter,
+	transferer service.ZoneTransferer,
+	walker service.ZoneWalker,
+	wordlist service.Wordlist,
+	permutator service.Permutator,
+	sweeper service.PTRSweeper,
+	prober service.VHostProber,
 	filter repository.DomainFilter,
 	taskQueue repository.TaskQueue,
 	resultQueue repository.ResultQueue,
 	resultWriter repository.ResultWriter,
 	logWriter repository.LogWriter,
+	journal repository.TaskJournal,
+	checkpoints repository.CheckpointStore,
 ) *CrawlUseCase {
+	if config.CheckpointInterval <= 0 {
+		config.CheckpointInterval = 16 * time.Second
+	}
+
+	if config.BruteForceWorkers <= 0 {
+		config.BruteForceWorkers = 64
+	}
+
+	if config.RecursiveMinChildren <= 0 {
+		config.RecursiveMinChildren = 3
+	}
+
+	if config.VHostMaxNames <= 0 {
+		config.VHostMaxNames = 1000
+	}
+
+	if config.PTRBlocks <= 0 {
+		config.PTRBlocks = 4
+	}
+
 	return &CrawlUseCase{
 		config:           config,
 		validator:        validator,
@@ -78,14 +199,34 @@ func NewCrawlUseCase(
 		extractor:        extractor,
 		fetcher:          fetcher,
 		resolver:         resolver,
+		wildcard:         wildcard,
+		limiter:          limiter,
+		transferer:       transferer,
+		walker:           walker,
+		wordlist:         wordlist,
+		permutator:       permutator,
+		sweeper:          sweeper,
+		prober:           prober,
 		filter:           filter,
 		taskQueue:        taskQueue,
 		resultQueue:      resultQueue,
 		resultWriter:     resultWriter,
 		logWriter:        logWriter,
+		journal:          journal,
+		checkpoints:      checkpoints,
 		metrics:          &entity.Metrics{TotalWorkers: config.NumWorkers},
 		stopChan:         make(chan struct{}),
 		metricsObservers: make([]MetricsObserver, 0),
+		expandedZones:    make(map[string]bool),
+		probedZones:      make(map[string]bool),
+		childCounts:      make(map[string]int),
+		zones:            newHandoff[zoneExpansion](maxHandoffItems),
+		sweeps:           newHandoff[ptrSweep](maxHandoffItems),
+		vhostIPs:         make(map[string]map[string]bool),
+		vhostNames:       make(map[string]map[string]bool),
+		wordlists:        make(map[string]*wordlistProgress),
+		zoneResults:      make(map[string]*entity.CrawlResult),
+		dmarcChecked:     make(map[string]bool),
 	}
 }
 
@@ -126,19 +267,41 @@ func (uc *CrawlUseCase) Execute(ctx context.Context) error {
 		uc.flushResults(ctx)
 	}()
 
-	// Start periodic filter saver
+	// Start periodic checkpoint saver
 	uc.cleanupWG.Add(1)
 	go func() {
 		defer uc.cleanupWG.Done()
-		uc.saveFilterPeriodically(ctx)
+		uc.saveCheckpointPeriodically(ctx)
 	}()
 
+	// Restored tasks are counted before workers can complete them
+	if uc.config.Resume != nil {
+		uc.restoreCheckpoint(uc.config.Resume)
+	}
+	if uc.config.Resume == nil || !uc.config.Resume.ZonesEnumerated {
+		uc.enumerateZones()
+	}
+	uc.zonesEnumerated.Store(true)
+
 	// Start workers
 	uc.startWorkers()
+	if uc.sweeper != nil {
+		uc.startSweepers()
+	}
+	if uc.wordlist != nil || uc.permutator != nil || uc.config.RecursiveDepth > 0 {
+		uc.startValidators()
+	}
 
-	// Enqueue initial tasks
-	if err := uc.enqueueRootDomains(); err != nil {
-		return fmt.Errorf("failed to enqueue root domains: %w", err)
+	// Enqueue initial tasks; a resumed crawl brute forces the wordlist
+	// from where its checkpoint left off
+	if uc.config.Resume == nil {
+		if err := uc.enqueueRootDomains(); err != nil {
+			return fmt.Errorf("failed to enqueue root domains: %w", err)
+		}
+	}
+	if uc.wordlist != nil {
+		uc.taskWG.Add(1)
+		go uc.bruteForce()
 	}
 
 	// Wait for context cancellation or completion
@@ -147,6 +310,9 @@ func (uc *CrawlUseCase) Execute(ctx context.Context) error {
 		uc.Stop()
 		return ctx.Err()
 	case <-uc.waitForCompletion():
+		if uc.prober != nil {
+			uc.probeVHosts(ctx)
+		}
 		uc.Stop()
 		return nil
 	}
@@ -167,6 +333,18 @@ func (uc *CrawlUseCase) updateMetricsPeriodically(ctx context.Context) {
 			uc.metricsLock.Lock()
 			uc.metrics.QueueLength = uc.taskQueue.Len()
 			uc.metrics.LastUpdateTime = time.Now()
+			if counter, ok := uc.taskQueue.(repository.SpillCounter); ok {
+				uc.metrics.TasksSpilled = counter.Spilled()
+			}
+			if uc.limiter != nil {
+				uc.metrics.ThrottledTime = uc.limiter.Throttled()
+			}
+			if reporter, ok := uc.resolver.(service.DNSServerReporter); ok {
+				uc.metrics.DNSServers = reporter.ServerStats()
+			}
+			if reporter, ok := uc.resolver.(service.DNSCacheReporter); ok {
+				uc.metrics.DNSCacheHits, uc.metrics.DNSCacheCoalesced, uc.metrics.DNSCacheMisses = reporter.CacheStats()
+			}
 
 			// Count active workers and collect their current domains
 			activeWorkers := 0
@@ -188,9 +366,9 @@ func (uc *CrawlUseCase) updateMetricsPeriodically(ctx context.Context) {
 	}
 }
 
-// saveFilterPeriodically periodically saves the bloom filter
-func (uc *CrawlUseCase) saveFilterPeriodically(ctx context.Context) {
-	ticker := time.NewTicker(16 * time.Second)
+// saveCheckpointPeriodically periodically saves the bloom filter and pending tasks
+func (uc *CrawlUseCase) saveCheckpointPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(uc.config.CheckpointInterval)
 	defer ticker.Stop()
 
 	for {
@@ -200,34 +378,157 @@ func (uc *CrawlUseCase) saveFilterPeriodically(ctx context.Context) {
 		case <-uc.stopChan:
 			return
 		case <-ticker.C:
-			if err := uc.filter.Save(uc.config.BloomFilterFile); err != nil {
-				fmt.Printf("Warning: failed to auto-save bloom filter: %v\n", err)
+			if err := uc.saveCheckpoint(); err != nil {
+				fmt.Printf("Warning: failed to auto-save checkpoint: %v\n", err)
 			}
 		}
 	}
 }
 
+// saveCheckpoint persists the bloom filter together with the pending tasks,
+// metrics and output position needed to resume the crawl
+func (uc *CrawlUseCase) saveCheckpoint() error {
+	// Snapshot the queue before the journal, which it adds dequeued tasks to,
+	// and both along with the filter; enqueues only wait for the snapshots,
+	// not for the disk
+	uc.checkpointLock.Lock()
+	var tasks []*entity.Task
+	var spills []entity.SpillPosition
+	snapshotter, snapshots := uc.taskQueue.(repository.TaskQueueSnapshotter)
+	if snapshots {
+		var err error
+		if tasks, spills, err = snapshotter.Snapshot(); err != nil {
+			uc.checkpointLock.Unlock()
+			return fmt.Errorf("failed to snapshot task queue: %w", err)
+		}
+	}
+	tasks = uniqueTasks(append(tasks, uc.journal.Pending()...))
+	filter := uc.filter.Copy()
+	offsets := uc.bruteForceOffsets()
+	zoneResults := uc.pendingZoneResults()
+	uc.checkpointLock.Unlock()
+
+	// Take the output offset after the journal: a task leaves the journal
+	// only after its result is written, so no result can be lost in between
+	offset, err := uc.resultWriter.Offset()
+	if err != nil {
+		return fmt.Errorf("failed to get output offset: %w", err)
+	}
+
+	if err := filter.Save(uc.config.BloomFilterFile); err != nil {
+		return fmt.Errorf("failed to save bloom filter: %w", err)
+	}
+
+	uc.metricsLock.RLock()
+	metrics := *uc.metrics
+	uc.metricsLock.RUnlock()
+	metrics.ActiveDomains = nil
+
+	err = uc.checkpoints.Save(&entity.Checkpoint{
+		RootDomains:       uc.config.RootDomains,
+		Tasks:             tasks,
+		Spills:            spills,
+		ZonesEnumerated:   uc.zonesEnumerated.Load(),
+		ZoneResults:       zoneResults,
+		BruteForceOffsets: offsets,
+		Metrics:           metrics,
+		OutputFile:        uc.config.OutputFile,
+		OutputOffset:      offset,
+		HTTPLogFile:       uc.config.HTTPLogFile,
+		DNSLogFile:        uc.config.DNSLogFile,
+		BloomFilterFile:   uc.config.BloomFilterFile,
+		SavedAt:           time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Spilled tasks read since the previous checkpoint are no longer needed
+	if snapshots {
+		snapshotter.Release(spills)
+	}
+	return nil
+}
+
+// uniqueTasks drops the repeated domains of tasks, which a task dequeued
+// while its queue and the journal are snapshotted appears in both of
+func uniqueTasks(tasks []*entity.Task) []*entity.Task {
+	seen := make(map[string]bool, len(tasks))
+	unique := tasks[:0]
+	for _, task := range tasks {
+		if !seen[task.Domain.Name] {
+			seen[task.Domain.Name] = true
+			unique = append(unique, task)
+		}
+	}
+	return unique
+}
+
+// restoreCheckpoint restores metrics and re-enqueues the pending tasks of a
+// checkpoint. The spilled tasks are already back in the queue, which reopened
+// the checkpoint's segment logs.
+func (uc *CrawlUseCase) restoreCheckpoint(checkpoint *entity.Checkpoint) {
+	uc.metricsLock.Lock()
+	startTime := uc.metrics.StartTime
+	*uc.metrics = checkpoint.Metrics
+	uc.metrics.TotalWorkers = uc.config.NumWorkers
+	uc.metrics.StartTime = startTime
+	uc.metricsLock.Unlock()
+
+	uc.taskWG.Add(uc.taskQueue.Len())
+
+	// Zone findings not yet written when the checkpoint was saved are written
+	// now, unless the enumeration that found them is run again
+	if checkpoint.ZonesEnumerated {
+		for _, result := range checkpoint.ZoneResults {
+			uc.sendZoneResult(result)
+		}
+	}
+
+	overflow := 0
+	for _, task := range checkpoint.Tasks {
+		if !uc.enqueue(task) {
+			overflow++
+			uc.incrementTasksDropped()
+		}
+	}
+
+	if overflow > 0 {
+		fmt.Printf("Warning: %d resumed tasks did not fit in the queue and remain in the checkpoint\n", overflow)
+	}
+}
+
 // startWorkers starts all worker goroutines
 func (uc *CrawlUseCase) startWorkers() {
-	uc.workers = make([]*Worker, uc.config.NumWorkers)
+	workers := make([]*Worker, uc.config.NumWorkers)
 	for i := 0; i < uc.config.NumWorkers; i++ {
 		worker := &Worker{
-			id:          i,
-			useCase:     uc,
-			taskQueue:   uc.taskQueue,
-			resultQueue: uc.resultQueue,
-			fetcher:     uc.fetcher,
-			resolver:    uc.resolver,
-			validator:   uc.validator,
-			calculator:  uc.calculator,
-			extractor:   uc.extractor,
-			filter:      uc.filter,
-			logWriter:   uc.logWriter,
-			stopChan:    uc.stopChan,
-			maxDepth:    uc.config.MaxDepth,
-			protocols:   uc.config.Protocols,
+			id:           i,
+			useCase:      uc,
+			taskQueue:    uc.taskQueue,
+			resultQueue:  uc.resultQueue,
+			fetcher:      uc.fetcher,
+			resolver:     uc.resolver,
+			wildcard:     uc.wildcard,
+			validator:    uc.validator,
+			calculator:   uc.calculator,
+			extractor:    uc.extractor,
+			filter:       uc.filter,
+			logWriter:    uc.logWriter,
+			stopChan:     uc.stopChan,
+			maxDepth:     uc.config.MaxDepth,
+			protocols:    uc.config.Protocols,
+			wildcardMode: uc.config.WildcardMode,
 		}
-		uc.workers[i] = worker
+		workers[i] = worker
+	}
+
+	// The metrics goroutine is already reading the workers
+	uc.metricsLock.Lock()
+	uc.workers = workers
+	uc.metricsLock.Unlock()
+
+	for _, worker := range workers {
 		uc.wg.Add(1)
 		go worker.Run(&uc.wg)
 	}
@@ -248,11 +549,10 @@ func (uc *CrawlUseCase) enqueueRootDomains() error {
 				Depth: 0,
 			},
 			Protocols: uc.config.Protocols,
+			Source:    service.SourceInput,
 		}
 
-		if uc.taskQueue.Enqueue(task) {
-			uc.taskWG.Add(1)
-		} else {
+		if !uc.enqueue(task) {
 			return fmt.Errorf("failed to enqueue domain: %s", domain)
 		}
 
@@ -262,6 +562,155 @@ func (uc *CrawlUseCase) enqueueRootDomains() error {
 	return nil
 }
 
+// enumerateZones attempts zone transfers and zone walks of every root domain
+// and enqueues the in-scope names they reveal. The findings of each root are
+// reported in a result of their own.
+func (uc *CrawlUseCase) enumerateZones() {
+	if uc.transferer == nil && uc.walker == nil {
+		return
+	}
+
+	inputs, roots := uc.inputRoots()
+
+	// Input domains are enqueued as roots
+	enqueue := func(names []string, root, source string) {
+		for _, name := range names {
+			if !inputs[name] && uc.validator.IsInScope(name, root) {
+				uc.enqueueDiscovered(name, root, source)
+			}
+		}
+	}
+
+	for _, root := range roots {
+		result := &entity.CrawlResult{Domain: root}
+		if uc.transferer != nil {
+			for _, transfer := range uc.transferer.Transfer(root) {
+				result.ZoneTransfers = append(result.ZoneTransfers, transfer.ZoneTransfer)
+				if transfer.Allowed {
+					fmt.Printf("Zone transfer of %s allowed by %s (%s)\n", root, transfer.Nameserver, transfer.Server)
+				}
+				enqueue(transfer.Names, root, service.SourceZoneTransfer)
+			}
+		}
+
+		if uc.walker != nil {
+			if walk := uc.walker.Walk(root); walk != nil {
+				result.ZoneWalk = &walk.ZoneWalk
+				fmt.Printf("Zone %s walked with %s: %d names\n", root, walk.Method, walk.Found)
+				enqueue(walk.Names, root, service.SourceZoneWalk)
+			}
+		}
+
+		if len(result.ZoneTransfers) > 0 || result.ZoneWalk != nil {
+			result.Timestamp = time.Now()
+			uc.sendZoneResult(result)
+		}
+	}
+}
+
+// sendZoneResult sends the zone findings of a root, keeping them pending
+// until they are written
+func (uc *CrawlUseCase) sendZoneResult(result *entity.CrawlResult) {
+	uc.zoneResultsLock.Lock()
+	uc.zoneResults[result.Domain] = result
+	uc.zoneResultsLock.Unlock()
+	uc.resultQueue.Send(result)
+}
+
+// zoneResultWritten drops the zone findings of a result that was written.
+// It reports whether the result was one of zone findings rather than the
+// result of a task.
+func (uc *CrawlUseCase) zoneResultWritten(result *entity.CrawlResult) bool {
+	uc.zoneResultsLock.Lock()
+	defer uc.zoneResultsLock.Unlock()
+	if uc.zoneResults[result.Domain] != result {
+		return false
+	}
+	delete(uc.zoneResults, result.Domain)
+	return true
+}
+
+// pendingZoneResults returns the zone findings not yet written
+func (uc *CrawlUseCase) pendingZoneResults() []*entity.CrawlResult {
+	uc.zoneResultsLock.Lock()
+	defer uc.zoneResultsLock.Unlock()
+	results := make([]*entity.CrawlResult, 0, len(uc.zoneResults))
+	for _, root := range slices.Sorted(maps.Keys(uc.zoneResults)) {
+		results = append(results, uc.zoneResults[root])
+	}
+	return results
+}
+
+// inputRoots returns the set of input domains and their distinct root domains
+func (uc *CrawlUseCase) inputRoots() (map[string]bool, []string) {
+	inputs := make(map[string]bool)
+	var roots []string
+	for _, domain := range uc.config.RootDomains {
+		inputs[strings.ToLower(domain)] = true
+		root, err := uc.calculator.GetRoot(domain)
+		if err != nil {
+			root = domain
+		}
+		if !slices.Contains(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+	return inputs, roots
+}
+
+// enqueueDiscovered enqueues a domain found outside of the workers unless it
+// was seen before or is too deep
+func (uc *CrawlUseCase) enqueueDiscovered(name, root, source string) {
+	depth := uc.calculator.GetDepth(name)
+	if depth > uc.config.MaxDepth {
+		return
+	}
+
+	uc.checkpointLock.RLock()
+	defer uc.checkpointLock.RUnlock()
+
+	if uc.filter.Contains(name) {
+		return
+	}
+	uc.filter.Add(name)
+
+	task := &entity.Task{
+		Domain: entity.Domain{
+			Name:  name,
+			Root:  root,
+			Depth: depth,
+		},
+		Protocols: uc.config.Protocols,
+		Source:    source,
+	}
+
+	if uc.enqueue(task) {
+		atomic.AddInt64(&uc.metrics.TasksEnqueued, 1)
+	} else {
+		uc.incrementTasksDropped()
+	}
+}
+
+// enqueue queues a task and counts it as outstanding. Queues that cannot
+// snapshot their tasks have them journaled instead; tasks rejected by a
+// closing queue are journaled either way, so the final checkpoint keeps them.
+func (uc *CrawlUseCase) enqueue(task *entity.Task) bool {
+	_, snapshots := uc.taskQueue.(repository.TaskQueueSnapshotter)
+	if !snapshots {
+		uc.journal.Add(task)
+	}
+
+	uc.taskWG.Add(1)
+	if uc.taskQueue.Enqueue(task) {
+		return true
+	}
+	uc.taskWG.Done()
+	if snapshots {
+		uc.journal.Add(task)
+	}
+	return false
+}
+
 // flushResults continuously flushes results to the writer
 func (uc *CrawlUseCase) flushResults(ctx context.Context) {
 	for {
@@ -274,9 +723,14 @@ func (uc *CrawlUseCase) flushResults(ctx context.Context) {
 				return
 			}
 			if err := uc.resultWriter.Write(result); err != nil {
-				// Log error but continue
+				// Log error but continue; the task stays in the journal
 				continue
 			}
+			// Zone findings share the domain of the root's task, which
+			// they must not complete
+			if !uc.zoneResultWritten(result) {
+				uc.journal.Done(result.Domain)
+			}
 		}
 	}
 }
@@ -300,11 +754,11 @@ func (uc *CrawlUseCase) Stop() {
 		uc.resultQueue.Close()
 		uc.cleanupWG.Wait()
 		uc.resultWriter.Flush()
+		if err := uc.saveCheckpoint(); err != nil {
+			fmt.Printf("Failed to save checkpoint: %v\n", err)
+		}
 		uc.resultWriter.Close()
 		uc.logWriter.Close()
-		if err := uc.filter.Save(uc.config.BloomFilterFile); err != nil {
-			fmt.Printf("Failed to save bloom filter: %v\n", err)
-		}
 	})
 }
 
@@ -346,6 +800,31 @@ func (uc *CrawlUseCase) incrementUniqueSubdomains(count int64) {
 	atomic.AddInt64(&uc.metrics.UniqueSubdomains, count)
 }
 
+// incrementWildcardCount increments the wildcard match counter
+func (uc *CrawlUseCase) incrementWildcardCount() {
+	atomic.AddInt64(&uc.metrics.WildcardCount, 1)
+}
+
+// incrementPTRSweeps counts a swept block and the PTR names found in it
+func (uc *CrawlUseCase) incrementPTRSweeps(names int64) {
+	atomic.AddInt64(&uc.metrics.PTRBlocks, 1)
+	atomic.AddInt64(&uc.metrics.PTRNames, names)
+}
+
+// incrementTasksDropped increments the counter of tasks the queue rejected
+func (uc *CrawlUseCase) incrementTasksDropped() {
+	atomic.AddInt64(&uc.metrics.TasksDropped, 1)
+}
+
+// handoffDropped releases the task slots of items a full handoff dropped and
+// counts them as dropped tasks
+func (uc *CrawlUseCase) handoffDropped(dropped int) {
+	if dropped > 0 {
+		uc.taskWG.Add(-dropped)
+		atomic.AddInt64(&uc.metrics.TasksDropped, int64(dropped))
+	}
+}
+
 // incrementTasksProcessed increments the tasks processed counter
 func (uc *CrawlUseCase) incrementTasksProcessed() {
 	atomic.AddInt64(&uc.metrics.TasksProcessed, 1)
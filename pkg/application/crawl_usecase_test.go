@@ -0,0 +1,450 @@
+package application
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/repository"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/domainservice"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/storage"
+)
+
+// fakeFetcher fails every request, like a host without a web server
+type fakeFetcher struct{}
+
+func (fakeFetcher) Fetch(url string, ips []string) (*service.HTTPResponse, error) {
+	return &service.HTTPResponse{URL: url, Error: "connection refused", Message: &entity.HTTPMessage{}}, errors.New("connection refused")
+}
+
+// fakeResolver answers from a fixed set of resolutions and NXDOMAIN otherwise
+type fakeResolver struct {
+	resolutions map[string]*service.DNSResolution
+}
+
+func (r fakeResolver) Resolve(domain string) ([]string, error) {
+	resolution, _ := r.ResolveWithDetails(domain)
+	return resolution.IPs, nil
+}
+
+func (r fakeResolver) ResolveWithDetails(domain string) (*service.DNSResolution, error) {
+	if resolution, ok := r.resolutions[domain]; ok {
+		return resolution, nil
+	}
+	return &service.DNSResolution{Domain: domain, Rcode: "NXDOMAIN"}, nil
+}
+
+func (r fakeResolver) ResolveTypes(domain string, recordTypes []string) (*service.DNSResolution, error) {
+	return r.ResolveWithDetails(domain)
+}
+
+// fakeTransferer returns the same transfer for every zone
+type fakeTransferer struct {
+	names []string
+}
+
+func (t fakeTransferer) Transfer(zone string) []service.ZoneTransfer {
+	return []service.ZoneTransfer{{
+		ZoneTransfer: entity.ZoneTransfer{Zone: zone, Nameserver: "ns1." + zone, Type: "AXFR", Allowed: true, Records: len(t.names)},
+		Names:        t.names,
+	}}
+}
+
+// fakeWalker walks every zone to the same names, taking delay to do so
+type fakeWalker struct {
+	names []string
+	delay time.Duration
+}
+
+func (w fakeWalker) Walk(zone string) *service.ZoneWalk {
+	time.Sleep(w.delay)
+	return &service.ZoneWalk{
+		ZoneWalk: entity.ZoneWalk{Zone: zone, Method: "nsec", Found: len(w.names)},
+		Names:    w.names,
+	}
+}
+
+// fakeWordlist yields a fixed list of labels
+type fakeWordlist []string
+
+func (w fakeWordlist) Each(yield func(label string) bool) error {
+	for _, label := range w {
+		if !yield(label) {
+			break
+		}
+	}
+	return nil
+}
+
+// fakeSweeper finds the same names around every address, taking delay to
+// sweep its block
+type fakeSweeper struct {
+	names []string
+	delay time.Duration
+}
+
+func (s fakeSweeper) Sweep(ip string) *service.PTRSweep {
+	time.Sleep(s.delay)
+	sweep := &service.PTRSweep{PTRSweep: entity.PTRSweep{Block: ip + "/32", Pivot: ip, Queried: 1}}
+	for _, name := range s.names {
+		sweep.Records = append(sweep.Records, entity.PTRRecord{IP: ip, Name: name})
+	}
+	return sweep
+}
+
+// testServices are the optional services of a test crawl
+type testServices struct {
+	resolver   service.DNSResolver
+	transferer service.ZoneTransferer
+	walker     service.ZoneWalker
+	wordlist   service.Wordlist
+	permutator service.Permutator
+	sweeper    service.PTRSweeper
+	// taskQueue replaces the default in-memory queue
+	taskQueue repository.TaskQueue
+	journal   repository.TaskJournal
+}
+
+// newTestUseCase builds a crawl of config.RootDomains writing into a
+// temporary directory, and returns it with the path of its output
+func newTestUseCase(t *testing.T, config Config, services testServices) (*CrawlUseCase, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	config.OutputFile = filepath.Join(dir, "result.jsonl")
+	config.BloomFilterFile = filepath.Join(dir, "bloom.filter")
+	if config.NumWorkers == 0 {
+		config.NumWorkers = 4
+	}
+	if config.MaxDepth == 0 {
+		config.MaxDepth = 5
+	}
+	if config.Protocols == nil {
+		config.Protocols = []string{"http"}
+	}
+	if services.resolver == nil {
+		services.resolver = fakeResolver{}
+	}
+	if services.taskQueue == nil {
+		services.taskQueue = storage.NewTaskQueue(1000)
+	}
+	if services.journal == nil {
+		services.journal = storage.NewTaskJournal()
+	}
+
+	resultWriter, err := storage.NewResultWriter(config.OutputFile)
+	if err != nil {
+		t.Fatalf("NewResultWriter() error = %v", err)
+	}
+	logWriter, err := storage.NewLogWriter(filepath.Join(dir, "http.jsonl"), filepath.Join(dir, "dns.jsonl"))
+	if err != nil {
+		t.Fatalf("NewLogWriter() error = %v", err)
+	}
+	checkpoints, err := storage.NewCheckpointStore(filepath.Join(dir, "session"))
+	if err != nil {
+		t.Fatalf("NewCheckpointStore() error = %v", err)
+	}
+
+	uc := NewCrawlUseCase(
+		config,
+		domainservice.NewValidator(config.RootDomains),
+		domainservice.NewCalculator(),
+		domainservice.NewExtractor(),
+		fakeFetcher{},
+		services.resolver,
+		nil,
+		nil,
+		services.transferer,
+		services.walker,
+		services.wordlist,
+		services.permutator,
+		services.sweeper,
+		nil,
+		storage.NewBloomFilter(storage.Config{Size: 10000, FalsePositiveRate: 0.001}),
+		services.taskQueue,
+		storage.NewResultQueue(1000),
+		resultWriter,
+		logWriter,
+		services.journal,
+		checkpoints,
+	)
+	return uc, config.OutputFile
+}
+
+// runTestUseCase executes a crawl and returns its results by domain
+func runTestUseCase(t *testing.T, uc *CrawlUseCase, output string) map[string]entity.CrawlResult {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := uc.Execute(ctx); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	results := make(map[string]entity.CrawlResult)
+	for _, result := range readResults(t, output) {
+		results[result.Domain] = result
+	}
+	return results
+}
+
+// readResults returns the results written to output in order
+func readResults(t *testing.T, output string) []entity.CrawlResult {
+	t.Helper()
+
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer file.Close()
+
+	var results []entity.CrawlResult
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var result entity.CrawlResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to decode result %q: %v", scanner.Text(), err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// zoneResults returns the zone findings among results by root
+func zoneResults(results []entity.CrawlResult) map[string]entity.CrawlResult {
+	zones := make(map[string]entity.CrawlResult)
+	for _, result := range results {
+		if len(result.ZoneTransfers) > 0 || result.ZoneWalk != nil {
+			zones[result.Domain] = result
+		}
+	}
+	return zones
+}
+
+// TestCrawlUseCase_ZoneFindings crawls an input below its zone apex while
+// the zone's transfer and walk reveal the apex, and checks that the findings
+// are reported in a result of their own rather than in any crawl result
+func TestCrawlUseCase_ZoneFindings(t *testing.T) {
+	names := []string{"example.com", "www.example.com", "mail.example.com", "other.org"}
+	uc, output := newTestUseCase(t, Config{RootDomains: []string{"www.example.com"}}, testServices{
+		transferer: fakeTransferer{names: names},
+		walker:     fakeWalker{names: names, delay: 200 * time.Millisecond},
+	})
+
+	results := runTestUseCase(t, uc, output)
+
+	for _, domain := range []string{"www.example.com", "example.com", "mail.example.com"} {
+		if _, ok := results[domain]; !ok {
+			t.Errorf("Result of %s missing", domain)
+		}
+	}
+	if _, ok := results["other.org"]; ok {
+		t.Errorf("Result of out of scope other.org written")
+	}
+
+	zones := zoneResults(readResults(t, output))
+	if len(zones) != 1 {
+		t.Fatalf("Zone results = %+v, want one for example.com", zones)
+	}
+	zone := zones["example.com"]
+	if len(zone.ZoneTransfers) != 1 || !zone.ZoneTransfers[0].Allowed {
+		t.Errorf("example.com ZoneTransfers = %+v, want one allowed transfer", zone.ZoneTransfers)
+	}
+	if zone.ZoneWalk == nil || zone.ZoneWalk.Found != len(names) {
+		t.Errorf("example.com ZoneWalk = %+v, want %d names found", zone.ZoneWalk, len(names))
+	}
+	if len(zone.Attempts) != 0 {
+		t.Errorf("example.com zone result carries %d fetch attempts, want none", len(zone.Attempts))
+	}
+	if pending := uc.pendingZoneResults(); len(pending) != 0 {
+		t.Errorf("pendingZoneResults() = %d results after the crawl, want none", len(pending))
+	}
+}
+
+// TestCrawlUseCase_CheckpointZoneResults checks that zone findings not yet
+// written are saved in checkpoints and written when the crawl resumes
+func TestCrawlUseCase_CheckpointZoneResults(t *testing.T) {
+	uc, _ := newTestUseCase(t, Config{RootDomains: []string{"example.com"}}, testServices{
+		transferer: fakeTransferer{names: []string{"www.example.com"}},
+	})
+
+	// Nothing flushes results yet, so the findings stay pending
+	uc.enumerateZones()
+	uc.zonesEnumerated.Store(true)
+	if err := uc.saveCheckpoint(); err != nil {
+		t.Fatalf("saveCheckpoint() error = %v", err)
+	}
+	checkpoint, err := uc.checkpoints.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(checkpoint.ZoneResults) != 1 || checkpoint.ZoneResults[0].Domain != "example.com" {
+		t.Fatalf("Checkpoint ZoneResults = %+v, want the findings of example.com", checkpoint.ZoneResults)
+	}
+
+	resumed, output := newTestUseCase(t, Config{RootDomains: []string{"example.com"}, Resume: checkpoint}, testServices{})
+	runTestUseCase(t, resumed, output)
+
+	if zones := zoneResults(readResults(t, output)); len(zones["example.com"].ZoneTransfers) != 1 {
+		t.Errorf("Resumed crawl zone results = %+v, want the transfer of example.com", zones)
+	}
+}
+
+// TestCrawlUseCase_CheckpointSpilledTasks checks that checkpoints reference
+// spilled tasks by position and copy only those in memory or in flight
+func TestCrawlUseCase_CheckpointSpilledTasks(t *testing.T) {
+	journal := storage.NewTaskJournal()
+	queue, err := storage.NewSpillingTaskQueue(storage.SpillConfig{Dir: t.TempDir(), Window: 2, Journal: journal})
+	if err != nil {
+		t.Fatalf("Failed to create spilling queue: %v", err)
+	}
+	uc, _ := newTestUseCase(t, Config{RootDomains: []string{"example.com"}}, testServices{taskQueue: queue, journal: journal})
+
+	for i := 0; i < 10; i++ {
+		uc.enqueueDiscovered(fmt.Sprintf("host%d.example.com", i), "example.com", service.SourceInput)
+	}
+	// One task in flight, one in memory, eight spilled
+	queue.Dequeue()
+
+	if err := uc.saveCheckpoint(); err != nil {
+		t.Fatalf("saveCheckpoint() error = %v", err)
+	}
+	checkpoint, err := uc.checkpoints.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(checkpoint.Tasks) != 2 {
+		t.Errorf("Checkpoint holds %d tasks, want 2", len(checkpoint.Tasks))
+	}
+	if len(checkpoint.Spills) != 1 || checkpoint.Spills[0].Tasks != 8 {
+		t.Errorf("Checkpoint spills = %+v, want 8 spilled tasks", checkpoint.Spills)
+	}
+}
+
+// TestCrawlUseCase_Permutations checks that the guesses workers make from a
+// resolved name are resolved and crawled
+func TestCrawlUseCase_Permutations(t *testing.T) {
+	resolved := func(name string) *service.DNSResolution {
+		return &service.DNSResolution{Domain: name, IPs: []string{"192.0.2.1"}, Rcode: "NOERROR"}
+	}
+	uc, output := newTestUseCase(t, Config{RootDomains: []string{"web1.example.com"}}, testServices{
+		resolver: fakeResolver{resolutions: map[string]*service.DNSResolution{
+			"web1.example.com": resolved("web1.example.com"),
+			"web2.example.com": resolved("web2.example.com"),
+		}},
+		permutator: domainservice.NewPermutator(domainservice.PermutatorConfig{Rules: []string{domainservice.RuleIncrement}}),
+	})
+
+	results := runTestUseCase(t, uc, output)
+
+	if _, ok := results["web2.example.com"]; !ok {
+		t.Errorf("Permutation web2.example.com was not crawled")
+	}
+	if _, ok := results["web0.example.com"]; ok {
+		t.Errorf("Unresolved permutation web0.example.com was crawled")
+	}
+	if metrics := uc.GetMetrics(); metrics.PermutationsFound != 1 {
+		t.Errorf("PermutationsFound = %d, want 1", metrics.PermutationsFound)
+	}
+}
+
+// TestCrawlUseCase_ResumeBruteForce resumes a crawl whose checkpoint had
+// checked the first wordlist labels and not enumerated the zones
+func TestCrawlUseCase_ResumeBruteForce(t *testing.T) {
+	resolutions := make(map[string]*service.DNSResolution)
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"} {
+		resolutions[name] = &service.DNSResolution{Domain: name, IPs: []string{"192.0.2.1"}, Rcode: "NOERROR"}
+	}
+	uc, output := newTestUseCase(t, Config{
+		RootDomains: []string{"example.com"},
+		Resume:      &entity.Checkpoint{BruteForceOffsets: map[string]int64{"example.com": 2}},
+	}, testServices{
+		resolver:   fakeResolver{resolutions: resolutions},
+		transferer: fakeTransferer{names: []string{"zone.example.com"}},
+		wordlist:   fakeWordlist{"a", "b", "c", "d"},
+	})
+
+	results := runTestUseCase(t, uc, output)
+
+	for _, domain := range []string{"a.example.com", "b.example.com"} {
+		if _, ok := results[domain]; ok {
+			t.Errorf("%s checked before the checkpoint was brute forced again", domain)
+		}
+	}
+	for _, domain := range []string{"c.example.com", "d.example.com", "zone.example.com"} {
+		if _, ok := results[domain]; !ok {
+			t.Errorf("Result of %s missing", domain)
+		}
+	}
+	if offsets := uc.bruteForceOffsets(); offsets["example.com"] != 4 {
+		t.Errorf("bruteForceOffsets() = %v, want example.com at 4", offsets)
+	}
+	if !uc.zonesEnumerated.Load() {
+		t.Errorf("Zones of the resumed crawl were not enumerated")
+	}
+}
+
+// TestCrawlUseCase_DMARC checks that the DMARC policy of the root of an
+// input below it is looked up once and its report hosts are crawled
+func TestCrawlUseCase_DMARC(t *testing.T) {
+	policy := "v=DMARC1; p=reject; rua=mailto:dmarc@reports.example.com,mailto:d@vendor.net"
+	uc, output := newTestUseCase(t, Config{RootDomains: []string{"www.example.com", "api.example.com"}}, testServices{
+		resolver: fakeResolver{resolutions: map[string]*service.DNSResolution{
+			"_dmarc.example.com": {
+				Domain:  "_dmarc.example.com",
+				Rcode:   "NOERROR",
+				Records: []service.DNSRecord{{Name: "_dmarc.example.com", Type: "TXT", Value: policy}},
+			},
+		}},
+	})
+
+	results := runTestUseCase(t, uc, output)
+
+	if _, ok := results["reports.example.com"]; !ok {
+		t.Errorf("DMARC report host reports.example.com was not crawled")
+	}
+	for _, domain := range []string{"vendor.net", "_dmarc.example.com"} {
+		if _, ok := results[domain]; ok {
+			t.Errorf("Result of %s written", domain)
+		}
+	}
+	if !uc.dmarcChecked["example.com"] || len(uc.dmarcChecked) != 1 {
+		t.Errorf("dmarcChecked = %v, want only example.com", uc.dmarcChecked)
+	}
+}
+
+// TestCrawlUseCase_PTRSweeps checks that the sweeps around crawled
+// addresses are reported apart from the crawl of their domain, and that
+// their names in scope are crawled
+func TestCrawlUseCase_PTRSweeps(t *testing.T) {
+	uc, output := newTestUseCase(t, Config{RootDomains: []string{"www.example.com"}}, testServices{
+		resolver: fakeResolver{resolutions: map[string]*service.DNSResolution{
+			"www.example.com": {Domain: "www.example.com", IPs: []string{"192.0.2.1"}, Rcode: "NOERROR"},
+		}},
+		sweeper: fakeSweeper{names: []string{"MAIL.example.com", "other.org"}, delay: 100 * time.Millisecond},
+	})
+
+	results := runTestUseCase(t, uc, output)
+
+	if sweeps := results["www.example.com"].PTRSweeps; len(sweeps) != 1 || sweeps[0].Pivot != "192.0.2.1" {
+		t.Errorf("www.example.com PTRSweeps = %+v, want the sweep around 192.0.2.1", sweeps)
+	}
+	if _, ok := results["mail.example.com"]; !ok {
+		t.Errorf("PTR name mail.example.com was not crawled")
+	}
+	if _, ok := results["other.org"]; ok {
+		t.Errorf("Out of scope PTR name other.org was crawled")
+	}
+	if metrics := uc.GetMetrics(); metrics.PTRBlocks != 1 || metrics.PTRNames != 2 {
+		t.Errorf("PTRBlocks, PTRNames = %d, %d, want 1, 2", metrics.PTRBlocks, metrics.PTRNames)
+	}
+}
@@ -0,0 +1,28 @@
+package application
+
+import "github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+
+// dmarcRecordTypes are the record types of a DMARC policy
+var dmarcRecordTypes = []string{"TXT"}
+
+// mineDMARC looks up the DMARC policy of root, once per root, and returns
+// the hosts of the report addresses it names. The policy lives at
+// _dmarc.<root>, which is never crawled itself.
+func (uc *CrawlUseCase) mineDMARC(root string) []service.Discovery {
+	uc.dmarcLock.Lock()
+	checked := uc.dmarcChecked[root]
+	uc.dmarcChecked[root] = true
+	uc.dmarcLock.Unlock()
+	if checked {
+		return nil
+	}
+
+	resolution, err := uc.resolver.ResolveTypes("_dmarc."+root, dmarcRecordTypes)
+	if err != nil || len(resolution.Records) == 0 {
+		return nil
+	}
+	for _, message := range resolution.Messages {
+		uc.logWriter.WriteDNSLog(message)
+	}
+	return uc.extractor.ExtractFromDNSRecords(resolution.Records)
+}
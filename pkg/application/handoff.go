@@ -0,0 +1,64 @@
+package application
+
+import "sync"
+
+// maxHandoffItems is the number of items a handoff holds before it drops
+// further pushes
+const maxHandoffItems = 100000
+
+// handoff is a bounded queue from goroutines that must never block, such as
+// crawl workers, to a consumer that may. Items pile up in memory while the
+// consumer is busy, up to a limit past which they are dropped. They are not
+// saved in checkpoints, so a resumed crawl does not see them.
+type handoff[T any] struct {
+	items []T
+	limit int
+	ready chan struct{}
+	mu    sync.Mutex
+}
+
+// newHandoff creates an empty handoff holding at most limit items
+func newHandoff[T any](limit int) *handoff[T] {
+	return &handoff[T]{limit: limit, ready: make(chan struct{}, 1)}
+}
+
+// push queues items without blocking and returns the number of them dropped
+// because the handoff is full
+func (h *handoff[T]) push(items ...T) int {
+	if len(items) == 0 {
+		return 0
+	}
+
+	h.mu.Lock()
+	kept := min(len(items), max(h.limit-len(h.items), 0))
+	h.items = append(h.items, items[:kept]...)
+	h.mu.Unlock()
+
+	if kept > 0 {
+		select {
+		case h.ready <- struct{}{}:
+		default:
+		}
+	}
+	return len(items) - kept
+}
+
+// pop removes and returns every queued item, blocking until there is one or
+// stop is closed
+func (h *handoff[T]) pop(stop <-chan struct{}) ([]T, bool) {
+	for {
+		h.mu.Lock()
+		items := h.items
+		h.items = nil
+		h.mu.Unlock()
+		if len(items) > 0 {
+			return items, true
+		}
+
+		select {
+		case <-h.ready:
+		case <-stop:
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package application
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHandoff(t *testing.T) {
+	h := newHandoff[int](1000)
+	stop := make(chan struct{})
+
+	// Pushes never wait for the consumer
+	for i := 0; i < 1000; i++ {
+		h.push(i)
+	}
+	h.push()
+
+	items, ok := h.pop(stop)
+	if !ok || len(items) != 1000 || items[0] != 0 || items[999] != 999 {
+		t.Errorf("pop() = %d items, %v, want 1000 items in order", len(items), ok)
+	}
+
+	// A blocked pop wakes up for the next push
+	done := make(chan []int)
+	go func() {
+		items, _ := h.pop(stop)
+		done <- items
+	}()
+	time.Sleep(10 * time.Millisecond)
+	h.push(1, 2)
+	select {
+	case items := <-done:
+		if !slices.Equal(items, []int{1, 2}) {
+			t.Errorf("pop() = %v, want [1 2]", items)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pop() did not return after push")
+	}
+
+	// A full handoff keeps what fits and drops the rest
+	if dropped := h.push(make([]int, 999)...); dropped != 0 {
+		t.Errorf("push(999 items) dropped %d, want 0", dropped)
+	}
+	if dropped := h.push(1, 2, 3); dropped != 2 {
+		t.Errorf("push(3 items) into a handoff with room for 1 dropped %d, want 2", dropped)
+	}
+	if dropped := h.push(4); dropped != 1 {
+		t.Errorf("push(1 item) into a full handoff dropped %d, want 1", dropped)
+	}
+	if items, _ := h.pop(stop); len(items) != 1000 || items[999] != 1 {
+		t.Errorf("pop() = %d items ending with %d, want 1000 ending with 1", len(items), items[len(items)-1])
+	}
+
+	close(stop)
+	if _, ok := h.pop(stop); ok {
+		t.Error("pop() after stop should report false")
+	}
+}
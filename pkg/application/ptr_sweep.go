@@ -0,0 +1,99 @@
+package application
+
+import (
+	"strings"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// ptrSweep is a crawled domain whose addresses are swept around
+type ptrSweep struct {
+	domain string
+	root   string
+	ips    []string
+}
+
+// startSweepers starts the goroutines sweeping the blocks around the
+// addresses of crawled domains, PTRBlocks of them at a time, and the one
+// feeding them. Sweeps run apart from the workers so a block of lookups
+// never holds up the crawl; each queued sweep holds a task slot.
+func (uc *CrawlUseCase) startSweepers() {
+	sweeps := make(chan ptrSweep)
+	go func() {
+		for {
+			queued, ok := uc.sweeps.pop(uc.stopChan)
+			if !ok {
+				return
+			}
+			for _, sweep := range queued {
+				select {
+				case sweeps <- sweep:
+				case <-uc.stopChan:
+					return
+				}
+			}
+		}
+	}()
+
+	// Sweepers send results, so the crawl waits for them before closing
+	// the result queue
+	for i := 0; i < uc.config.PTRBlocks; i++ {
+		uc.wg.Add(1)
+		go func() {
+			defer uc.wg.Done()
+			for {
+				select {
+				case sweep := <-sweeps:
+					uc.sweepPTR(sweep)
+					uc.taskWG.Done()
+				case <-uc.stopChan:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// queueSweep hands the addresses of a crawled domain to the sweepers
+// without blocking
+func (uc *CrawlUseCase) queueSweep(domain, root string, ips []string) {
+	if len(ips) == 0 {
+		return
+	}
+	uc.taskWG.Add(1)
+	uc.handoffDropped(uc.sweeps.push(ptrSweep{domain: domain, root: root, ips: ips}))
+}
+
+// sweepPTR looks up the PTR names around each address whose block was not
+// swept yet, enqueues those in scope and reports the sweeps in a result of
+// their own
+func (uc *CrawlUseCase) sweepPTR(sweep ptrSweep) {
+	var sweeps []entity.PTRSweep
+	for _, ip := range sweep.ips {
+		result := uc.sweeper.Sweep(ip)
+		if result == nil {
+			continue
+		}
+		for _, message := range result.Messages {
+			uc.logWriter.WriteDNSLog(message)
+		}
+		for _, record := range result.Records {
+			name := strings.ToLower(strings.TrimSpace(record.Name))
+			if uc.validator.IsInScope(name, sweep.root) {
+				uc.enqueueDiscovered(name, sweep.root, service.SourcePTR)
+			}
+		}
+		uc.incrementPTRSweeps(int64(len(result.Records)))
+		sweeps = append(sweeps, result.PTRSweep)
+	}
+
+	if len(sweeps) > 0 {
+		uc.resultQueue.Send(&entity.CrawlResult{
+			Domain:    sweep.domain,
+			PTRSweeps: sweeps,
+			Timestamp: time.Now(),
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package application
+
+import (
+	"strings"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// zoneRecordTypes are the record types a zone apex owns, queried for every
+// resolved name whatever record types the crawl resolves
+var zoneRecordTypes = []string{"NS", "SOA"}
+
+// zoneExpansion is a subdomain to brute force as a zone of its own
+type zoneExpansion struct {
+	zone string
+	root string
+	// confirmed is false until NS or SOA records, or enough children, show
+	// the subdomain is a zone
+	confirmed bool
+}
+
+// recurse queues a resolved name for brute forcing if it is a delegated
+// zone, and its parent once enough of the parent's children resolve. Names
+// whose records do not show they are a zone apex are probed for NS and SOA
+// records apart from the workers.
+func (uc *CrawlUseCase) recurse(name, root string, resolution *service.DNSResolution) {
+	uc.queueZone(name, root, isZoneApex(name, resolution))
+
+	_, parent, ok := strings.Cut(name, ".")
+	if !ok || !strings.HasSuffix(parent, "."+root) {
+		return
+	}
+
+	uc.zonesLock.Lock()
+	uc.childCounts[parent]++
+	children := uc.childCounts[parent]
+	uc.zonesLock.Unlock()
+
+	if children == uc.config.RecursiveMinChildren {
+		uc.queueZone(parent, root, true)
+	}
+}
+
+// queueZone hands zone to the expander without blocking, once, if neither
+// the zone nor the guesses are too deep. The queued zone holds a task slot
+// until it is probed and its wordlist submitted.
+func (uc *CrawlUseCase) queueZone(zone, root string, confirmed bool) {
+	depth := uc.calculator.GetDepth(zone)
+	if depth == 0 || depth > uc.config.RecursiveDepth || depth >= uc.config.MaxDepth {
+		return
+	}
+
+	uc.zonesLock.Lock()
+	queued := uc.expandedZones[zone]
+	if confirmed {
+		uc.expandedZones[zone] = true
+	} else {
+		queued = queued || uc.probedZones[zone]
+		uc.probedZones[zone] = true
+	}
+	uc.zonesLock.Unlock()
+	if queued {
+		return
+	}
+
+	uc.taskWG.Add(1)
+	uc.handoffDropped(uc.zones.push(zoneExpansion{zone: zone, root: root, confirmed: confirmed}))
+}
+
+// expandZones probes and expands the queued zones, as many at once as there
+// are validators. It runs apart from the workers, since DNS and the
+// validators may keep it waiting.
+func (uc *CrawlUseCase) expandZones() {
+	slots := make(chan struct{}, uc.config.BruteForceWorkers)
+	for {
+		expansions, ok := uc.zones.pop(uc.stopChan)
+		if !ok {
+			return
+		}
+		for _, expansion := range expansions {
+			select {
+			case slots <- struct{}{}:
+			case <-uc.stopChan:
+				return
+			}
+			go func() {
+				defer func() {
+					<-slots
+					uc.taskWG.Done()
+				}()
+				if expansion.confirmed || uc.probeZone(expansion.zone) {
+					uc.expandZone(expansion)
+				}
+			}()
+		}
+	}
+}
+
+// probeZone resolves the NS and SOA records of a subdomain, reporting
+// whether they show it is a zone that was not expanded yet
+func (uc *CrawlUseCase) probeZone(zone string) bool {
+	resolution, err := uc.resolver.ResolveTypes(zone, zoneRecordTypes)
+	if err != nil || !isZoneApex(zone, resolution) {
+		return false
+	}
+
+	uc.zonesLock.Lock()
+	defer uc.zonesLock.Unlock()
+	if uc.expandedZones[zone] {
+		return false
+	}
+	uc.expandedZones[zone] = true
+	return true
+}
+
+// expandZone submits the expander wordlist under a zone
+func (uc *CrawlUseCase) expandZone(expansion zoneExpansion) {
+	for _, label := range uc.config.RecursiveWords {
+		c := candidate{name: label + "." + expansion.zone, root: expansion.root, source: service.SourceRecursive}
+		if !uc.submitCandidate(c) {
+			return
+		}
+	}
+}
+
+// isZoneApex checks if a resolution holds NS or SOA records owned by name
+func isZoneApex(name string, resolution *service.DNSResolution) bool {
+	for _, record := range resolution.Records {
+		if (record.Type == "NS" || record.Type == "SOA") && strings.EqualFold(record.Name, name) {
+			return true
+		}
+	}
+	return false
+}
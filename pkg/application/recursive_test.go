@@ -0,0 +1,148 @@
+package application
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+func TestIsZoneApex(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  []service.DNSRecord
+		expected bool
+	}{
+		{"dev.example.com", nil, false},
+		{"dev.example.com", []service.DNSRecord{{Name: "dev.example.com", Type: "A", Value: "192.0.2.1"}}, false},
+		{"dev.example.com", []service.DNSRecord{{Name: "dev.example.com", Type: "NS", Value: "ns1.dev.example.com"}}, true},
+		{"dev.example.com", []service.DNSRecord{{Name: "DEV.example.com", Type: "SOA", Value: "ns1.dev.example.com"}}, true},
+		// Records owned by the target of a CNAME belong to another zone
+		{"dev.example.com", []service.DNSRecord{
+			{Name: "dev.example.com", Type: "CNAME", Value: "dev.example.net"},
+			{Name: "dev.example.net", Type: "SOA", Value: "ns1.example.net"},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isZoneApex(tt.name, &service.DNSResolution{Records: tt.records}); got != tt.expected {
+			t.Errorf("isZoneApex(%s, %v) = %v, want %v", tt.name, tt.records, got, tt.expected)
+		}
+	}
+}
+
+func TestCrawlUseCase_RecurseChildren(t *testing.T) {
+	uc, _ := newTestUseCase(t, Config{
+		RootDomains:          []string{"example.com"},
+		RecursiveDepth:       1,
+		RecursiveMinChildren: 3,
+	}, testServices{})
+	resolution := &service.DNSResolution{Records: []service.DNSRecord{{Type: "A", Value: "192.0.2.1"}}}
+
+	tests := []struct {
+		name     string
+		expected []string // Zones queued for expansion by this name
+	}{
+		{"a.dev.example.com", nil},
+		{"b.dev.example.com", nil},
+		{"c.dev.example.com", []string{"dev.example.com"}},
+		{"d.dev.example.com", nil},
+		// Too deep to be expanded
+		{"a.b.c.example.com", nil},
+		{"b.b.c.example.com", nil},
+		{"c.b.c.example.com", nil},
+		// Children of the root are not counted
+		{"www.example.com", nil},
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	for _, tt := range tests {
+		uc.recurse(tt.name, "example.com", resolution)
+
+		expansions, _ := uc.zones.pop(stop)
+		var zones []string
+		for _, expansion := range expansions {
+			// Every name is probed for NS and SOA records of its own
+			if expansion.confirmed {
+				zones = append(zones, expansion.zone)
+			}
+		}
+		if len(zones) != len(tt.expected) || (len(zones) > 0 && zones[0] != tt.expected[0]) {
+			t.Errorf("recurse(%s) queued %v, want %v", tt.name, zones, tt.expected)
+		}
+	}
+}
+
+// zoneResolver answers NS and SOA queries from fixed records and fails the
+// others
+type zoneResolver struct {
+	fakeResolver
+	records map[string][]service.DNSRecord
+}
+
+func (r zoneResolver) ResolveTypes(domain string, recordTypes []string) (*service.DNSResolution, error) {
+	if !slices.Equal(recordTypes, zoneRecordTypes) {
+		return nil, errors.New("unexpected record types")
+	}
+	records, ok := r.records[domain]
+	if !ok {
+		return &service.DNSResolution{Domain: domain, Rcode: "SERVFAIL"}, errors.New("SERVFAIL")
+	}
+	return &service.DNSResolution{Domain: domain, Rcode: "NOERROR", Records: records}, nil
+}
+
+func TestCrawlUseCase_RecurseZones(t *testing.T) {
+	apex := func(name, recordType string) []service.DNSRecord {
+		return []service.DNSRecord{{Name: name, Type: recordType, Value: "ns1." + name}}
+	}
+	resolver := zoneResolver{records: map[string][]service.DNSRecord{
+		"ns.example.com":     apex("ns.example.com", "NS"),
+		"soa.example.com":    apex("soa.example.com", "SOA"),
+		"host.example.com":   {{Name: "host.example.com", Type: "A", Value: "192.0.2.1"}},
+		"alias.example.com":  {{Name: "alias.example.com", Type: "CNAME", Value: "alias.example.net"}, {Name: "alias.example.net", Type: "SOA", Value: "ns1.example.net"}},
+		"deep.a.example.com": apex("deep.a.example.com", "NS"),
+	}}
+
+	tests := []struct {
+		name     string
+		records  []service.DNSRecord // Records resolved by the worker
+		expanded bool
+	}{
+		// Zone records of the crawl's own resolution need no probe
+		{"apex.example.com", apex("apex.example.com", "SOA"), true},
+		// Otherwise NS and SOA records are probed for
+		{"ns.example.com", nil, true},
+		{"soa.example.com", nil, true},
+		{"host.example.com", nil, false},
+		{"alias.example.com", nil, false},
+		{"failing.example.com", nil, false},
+		// Deeper than RecursiveDepth
+		{"deep.a.example.com", nil, false},
+	}
+
+	for _, tt := range tests {
+		uc, _ := newTestUseCase(t, Config{
+			RootDomains:          []string{"example.com"},
+			RecursiveDepth:       1,
+			RecursiveMinChildren: 3,
+		}, testServices{resolver: resolver})
+		records := append([]service.DNSRecord{{Name: tt.name, Type: "A", Value: "192.0.2.1"}}, tt.records...)
+
+		uc.recurse(tt.name, "example.com", &service.DNSResolution{Domain: tt.name, Records: records})
+
+		stop := make(chan struct{})
+		close(stop)
+		expansions, _ := uc.zones.pop(stop)
+		expanded := false
+		for _, expansion := range expansions {
+			if expansion.zone == tt.name && (expansion.confirmed || uc.probeZone(expansion.zone)) {
+				expanded = true
+			}
+		}
+		if expanded != tt.expanded {
+			t.Errorf("recurse(%s) expanded = %v, want %v", tt.name, expanded, tt.expanded)
+		}
+	}
+}
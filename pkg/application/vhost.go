@@ -0,0 +1,108 @@
+package application
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// maxVHostIPs bounds the addresses probed per root domain
+const maxVHostIPs = 256
+
+// collectVHostCandidates remembers the addresses of a root domain, and the
+// names under it without public addresses, which may still be served from
+// one of them
+func (uc *CrawlUseCase) collectVHostCandidates(task *entity.Task, resolution *service.DNSResolution) {
+	root := task.Domain.Root
+
+	uc.vhostLock.Lock()
+	defer uc.vhostLock.Unlock()
+
+	if resolution == nil || len(resolution.IPs)+len(resolution.IPv6) == 0 {
+		if uc.vhostNames[root] == nil {
+			uc.vhostNames[root] = make(map[string]bool)
+		}
+		if len(uc.vhostNames[root]) < uc.config.VHostMaxNames {
+			uc.vhostNames[root][task.Domain.Name] = true
+		}
+		return
+	}
+
+	if uc.vhostIPs[root] == nil {
+		uc.vhostIPs[root] = make(map[string]bool)
+	}
+	for _, ip := range append(append([]string{}, resolution.IPs...), resolution.IPv6...) {
+		if len(uc.vhostIPs[root]) < maxVHostIPs {
+			uc.vhostIPs[root][ip] = true
+		}
+	}
+}
+
+// probeVHosts requests the collected names, and the wordlist under each
+// root, from every address of the root once the crawl is done. Each name
+// served as a distinct virtual host is written as a result of its own.
+func (uc *CrawlUseCase) probeVHosts(ctx context.Context) {
+	uc.vhostLock.Lock()
+	defer uc.vhostLock.Unlock()
+
+	for _, root := range slices.Sorted(maps.Keys(uc.vhostIPs)) {
+		names := uc.vhostCandidates(root)
+		if len(names) == 0 {
+			continue
+		}
+
+		found := make(map[string][]entity.VHost)
+		for _, ip := range slices.Sorted(maps.Keys(uc.vhostIPs[root])) {
+			if ctx.Err() != nil {
+				return
+			}
+
+			atomic.AddInt64(&uc.metrics.VHostProbes, int64(len(names)*len(uc.config.Protocols)))
+			for _, vhost := range uc.prober.Probe(ip, root, names, uc.config.Protocols) {
+				if vhost.Message != nil {
+					uc.logWriter.WriteHTTPLog(vhost.Message)
+					if vhost.Message.Response != nil {
+						vhost.Title = uc.extractor.ExtractTitle(vhost.Message.Response.Body)
+					}
+				}
+				found[vhost.Name] = append(found[vhost.Name], vhost.VHost)
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(found)) {
+			atomic.AddInt64(&uc.metrics.VHostsFound, 1)
+			uc.resultQueue.Send(&entity.CrawlResult{
+				Domain:    name,
+				VHosts:    found[name],
+				Timestamp: time.Now(),
+			})
+		}
+	}
+}
+
+// vhostCandidates returns the names probed under root: the names found
+// without addresses, then wordlist names, up to VHostMaxNames
+func (uc *CrawlUseCase) vhostCandidates(root string) []string {
+	names := slices.Sorted(maps.Keys(uc.vhostNames[root]))
+	if uc.wordlist == nil || len(names) >= uc.config.VHostMaxNames {
+		return names
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		seen[name] = true
+	}
+	uc.wordlist.Each(func(label string) bool {
+		if name := label + "." + root; !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return len(names) < uc.config.VHostMaxNames
+	})
+	return names
+}
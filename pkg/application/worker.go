@@ -2,6 +2,7 @@ package application
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -14,20 +15,22 @@ import (
 
 // Worker processes crawling tasks
 type Worker struct {
-	id          int
-	useCase     *CrawlUseCase
-	taskQueue   repository.TaskQueue
-	resultQueue repository.ResultQueue
-	fetcher     service.HTTPFetcher
-	resolver    service.DNSResolver
-	validator   service.DomainValidator
-	calculator  service.DomainCalculator
-	extractor   service.DomainExtractor
-	filter      repository.DomainFilter
-	logWriter   repository.LogWriter
-	stopChan    <-chan struct{}
-	maxDepth    int
-	protocols   []string
+	id           int
+	useCase      *CrawlUseCase
+	taskQueue    repository.TaskQueue
+	resultQueue  repository.ResultQueue
+	fetcher      service.HTTPFetcher
+	resolver     service.DNSResolver
+	wildcard     service.WildcardDetector
+	validator    service.DomainValidator
+	calculator   service.DomainCalculator
+	extractor    service.DomainExtractor
+	filter       repository.DomainFilter
+	logWriter    repository.LogWriter
+	stopChan     <-chan struct{}
+	maxDepth     int
+	protocols    []string
+	wildcardMode string
 
 	currentDomain atomic.Value // stores string
 	isActive      atomic.Bool
@@ -70,7 +73,12 @@ func (w *Worker) GetCurrentDomain() string {
 func (w *Worker) processTask(task *entity.Task) {
 	w.isActive.Store(true)
 	w.currentDomain.Store(task.Domain.Name)
+	// Tasks without a result leave the journal here; the others once their result is written
+	resultSent := false
 	defer func() {
+		if !resultSent {
+			w.useCase.journal.Done(task.Domain.Name)
+		}
 		w.isActive.Store(false)
 		w.currentDomain.Store("")
 		w.useCase.incrementTasksProcessed()
@@ -82,14 +90,59 @@ func (w *Worker) processTask(task *entity.Task) {
 		return
 	}
 
-	// Fetch HTTP content
-	var subdomains []string
-	var crawlResult *entity.CrawlResult
+	// Resolve DNS
+	resolution, dnsErr := w.resolveDNS(task.Domain.Name)
+	w.useCase.incrementDNSRequests()
+
+	// Check wildcard resolution
+	wildcard := w.isWildcard(task, resolution)
+	if wildcard {
+		w.useCase.incrementWildcardCount()
+		if w.wildcardMode == WildcardModeDrop {
+			return
+		}
+	}
+
+	// Names that exist are worth permuting; wildcard matches are not
+	if w.useCase.permutator != nil && !wildcard && resolution != nil && len(resolution.IPs)+len(resolution.IPv6) > 0 {
+		w.useCase.permute(task.Domain.Name, task.Domain.Root)
+	}
+
+	// Zones found below the root get a wordlist of their own
+	if w.useCase.config.RecursiveDepth > 0 && !wildcard && resolution != nil && len(resolution.Records) > 0 {
+		w.useCase.recurse(task.Domain.Name, task.Domain.Root, resolution)
+	}
+
+	// Mine subdomains from DNS record data
+	var discoveries []service.Discovery
+	if resolution != nil {
+		discoveries = append(discoveries, w.extractor.ExtractFromDNSRecords(resolution.Records)...)
+	}
+	discoveries = append(discoveries, w.useCase.mineDMARC(task.Domain.Root)...)
+
+	if w.useCase.prober != nil {
+		w.useCase.collectVHostCandidates(task, resolution)
+	}
+
+	// Fetch HTTP content, recording every protocol attempt
+	crawlResult := &entity.CrawlResult{
+		Domain:    task.Domain.Name,
+		Attempts:  make([]entity.Attempt, 0, len(task.Protocols)),
+		Timestamp: time.Now(),
+	}
+	var certificate *entity.TLSCertificate
+	var primary *service.HTTPResponse
 	successfulFetch := false
 
+	// Dial the addresses already resolved rather than looking the name up again
+	var ips []string
+	if resolution != nil {
+		ips = append(slices.Clone(resolution.IPs), resolution.IPv6...)
+	}
+
 	for _, protocol := range task.Protocols {
 		url := fmt.Sprintf("%s://%s", protocol, task.Domain.Name)
-		resp, err := w.fetcher.Fetch(url)
+		resp, err := w.fetcher.Fetch(url, ips)
 
 		success := err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300
 		w.useCase.incrementHTTPRequests(success)
@@ -97,30 +150,36 @@ func (w *Worker) processTask(task *entity.Task) {
 		// Log HTTP request
 		w.logWriter.WriteHTTPLog(resp.Message)
 
+		crawlResult.Attempts = append(crawlResult.Attempts, toAttempt(protocol, url, resp))
+
+		// Hosts along the redirect chain are discoveries even if the fetch failed
+		discoveries = append(discoveries, w.extractor.ExtractFromRedirects(resp.Redirects)...)
+
 		if err != nil {
 			w.useCase.incrementErrorCount()
 			continue
 		}
 
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		// Harvest hostnames from the TLS certificate, whatever the status code
+		if resp.Certificate != nil {
+			discoveries = append(discoveries, w.extractor.ExtractFromCertificate(resp.Certificate)...)
+			certificate = resp.Certificate
+		}
+
+		// Extract subdomains from headers and body; redirects and error
+		// pages leak hostnames as often as successful responses
+		discoveries = append(discoveries, w.extractor.ExtractFromHeaders(resp.Headers)...)
+		for _, domain := range w.extractor.ExtractFromText(resp.Body) {
+			discoveries = append(discoveries, service.Discovery{Domain: domain, Source: service.SourceHTTPBody})
+		}
+
+		// Report the first response unless a later protocol succeeds
+		if primary == nil || success {
+			primary = resp
+		}
+
+		if success {
 			successfulFetch = true
-			// Extract subdomains from response
-			domains := w.extractor.ExtractFromText(resp.Body)
-			filtered := w.extractor.FilterByRoot(domains, task.Domain.Root)
-			subdomains = append(subdomains, filtered...)
-
-			// Extract title
-			title := w.extractor.ExtractTitle(resp.Body)
-
-			crawlResult = &entity.CrawlResult{
-				Domain:        task.Domain.Name,
-				Status:        resp.Message.Response.Status,
-				StatusCode:    resp.StatusCode,
-				Title:         title,
-				ContentLength: resp.ContentLength,
-				Subdomains:    filtered,
-				Timestamp:     time.Now(),
-			}
 			break // Success, no need to try other protocols
 		}
 	}
@@ -129,8 +188,19 @@ func (w *Worker) processTask(task *entity.Task) {
 		w.useCase.incrementErrorCount()
 	}
 
-	// Deduplicate subdomains
-	uniqueSubdomains := w.deduplicateSubdomains(subdomains)
+	if primary != nil {
+		crawlResult.Status = primary.Message.Response.Status
+		crawlResult.StatusCode = primary.StatusCode
+		crawlResult.Title = w.extractor.ExtractTitle(primary.Body)
+		crawlResult.ContentLength = primary.ContentLength
+	}
+
+	// Deduplicate in-scope subdomains and enqueue them before any checkpoint
+	// can observe the filter without the matching tasks
+	w.useCase.checkpointLock.RLock()
+	uniqueSubdomains, sources := w.deduplicateDiscoveries(task, discoveries)
+	w.enqueueSubdomains(task, uniqueSubdomains, sources)
+	w.useCase.checkpointLock.RUnlock()
 
 	// Notify observers of new discoveries
 	for _, subdomain := range uniqueSubdomains {
@@ -139,59 +209,129 @@ func (w *Worker) processTask(task *entity.Task) {
 		}
 	}
 
-	// Resolve DNS
-	ips, dnsErr := w.resolveDNS(task.Domain.Name)
-	w.useCase.incrementDNSRequests()
-
-	// Update crawl result
-	if crawlResult != nil {
-		crawlResult.Subdomains = uniqueSubdomains
-		crawlResult.IPs = ips
-		if dnsErr != nil {
-			crawlResult.Error = dnsErr.Error()
-		}
-		w.resultQueue.Send(crawlResult)
+	// Update crawl result; every task yields one, whether or not it has web content
+	crawlResult.Subdomains = uniqueSubdomains
+	crawlResult.Sources = sources
+	crawlResult.Wildcard = wildcard
+	crawlResult.Certificate = certificate
+	crawlResult.WildcardSANs = w.wildcardSANs(task, certificate)
+	if resolution != nil {
+		crawlResult.DNSStatus = resolution.Rcode
+		crawlResult.DNSRetries = resolution.Retries
+		crawlResult.Delegations = resolution.Delegations
+		crawlResult.IPs = resolution.IPs
+		crawlResult.IPv6 = resolution.IPv6
+		crawlResult.CNAMEs = resolution.CNAMEs
+		crawlResult.MX = resolution.MX
+		crawlResult.NS = resolution.NS
+		crawlResult.TXT = resolution.TXT
+		crawlResult.SOA = resolution.SOA
+	}
+	if dnsErr != nil {
+		crawlResult.Error = dnsErr.Error()
 	}
+	w.resultQueue.Send(crawlResult)
+	resultSent = true
 
-	// Enqueue unique subdomains for further crawling
-	w.enqueueSubdomains(task, uniqueSubdomains)
+	// Pivot on the neighbors of the domain's addresses once its own result
+	// is out, which the sweep results follow
+	if w.useCase.sweeper != nil && !wildcard && resolution != nil {
+		w.useCase.queueSweep(task.Domain.Name, task.Domain.Root, resolution.IPs)
+	}
 
 	// Update metrics
 	w.useCase.incrementUniqueSubdomains(int64(len(uniqueSubdomains)))
 }
 
-// deduplicateSubdomains removes duplicate subdomains
-func (w *Worker) deduplicateSubdomains(subdomains []string) []string {
+// deduplicateDiscoveries keeps unseen discoveries under the task's root and
+// returns them along with the source each one was first found in
+func (w *Worker) deduplicateDiscoveries(task *entity.Task, discoveries []service.Discovery) ([]string, map[string]string) {
 	unique := make([]string, 0)
-	for _, subdomain := range subdomains {
-		subdomain = strings.ToLower(strings.TrimSpace(subdomain))
+	sources := make(map[string]string)
+	for _, discovery := range discoveries {
+		subdomain := strings.ToLower(strings.TrimSpace(discovery.Domain))
 		if subdomain == "" {
 			continue
 		}
 
+		if len(w.extractor.FilterByRoot([]string{subdomain}, task.Domain.Root)) == 0 {
+			continue
+		}
+
 		if !w.filter.Contains(subdomain) {
 			w.filter.Add(subdomain)
 			unique = append(unique, subdomain)
+			sources[subdomain] = discovery.Source
 		}
 	}
-	return unique
+	return unique, sources
+}
+
+// toAttempt summarizes a fetch of url over protocol
+func toAttempt(protocol, url string, resp *service.HTTPResponse) entity.Attempt {
+	attempt := entity.Attempt{
+		Protocol:   protocol,
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		ErrorClass: resp.ErrorClass,
+		Error:      resp.Error,
+		LatencyMs:  resp.LatencyMs,
+		Tries:      resp.Tries,
+		Redirects:  resp.Redirects,
+	}
+
+	// Report where the request ended up, or where it was told to go
+	if resp.FinalURL != "" && resp.FinalURL != url {
+		attempt.RedirectTo = resp.FinalURL
+	} else if location := resp.Headers["Location"]; location != "" {
+		attempt.RedirectTo = location
+	}
+
+	return attempt
+}
+
+// wildcardSANs returns the in-scope wildcard names of a certificate
+func (w *Worker) wildcardSANs(task *entity.Task, certificate *entity.TLSCertificate) []string {
+	if certificate == nil {
+		return nil
+	}
+
+	var names []string
+	for _, name := range certificate.DNSNames {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "*.") && w.validator.IsInScope(strings.TrimPrefix(name, "*."), task.Domain.Root) {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
 // resolveDNS resolves the domain to IP addresses
-func (w *Worker) resolveDNS(domain string) ([]string, error) {
+func (w *Worker) resolveDNS(domain string) (*service.DNSResolution, error) {
 	resolution, err := w.resolver.ResolveWithDetails(domain)
+	if resolution != nil {
+		// Log every DNS query, including failed ones
+		for _, message := range resolution.Messages {
+			w.logWriter.WriteDNSLog(message)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Log DNS query
-	w.logWriter.WriteDNSLog(resolution.Message)
+	return resolution, nil
+}
 
-	return resolution.IPs, nil
+// isWildcard checks if the task's resolution matches a wildcard under its root
+func (w *Worker) isWildcard(task *entity.Task, resolution *service.DNSResolution) bool {
+	if w.wildcard == nil || w.wildcardMode == WildcardModeOff || resolution == nil {
+		return false
+	}
+	return w.wildcard.IsWildcard(task.Domain.Name, task.Domain.Root, resolution)
 }
 
 // enqueueSubdomains enqueues discovered subdomains for crawling
-func (w *Worker) enqueueSubdomains(parentTask *entity.Task, subdomains []string) {
+func (w *Worker) enqueueSubdomains(parentTask *entity.Task, subdomains []string, sources map[string]string) {
 	for _, subdomain := range subdomains {
 		// Validate scope
 		if !w.validator.IsInScope(subdomain, parentTask.Domain.Root) {
@@ -212,12 +352,14 @@ func (w *Worker) enqueueSubdomains(parentTask *entity.Task, subdomains []string)
 				Depth: newDepth,
 			},
 			Protocols: w.protocols,
+			Source:    sources[subdomain],
 		}
 
-		if w.taskQueue.Enqueue(newTask) {
-			w.useCase.taskWG.Add(1)
+		if w.useCase.enqueue(newTask) {
 			// Track enqueued tasks
 			atomic.AddInt64(&w.useCase.metrics.TasksEnqueued, 1)
+		} else {
+			w.useCase.incrementTasksDropped()
 		}
 	}
 }
@@ -13,20 +13,112 @@ type Domain struct {
 type Task struct {
 	Domain    Domain
 	Protocols []string
+	Source    string // Where the domain was discovered, e.g. "tls:san"
 	CreatedAt time.Time
 }
 
 // CrawlResult represents the result of crawling a domain
 type CrawlResult struct {
-	Domain        string    `json:"domain"`
-	IPs           []string  `json:"ips"`
-	Subdomains    []string  `json:"subdomains"`
-	Status        string    `json:"status"`
-	StatusCode    int       `json:"status_code"`
-	Title         string    `json:"title"`
-	ContentLength int       `json:"content_length"`
-	Error         string    `json:"error,omitempty"`
-	Timestamp     time.Time `json:"timestamp"`
+	Domain        string            `json:"domain"`
+	IPs           []string          `json:"ips"`
+	IPv6          []string          `json:"ipv6,omitempty"`
+	CNAMEs        []string          `json:"cname,omitempty"`
+	MX            []string          `json:"mx,omitempty"`
+	NS            []string          `json:"ns,omitempty"`
+	TXT           []string          `json:"txt,omitempty"`
+	SOA           string            `json:"soa,omitempty"`
+	Subdomains    []string          `json:"subdomains"`
+	Sources       map[string]string `json:"sources,omitempty"` // Subdomain -> discovery source
+	Status        string            `json:"status"`
+	StatusCode    int               `json:"status_code"`
+	Title         string            `json:"title"`
+	ContentLength int               `json:"content_length"`
+	DNSStatus     string            `json:"dns_status,omitempty"`
+	DNSRetries    int               `json:"dns_retries,omitempty"`
+	Delegations   []Delegation      `json:"delegations,omitempty"` // Zone cuts walked by iterative resolution
+	ZoneTransfers []ZoneTransfer    `json:"zone_transfers,omitempty"`
+	ZoneWalk      *ZoneWalk         `json:"zone_walk,omitempty"`  // Zone findings of a root, in a result of their own
+	PTRSweeps     []PTRSweep        `json:"ptr_sweeps,omitempty"` // Blocks swept around the domain's addresses, in a result of their own
+	VHosts        []VHost           `json:"vhosts,omitempty"`     // Addresses serving the domain as a virtual host
+	Attempts      []Attempt         `json:"attempts"`
+	Error         string            `json:"error,omitempty"`
+	Wildcard      bool              `json:"wildcard,omitempty"`
+	WildcardSANs  []string          `json:"wildcard_sans,omitempty"`
+	Certificate   *TLSCertificate   `json:"certificate,omitempty"`
+	Timestamp     time.Time         `json:"timestamp"`
+}
+
+// Delegation represents a zone cut crossed while resolving a name from the root
+type Delegation struct {
+	Zone        string   `json:"zone"`
+	Nameservers []string `json:"nameservers"`
+	Server      string   `json:"server"` // Address of the nameserver that was queried
+}
+
+// ZoneTransfer represents a zone transfer attempted against a nameserver
+type ZoneTransfer struct {
+	Zone       string `json:"zone"`
+	Nameserver string `json:"nameserver"`
+	Server     string `json:"server"`
+	Type       string `json:"type"` // "AXFR" or "IXFR"
+	Allowed    bool   `json:"allowed"`
+	Records    int    `json:"records,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ZoneWalk represents the enumeration of a DNSSEC-signed zone through its
+// NSEC or NSEC3 records
+type ZoneWalk struct {
+	Zone    string `json:"zone"`
+	Server  string `json:"server"`
+	Method  string `json:"method"` // "nsec" or "nsec3"
+	Found   int    `json:"found"`  // Names enumerated or matched against the wordlist
+	Queries int    `json:"queries"`
+	// NSEC3 hashes and parameters, to crack offline
+	Hashes     []string `json:"hashes,omitempty"`
+	Algorithm  uint8    `json:"algorithm,omitempty"`
+	Iterations uint16   `json:"iterations,omitempty"`
+	Salt       string   `json:"salt,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// PTRSweep represents the reverse DNS lookups of an address block
+type PTRSweep struct {
+	Block   string      `json:"block"`
+	Pivot   string      `json:"pivot"`   // Discovered address the block was swept around
+	Queried int         `json:"queried"` // Addresses looked up
+	Records []PTRRecord `json:"records,omitempty"`
+}
+
+// PTRRecord represents a name an address points back to
+type PTRRecord struct {
+	IP   string `json:"ip"`
+	Name string `json:"name"`
+}
+
+// VHost represents a name served from an address with content distinct
+// from what the address serves for unknown names
+type VHost struct {
+	IP             string `json:"ip"`
+	Protocol       string `json:"protocol"`
+	StatusCode     int    `json:"status_code"`
+	ContentLength  int    `json:"content_length"`
+	Title          string `json:"title,omitempty"`
+	BaselineStatus int    `json:"baseline_status"`
+	BaselineLength int    `json:"baseline_length"`
+}
+
+// Attempt represents a single protocol fetch attempt for a domain
+type Attempt struct {
+	Protocol   string    `json:"protocol"`
+	URL        string    `json:"url"`
+	StatusCode int       `json:"status_code,omitempty"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	LatencyMs  int64     `json:"latency_ms"`
+	Tries      int       `json:"tries"`
+	RedirectTo string    `json:"redirect_to,omitempty"`
+	Redirects  []HTTPHop `json:"redirects,omitempty"`
 }
 
 // DNSRecord represents a DNS resolution record
@@ -40,17 +132,81 @@ type DNSRecord struct {
 
 // Metrics represents crawling metrics
 type Metrics struct {
-	QueueLength      int
-	ActiveWorkers    int
-	TotalWorkers     int
-	HTTPRequests     int64
-	DNSRequests      int64
-	UniqueSubdomains int64
-	TasksProcessed   int64
-	TasksEnqueued    int64
-	ErrorCount       int64
-	SuccessCount     int64
-	StartTime        time.Time
-	LastUpdateTime   time.Time
-	ActiveDomains    []string
+	QueueLength       int
+	ActiveWorkers     int
+	TotalWorkers      int
+	HTTPRequests      int64
+	DNSRequests       int64
+	UniqueSubdomains  int64
+	TasksProcessed    int64
+	TasksEnqueued     int64
+	TasksSpilled      int64
+	TasksDropped      int64
+	ErrorCount        int64
+	SuccessCount      int64
+	WildcardCount     int64
+	ThrottledTime     time.Duration
+	DNSServers        []DNSServerStats
+	DNSCacheHits      int64
+	DNSCacheCoalesced int64
+	DNSCacheMisses    int64
+	BruteForced       int64 // Wordlist names resolved
+	BruteForceFound   int64 // Wordlist names confirmed and enqueued
+	Permutations      int64 // Permuted names resolved
+	PermutationsFound int64 // Permuted names confirmed and enqueued
+	Recursed          int64 // Wordlist names resolved under discovered zones
+	RecursedFound     int64 // Wordlist names under discovered zones confirmed and enqueued
+	PTRBlocks         int64 // Address blocks swept
+	PTRNames          int64 // PTR names found in swept blocks
+	VHostProbes       int64 // Names requested from discovered addresses
+	VHostsFound       int64 // Virtual hosts distinct from their address's baseline
+	StartTime         time.Time
+	LastUpdateTime    time.Time
+	ActiveDomains     []string
+}
+
+// DNSServerStats represents the health of a DNS server
+type DNSServerStats struct {
+	Server      string
+	Queries     int64
+	Errors      int64
+	ServFails   int64
+	LatencyMs   float64
+	Score       float64
+	Quarantined bool
+}
+
+// Checkpoint represents a resumable snapshot of a crawl session
+type Checkpoint struct {
+	RootDomains []string `json:"root_domains"`
+	// Tasks are the pending tasks held in memory or in flight; those spilled
+	// to disk stay in the segment logs located by Spills
+	Tasks  []*Task         `json:"tasks"`
+	Spills []SpillPosition `json:"spills,omitempty"`
+	// ZonesEnumerated reports whether the zones of the roots were transferred
+	// and walked, ZoneResults the findings not yet written to the output, and
+	// BruteForceOffsets the number of leading wordlist labels checked under
+	// each root
+	ZonesEnumerated   bool             `json:"zones_enumerated"`
+	ZoneResults       []*CrawlResult   `json:"zone_results,omitempty"`
+	BruteForceOffsets map[string]int64 `json:"brute_force_offsets,omitempty"`
+	Metrics           Metrics          `json:"metrics"`
+	OutputFile        string           `json:"output_file"`
+	OutputOffset      int64            `json:"output_offset"`
+	HTTPLogFile       string           `json:"http_log_file"`
+	DNSLogFile        string           `json:"dns_log_file"`
+	BloomFilterFile   string           `json:"bloom_filter_file"`
+	SavedAt           time.Time        `json:"saved_at"`
+}
+
+// SpillPosition locates the unread tasks of a spilling queue's segment logs
+type SpillPosition struct {
+	Dir          string `json:"dir"`
+	Tasks        int    `json:"tasks"`
+	ReadSegment  int    `json:"read_segment"`
+	ReadCount    int    `json:"read_count"`  // Tasks already read from the read segment
+	ReadOffset   int64  `json:"read_offset"` // Bytes already read from the read segment
+	WriteSegment int    `json:"write_segment"`
+	WriteCount   int    `json:"write_count"`
+	WriteOffset  int64  `json:"write_offset"` // Size of the write segment
 }
@@ -1,9 +1,21 @@
 package entity
 
+import "time"
+
 // HTTPMessage represents a complete HTTP message (request + response)
 type HTTPMessage struct {
-	Request  *HTTPRequest  `json:"request"`
-	Response *HTTPResponse `json:"response"`
+	Request   *HTTPRequest  `json:"request"`
+	Response  *HTTPResponse `json:"response"`
+	Redirects []HTTPHop     `json:"redirects,omitempty"`
+	Tries     int           `json:"tries"` // Number of tries, including retries
+}
+
+// HTTPHop represents a single redirect response in a redirect chain
+type HTTPHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location"`
+	LatencyMs  int64  `json:"latency_ms"`
 }
 
 // HTTPRequest represents detailed HTTP request info
@@ -24,6 +36,17 @@ type HTTPResponse struct {
 	Header        map[string]string `json:"header"`
 	Body          string            `json:"body"`
 	ContentLength int64             `json:"content_length"`
+	Certificate   *TLSCertificate   `json:"certificate,omitempty"`
+}
+
+// TLSCertificate represents the leaf certificate presented during a TLS handshake
+type TLSCertificate struct {
+	CommonName  string    `json:"common_name"`
+	DNSNames    []string  `json:"dns_names"`
+	Issuer      string    `json:"issuer"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	Fingerprint string    `json:"fingerprint"` // SHA-256 of the DER encoding
 }
 
 // DNSMessage represents a complete DNS transaction
@@ -34,18 +57,24 @@ type DNSMessage struct {
 	Response *DNSDetail `json:"response"`
 	RTT      int64      `json:"rtt"`   // in milliseconds
 	Error    string     `json:"error"` // string error representation
+	Tries    int        `json:"tries"` // Number of tries, including retries
+
+	Transport   string `json:"transport"`              // "udp", "tcp", "tls" or "https"
+	TCPFallback bool   `json:"tcp_fallback,omitempty"` // Truncated over UDP and repeated over TCP
 }
 
 // DNSDetail represents detailed DNS packet info
 type DNSDetail struct {
-	ID       uint16        `json:"id"`
-	Response bool          `json:"response"`
-	Opcode   int           `json:"opcode"`
-	Rcode    int           `json:"rcode"`
-	Question []DNSQuestion `json:"question"`
-	Answer   []DNSRR       `json:"answer"`
-	Nv       []DNSRR       `json:"authority"`
-	Extra    []DNSRR       `json:"extra"`
+	ID        uint16        `json:"id"`
+	Response  bool          `json:"response"`
+	Opcode    int           `json:"opcode"`
+	Rcode     int           `json:"rcode"`
+	Truncated bool          `json:"truncated"`
+	UDPSize   uint16        `json:"udp_size,omitempty"` // EDNS0 UDP payload size, if advertised
+	Question  []DNSQuestion `json:"question"`
+	Answer    []DNSRR       `json:"answer"`
+	Nv        []DNSRR       `json:"authority"`
+	Extra     []DNSRR       `json:"extra"`
 }
 
 // DNSQuestion represents a DNS question
@@ -12,6 +12,9 @@ type DomainFilter interface {
 	Save(filename string) error
 	// Load restores the filter state
 	Load(filename string) error
+	// Copy returns an independent copy of the filter, to save while the
+	// original keeps changing
+	Copy() DomainFilter
 }
 
 // ResultWriter writes crawl results
@@ -20,6 +23,8 @@ type ResultWriter interface {
 	Write(result *entity.CrawlResult) error
 	// Flush ensures all buffered data is written
 	Flush() error
+	// Offset returns the number of bytes written to the output so far
+	Offset() (int64, error)
 	// Close closes the writer
 	Close() error
 }
@@ -46,6 +51,25 @@ type TaskQueue interface {
 	Close()
 }
 
+// SpillCounter is implemented by task queues that overflow to disk
+type SpillCounter interface {
+	// Spilled returns the number of tasks written to disk so far
+	Spilled() int64
+}
+
+// TaskQueueSnapshotter is implemented by task queues that checkpoint their
+// spilled tasks in place rather than through the task journal. Such queues
+// add every task they hand out to the journal themselves, so that a task is
+// always in either a snapshot or the journal.
+type TaskQueueSnapshotter interface {
+	// Snapshot returns the tasks queued in memory and the positions of those
+	// spilled to disk, which are kept on disk until released
+	Snapshot() ([]*entity.Task, []entity.SpillPosition, error)
+	// Release lets the queue delete the spilled tasks read before positions,
+	// once a checkpoint referencing them is saved
+	Release(positions []entity.SpillPosition)
+}
+
 // ResultQueue manages crawling results
 type ResultQueue interface {
 	// Send sends a result to the queue
@@ -55,3 +79,24 @@ type ResultQueue interface {
 	// Close closes the queue
 	Close()
 }
+
+// TaskJournal tracks tasks that have been enqueued, or dequeued from a
+// TaskQueueSnapshotter, but not yet completed
+type TaskJournal interface {
+	// Add records a task as pending
+	Add(task *entity.Task)
+	// Done marks a pending task for the domain as completed
+	Done(domain string)
+	// Pending returns a snapshot of all pending and in-flight tasks
+	Pending() []*entity.Task
+	// Len returns the number of pending and in-flight tasks
+	Len() int
+}
+
+// CheckpointStore persists crawl checkpoints
+type CheckpointStore interface {
+	// Save persists a checkpoint, replacing the previous one
+	Save(checkpoint *entity.Checkpoint) error
+	// Load restores the last saved checkpoint
+	Load() (*entity.Checkpoint, error)
+}
@@ -1,6 +1,10 @@
 package service
 
-import "github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+import (
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+)
 
 // DomainValidator validates domain names
 type DomainValidator interface {
@@ -32,37 +36,165 @@ type DomainExtractor interface {
 	FilterByRoot(domains []string, root string) []string
 	// ExtractTitle extracts the title from HTML content
 	ExtractTitle(html string) string
+	// ExtractFromDNSRecords extracts domains from DNS record data
+	ExtractFromDNSRecords(records []DNSRecord) []Discovery
+	// ExtractFromCertificate extracts domains from certificate SANs and CN
+	ExtractFromCertificate(cert *entity.TLSCertificate) []Discovery
+	// ExtractFromHeaders extracts domains from HTTP response headers
+	ExtractFromHeaders(headers map[string]string) []Discovery
+	// ExtractFromRedirects extracts domains from the hops of a redirect chain
+	ExtractFromRedirects(hops []entity.HTTPHop) []Discovery
+}
+
+// Discovery represents a domain found in crawled data
+type Discovery struct {
+	Domain string
+	// Source describes where the domain was found, e.g. "http:body" or "dns:cname"
+	Source string
 }
 
+// TaskPolicy decides the order in which queued tasks of the same root are crawled
+type TaskPolicy interface {
+	// Less reports whether task a should be crawled before task b
+	Less(a, b *entity.Task) bool
+}
+
+// Discovery sources
+const (
+	// SourceInput marks domains read from the input
+	SourceInput = "input"
+	// SourceHTTPBody marks domains found in an HTTP response body
+	SourceHTTPBody = "http:body"
+	// SourceHTTPHeaderPrefix prefixes the lowercase header name of header discoveries
+	SourceHTTPHeaderPrefix = "http:header:"
+	// SourceHTTPRedirect marks domains found in a redirect chain
+	SourceHTTPRedirect = "http:redirect"
+	// SourceDNSPrefix prefixes the lowercase record type of DNS discoveries
+	SourceDNSPrefix = "dns:"
+	// SourceZoneTransfer marks owner names of a zone handed over by AXFR or IXFR
+	SourceZoneTransfer = "dns:axfr"
+	// SourceZoneWalk marks names enumerated from NSEC records or matched against NSEC3 hashes
+	SourceZoneWalk = "dns:nsec"
+	// SourceBruteForce marks wordlist names confirmed to resolve
+	SourceBruteForce = "dns:brute"
+	// SourcePermutation marks permutations of discovered names confirmed to resolve
+	SourcePermutation = "dns:permutation"
+	// SourceRecursive marks wordlist names confirmed to resolve under a discovered zone
+	SourceRecursive = "dns:recursive"
+	// SourcePTR marks names found by reverse lookups around discovered addresses
+	SourcePTR = "dns:ptr"
+	// SourceTLSSAN marks domains found in a certificate's subject alternative names
+	SourceTLSSAN = "tls:san"
+	// SourceTLSCN marks domains found in a certificate's common name
+	SourceTLSCN = "tls:cn"
+	// SourceTLSWildcard marks the base domain of a wildcard certificate name
+	SourceTLSWildcard = "tls:wildcard"
+)
+
 // HTTPFetcher fetches web content
 type HTTPFetcher interface {
-	// Fetch fetches a URL and returns the response
-	Fetch(url string) (*HTTPResponse, error)
+	// Fetch fetches a URL and returns the response. The URL's host is dialed
+	// at ips, in order, when they are given, so that it is not resolved again.
+	Fetch(url string, ips []string) (*HTTPResponse, error)
+}
+
+// PinnedFetcher fetches web content from a fixed address
+type PinnedFetcher interface {
+	// FetchAt fetches a URL from ip, presenting the URL's host in the Host
+	// header and TLS server name
+	FetchAt(url, ip string) (*HTTPResponse, error)
+}
+
+// VHostProber finds virtual hosts served from an address
+type VHostProber interface {
+	// Probe requests each name from ip over each protocol and returns those
+	// answered with content distinct from the responses to random names
+	// under root
+	Probe(ip, root string, names, protocols []string) []VHost
+}
+
+// VHost is a virtual host found by probing, with the response that set it
+// apart from the baseline
+type VHost struct {
+	entity.VHost
+	Name    string
+	Message *entity.HTTPMessage
 }
 
 // HTTPResponse represents an HTTP response
 type HTTPResponse struct {
 	URL           string
+	FinalURL      string // URL of the last response after following redirects
 	StatusCode    int
 	Headers       map[string]string
 	Body          string
 	ContentLength int
+	LatencyMs     int64
 	Error         string
+	ErrorClass    string
+	Redirects     []entity.HTTPHop
+	Certificate   *entity.TLSCertificate
+	Tries         int // Number of tries, including retries
 	Message       *entity.HTTPMessage
 }
 
+// Error classes of failed requests
+const (
+	ErrorClassTimeout           = "timeout"
+	ErrorClassDNS               = "dns"
+	ErrorClassConnectionRefused = "connection_refused"
+	ErrorClassConnectionReset   = "connection_reset"
+	ErrorClassTLS               = "tls"
+	ErrorClassRedirect          = "redirect"
+	ErrorClassServFail          = "servfail"
+	ErrorClassServerError       = "server_error" // HTTP 5xx
+	ErrorClassRateLimited       = "rate_limited" // HTTP 429
+	ErrorClassOther             = "other"
+)
+
+// RetryPolicy decides whether and when failed requests are retried
+type RetryPolicy interface {
+	// Backoff returns the delay before retrying a request whose given try
+	// (starting at 1) failed with the given error class, and false if the
+	// request should not be retried. retryAfter is the delay the server asked
+	// for, or 0.
+	Backoff(try int, errorClass string, retryAfter time.Duration) (time.Duration, bool)
+}
+
 // DNSResolver resolves domain names
 type DNSResolver interface {
 	// Resolve resolves a domain to IP addresses
 	Resolve(domain string) ([]string, error)
 	// ResolveWithDetails resolves a domain and returns detailed records
 	ResolveWithDetails(domain string) (*DNSResolution, error)
+	// ResolveTypes resolves the given record types (e.g. "A", "MX") of a domain
+	ResolveTypes(domain string, recordTypes []string) (*DNSResolution, error)
+}
+
+// DNSServerReporter is implemented by resolvers that track the health of their servers
+type DNSServerReporter interface {
+	// ServerStats returns a snapshot of the health of every DNS server
+	ServerStats() []entity.DNSServerStats
+}
+
+// DNSCacheReporter is implemented by resolvers that cache resolutions
+type DNSCacheReporter interface {
+	// CacheStats returns the number of lookups answered from the cache, those
+	// that waited for an identical lookup in progress, and those sent upstream
+	CacheStats() (hits, coalesced, misses int64)
 }
 
 // DNSResolution represents detailed DNS resolution result
 type DNSResolution struct {
 	Domain      string
 	IPs         []string
+	IPv6        []string
+	CNAMEs      []string // CNAME chain in resolution order
+	MX          []string
+	NS          []string
+	TXT         []string
+	SOA         string
+	Rcode       string // Response code of the first answered query, e.g. "NXDOMAIN"
 	Records     []DNSRecord
 	Server      string
 	RTTMs       int64
@@ -71,13 +203,115 @@ type DNSResolution struct {
 	ResponseAt  int64
 	RawRequest  string
 	RawResponse string
-	Message     *entity.DNSMessage
+	Messages    []*entity.DNSMessage // One message per query
+	Retries     int                  // Number of retried queries
+	Delegations []entity.Delegation  // Zone cuts walked, root first, if resolved iteratively
 }
 
 // DNSRecord represents a DNS record
 type DNSRecord struct {
+	Name  string
 	Type  string
 	Value string
 	TTL   uint32
 	Class string
 }
+
+// WildcardDetector detects wildcard DNS resolution under parent domains
+type WildcardDetector interface {
+	// Fingerprint returns the cached wildcard fingerprint of a parent domain,
+	// probing it with random labels on first use. It returns nil if the
+	// parent does not resolve wildcard names.
+	Fingerprint(parent string) *WildcardFingerprint
+	// IsWildcard checks if the resolution of domain matches the wildcard
+	// fingerprint of any of its parents up to and including root
+	IsWildcard(domain, root string, resolution *DNSResolution) bool
+}
+
+// WildcardFingerprint represents the records returned for random labels
+// under a wildcard parent domain
+type WildcardFingerprint struct {
+	Parent string
+	IPs    []string
+	CNAMEs []string
+}
+
+// ZoneTransferer attempts zone transfers from the nameservers of a zone
+type ZoneTransferer interface {
+	// Transfer looks up the nameservers of zone and attempts AXFR, then IXFR,
+	// against each of their addresses
+	Transfer(zone string) []ZoneTransfer
+}
+
+// ZoneTransfer is a zone transfer attempt and the owner names it yielded
+type ZoneTransfer struct {
+	entity.ZoneTransfer
+	Names []string
+}
+
+// ZoneWalker enumerates DNSSEC-signed zones through their authenticated
+// denial of existence
+type ZoneWalker interface {
+	// Walk follows the NSEC chain of zone, or collects its NSEC3 hashes and
+	// matches them against a wordlist. It returns nil if zone is not signed.
+	Walk(zone string) *ZoneWalk
+}
+
+// ZoneWalk is a zone walk and the names it found
+type ZoneWalk struct {
+	entity.ZoneWalk
+	Names []string
+}
+
+// Wordlist streams candidate subdomain labels for brute forcing
+type Wordlist interface {
+	// Each calls yield with every label in turn until it returns false
+	Each(yield func(label string) bool) error
+}
+
+// PTRSweeper looks up the PTR names of the addresses around discovered IPs
+type PTRSweeper interface {
+	// Sweep looks up every address in the block holding ip. It returns nil
+	// if the block was swept before or should not be swept.
+	Sweep(ip string) *PTRSweep
+}
+
+// PTRSweep is the outcome of a PTR sweep, with the messages of the lookups
+// that found names
+type PTRSweep struct {
+	entity.PTRSweep
+	Messages []*entity.DNSMessage
+}
+
+// Permutator guesses names from the names discovered under each root
+type Permutator interface {
+	// Permute learns the tokens of a name that resolved and returns the new
+	// candidates derived from it, within the root's candidate budget
+	Permute(name, root string) []string
+}
+
+// RateLimiter throttles outgoing requests that share a key
+type RateLimiter interface {
+	// Wait blocks until a request may proceed under the global rate and the
+	// rate of each of its keys, charging every bucket once, and returns the
+	// time spent waiting
+	Wait(keys ...RateKey) time.Duration
+	// WaitKeys blocks like Wait without charging the global rate, for further
+	// attempts of a request that Wait already charged
+	WaitKeys(keys ...RateKey) time.Duration
+	// Throttled returns the total time requests spent waiting
+	Throttled() time.Duration
+}
+
+// RateKey is a key that requests are throttled under
+type RateKey struct {
+	Kind string
+	Key  string
+}
+
+// Rate limit key kinds
+const (
+	RateKeyRoot      = "root"
+	RateKeyIP        = "ip"
+	RateKeyDNSServer = "dns"
+)
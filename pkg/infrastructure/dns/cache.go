@@ -0,0 +1,277 @@
+package dns
+
+import (
+	"container/list"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/miekg/dns"
+)
+
+// CachingResolver implements service.DNSResolver by caching the resolutions
+// of another resolver for as long as their records live. When full, it
+// evicts the least recently used resolution.
+type CachingResolver struct {
+	resolver   service.DNSResolver
+	maxTTL     time.Duration
+	maxEntries int
+	entries    map[string]*list.Element // Of *cacheEntry, most recently used first in lru
+	lru        *list.List
+	inflight   map[string]*inflightCall
+	hits       atomic.Int64
+	coalesced  atomic.Int64
+	misses     atomic.Int64
+	mu         sync.Mutex
+
+	now func() time.Time
+}
+
+// CacheConfig holds DNS cache configuration
+type CacheConfig struct {
+	// MaxTTL caps how long a resolution is cached, whatever its records say
+	MaxTTL time.Duration
+	// MaxEntries is the number of resolutions kept before older ones are evicted
+	MaxEntries int
+}
+
+// cacheEntry is a cached resolution
+type cacheEntry struct {
+	key        string
+	resolution *service.DNSResolution
+	storedAt   time.Time
+	expiresAt  time.Time
+}
+
+// inflightCall is a resolution in progress that concurrent callers wait for
+type inflightCall struct {
+	done       sync.WaitGroup
+	resolution *service.DNSResolution
+	err        error
+}
+
+// NewCachingResolver wraps resolver with a TTL-honoring cache
+func NewCachingResolver(resolver service.DNSResolver, config CacheConfig) *CachingResolver {
+	if config.MaxTTL <= 0 {
+		config.MaxTTL = time.Hour
+	}
+
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 100000
+	}
+
+	return &CachingResolver{
+		resolver:   resolver,
+		maxTTL:     config.MaxTTL,
+		maxEntries: config.MaxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		inflight:   make(map[string]*inflightCall),
+		now:        time.Now,
+	}
+}
+
+// Resolve implements service.DNSResolver
+func (c *CachingResolver) Resolve(domain string) ([]string, error) {
+	resolution, err := c.ResolveWithDetails(domain)
+	if err != nil {
+		return nil, err
+	}
+	return append(resolution.IPs, resolution.IPv6...), nil
+}
+
+// ResolveWithDetails implements service.DNSResolver
+func (c *CachingResolver) ResolveWithDetails(domain string) (*service.DNSResolution, error) {
+	return c.lookup(cacheKey(domain, nil), func() (*service.DNSResolution, error) {
+		return c.resolver.ResolveWithDetails(domain)
+	})
+}
+
+// ResolveTypes implements service.DNSResolver
+func (c *CachingResolver) ResolveTypes(domain string, recordTypes []string) (*service.DNSResolution, error) {
+	return c.lookup(cacheKey(domain, recordTypes), func() (*service.DNSResolution, error) {
+		return c.resolver.ResolveTypes(domain, recordTypes)
+	})
+}
+
+// ServerStats implements service.DNSServerReporter for the wrapped resolver
+func (c *CachingResolver) ServerStats() []entity.DNSServerStats {
+	if reporter, ok := c.resolver.(service.DNSServerReporter); ok {
+		return reporter.ServerStats()
+	}
+	return nil
+}
+
+// CacheStats implements service.DNSCacheReporter
+func (c *CachingResolver) CacheStats() (hits, coalesced, misses int64) {
+	return c.hits.Load(), c.coalesced.Load(), c.misses.Load()
+}
+
+// lookup answers from the cache, or runs resolve once for all concurrent
+// callers with the same key. Only the caller that ran resolve gets the DNS
+// messages; the others did not send any queries.
+func (c *CachingResolver) lookup(key string, resolve func() (*service.DNSResolution, error)) (*service.DNSResolution, error) {
+	c.mu.Lock()
+	now := c.now()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		if now.Before(entry.expiresAt) {
+			c.lru.MoveToFront(element)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return cachedCopy(entry.resolution, now.Sub(entry.storedAt)), nil
+		}
+		c.remove(element)
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		c.coalesced.Add(1)
+		call.done.Wait()
+		return cachedCopy(call.resolution, 0), call.err
+	}
+	call := &inflightCall{}
+	call.done.Add(1)
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+	resolution, err := resolve()
+
+	// Waiters and later hits copy from a snapshot of their own, since the
+	// caller may modify the resolution it gets
+	call.resolution, call.err = cachedCopy(resolution, 0), err
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if ttl, ok := cacheTTL(resolution); ok && err == nil {
+		if ttl > c.maxTTL {
+			ttl = c.maxTTL
+		}
+		now = c.now()
+		if element, ok := c.entries[key]; ok {
+			c.remove(element)
+		}
+		for len(c.entries) >= c.maxEntries {
+			c.remove(c.lru.Back())
+		}
+		c.entries[key] = c.lru.PushFront(&cacheEntry{
+			key:        key,
+			resolution: call.resolution,
+			storedAt:   now,
+			expiresAt:  now.Add(ttl),
+		})
+	}
+	c.mu.Unlock()
+	call.done.Done()
+
+	return resolution, err
+}
+
+// remove drops a cached resolution
+func (c *CachingResolver) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+// cacheKey identifies a lookup of the given record types; nil means the
+// resolver's defaults
+func cacheKey(domain string, recordTypes []string) string {
+	return strings.ToLower(trimDot(strings.TrimSpace(domain))) + " " + strings.ToUpper(strings.Join(recordTypes, ","))
+}
+
+// cacheTTL returns how long a resolution may be cached: the smallest TTL of
+// its answers, or for names without data the negative TTL of RFC 2308. Failed
+// queries and negative answers without an SOA are not cached.
+func cacheTTL(resolution *service.DNSResolution) (time.Duration, bool) {
+	if resolution == nil || len(resolution.Messages) == 0 {
+		return 0, false
+	}
+
+	ttl := uint32(math.MaxUint32)
+	for _, message := range resolution.Messages {
+		response := message.Response
+		if response == nil {
+			return 0, false
+		}
+
+		var messageTTL uint32
+		var ok bool
+		switch {
+		case response.Rcode == dns.RcodeSuccess && len(response.Answer) > 0:
+			messageTTL, ok = answerTTL(response.Answer), true
+		case response.Rcode == dns.RcodeSuccess || response.Rcode == dns.RcodeNameError:
+			messageTTL, ok = negativeTTL(response.Nv)
+		}
+		if !ok {
+			return 0, false
+		}
+		ttl = min(ttl, messageTTL)
+	}
+
+	if ttl == 0 {
+		return 0, false
+	}
+	return time.Duration(ttl) * time.Second, true
+}
+
+// answerTTL returns the smallest TTL of the records of an answer section
+func answerTTL(answer []entity.DNSRR) uint32 {
+	ttl := uint32(math.MaxUint32)
+	for _, rr := range answer {
+		ttl = min(ttl, rr.TTL)
+	}
+	return ttl
+}
+
+// negativeTTL returns the lesser of the TTL and the MINIMUM field of the SOA
+// in an authority section (RFC 2308, section 5)
+func negativeTTL(authority []entity.DNSRR) (uint32, bool) {
+	for _, rr := range authority {
+		if rr.Type != "SOA" {
+			continue
+		}
+		parsed, err := dns.NewRR(rr.Data)
+		if err != nil {
+			continue
+		}
+		if soa, ok := parsed.(*dns.SOA); ok {
+			return min(rr.TTL, soa.Minttl), true
+		}
+	}
+	return 0, false
+}
+
+// cachedCopy returns a resolution served without sending queries, with the
+// TTLs of its records reduced by the time they spent in the cache
+func cachedCopy(resolution *service.DNSResolution, age time.Duration) *service.DNSResolution {
+	if resolution == nil {
+		return nil
+	}
+
+	// Callers may append to the slices of a hit; they must not write into
+	// the cached entry
+	cached := *resolution
+	cached.IPs = slices.Clone(resolution.IPs)
+	cached.IPv6 = slices.Clone(resolution.IPv6)
+	cached.CNAMEs = slices.Clone(resolution.CNAMEs)
+	cached.MX = slices.Clone(resolution.MX)
+	cached.NS = slices.Clone(resolution.NS)
+	cached.TXT = slices.Clone(resolution.TXT)
+	cached.Delegations = slices.Clone(resolution.Delegations)
+	cached.Messages = nil
+	cached.Retries = 0
+	cached.RTTMs = 0
+
+	elapsed := uint32(age / time.Second)
+	cached.Records = make([]service.DNSRecord, len(resolution.Records))
+	for i, record := range resolution.Records {
+		record.TTL -= min(record.TTL, elapsed)
+		cached.Records[i] = record
+	}
+	return &cached
+}
@@ -0,0 +1,233 @@
+package dns
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/miekg/dns"
+)
+
+// stubResolver answers every query with a copy of a fixed resolution
+type stubResolver struct {
+	resolution service.DNSResolution
+	queries    atomic.Int64
+	// release, if set, blocks queries until closed
+	release chan struct{}
+}
+
+func (s *stubResolver) Resolve(domain string) ([]string, error) {
+	resolution, err := s.ResolveWithDetails(domain)
+	if err != nil {
+		return nil, err
+	}
+	return resolution.IPs, nil
+}
+
+func (s *stubResolver) ResolveWithDetails(domain string) (*service.DNSResolution, error) {
+	return s.ResolveTypes(domain, DefaultRecordTypes)
+}
+
+func (s *stubResolver) ResolveTypes(domain string, recordTypes []string) (*service.DNSResolution, error) {
+	s.queries.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	resolution := s.resolution
+	resolution.Domain = domain
+	return &resolution, nil
+}
+
+// answered builds a resolution whose single response has the given rcode and sections
+func answered(rcode int, answer, authority []entity.DNSRR) service.DNSResolution {
+	return service.DNSResolution{
+		IPs:     []string{"93.184.216.34"},
+		Records: []service.DNSRecord{{Name: "example.com", Type: "A", Value: "93.184.216.34", TTL: 300}},
+		Messages: []*entity.DNSMessage{{
+			Response: &entity.DNSDetail{Rcode: rcode, Answer: answer, Nv: authority},
+		}},
+	}
+}
+
+var (
+	answerA = []entity.DNSRR{{Name: "example.com.", Type: "A", TTL: 300}}
+	soa     = []entity.DNSRR{{
+		Name: "example.com.", Type: "SOA", TTL: 3600,
+		Data: "example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 1 7200 3600 1209600 60",
+	}}
+)
+
+func TestCachingResolver_TTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution service.DNSResolution
+		wantTTL    time.Duration
+		cached     bool
+	}{
+		{"answer", answered(dns.RcodeSuccess, answerA, nil), 300 * time.Second, true},
+		{"nxdomain uses soa minimum", answered(dns.RcodeNameError, nil, soa), 60 * time.Second, true},
+		{"nodata uses soa minimum", answered(dns.RcodeSuccess, nil, soa), 60 * time.Second, true},
+		{"nxdomain without soa", answered(dns.RcodeNameError, nil, nil), 0, false},
+		{"servfail", answered(dns.RcodeServerFailure, nil, soa), 0, false},
+		{"no response", service.DNSResolution{Messages: []*entity.DNSMessage{{}}}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			stub := &stubResolver{resolution: tt.resolution}
+			cache := NewCachingResolver(stub, CacheConfig{})
+			cache.now = func() time.Time { return now }
+
+			cache.ResolveWithDetails("example.com")
+			now = now.Add(tt.wantTTL - time.Second)
+			cache.ResolveWithDetails("example.com")
+
+			wantQueries := int64(1)
+			if !tt.cached {
+				wantQueries = 2
+			}
+			if got := stub.queries.Load(); got != wantQueries {
+				t.Fatalf("queries before expiry = %d, want %d", got, wantQueries)
+			}
+
+			if tt.cached {
+				now = now.Add(time.Second)
+				cache.ResolveWithDetails("example.com")
+				if got := stub.queries.Load(); got != 2 {
+					t.Errorf("queries after expiry = %d, want 2", got)
+				}
+			}
+		})
+	}
+}
+
+func TestCachingResolver_Hit(t *testing.T) {
+	now := time.Unix(0, 0)
+	stub := &stubResolver{resolution: answered(dns.RcodeSuccess, answerA, nil)}
+	cache := NewCachingResolver(stub, CacheConfig{MaxTTL: time.Minute})
+	cache.now = func() time.Time { return now }
+
+	first, _ := cache.ResolveTypes("Example.com.", []string{"A"})
+	now = now.Add(10 * time.Second)
+	second, _ := cache.ResolveTypes("example.com", []string{"a"})
+
+	if len(first.Messages) != 1 || len(second.Messages) != 0 {
+		t.Errorf("Messages = %d then %d, want 1 then 0", len(first.Messages), len(second.Messages))
+	}
+	if second.Records[0].TTL != 290 {
+		t.Errorf("cached TTL = %d, want 290", second.Records[0].TTL)
+	}
+
+	// Other record types are separate lookups
+	cache.ResolveTypes("example.com", []string{"MX"})
+	if hits, coalesced, misses := cache.CacheStats(); hits != 1 || coalesced != 0 || misses != 2 {
+		t.Errorf("CacheStats() = %d, %d, %d, want 1, 0, 2", hits, coalesced, misses)
+	}
+
+	// MaxTTL caps the 300s answer TTL
+	now = now.Add(time.Minute)
+	cache.ResolveTypes("example.com", []string{"A"})
+	if got := stub.queries.Load(); got != 3 {
+		t.Errorf("queries after max TTL = %d, want 3", got)
+	}
+}
+
+func TestCachingResolver_HitCopies(t *testing.T) {
+	// Spare capacity lets an append write past the end without reallocating
+	resolution := answered(dns.RcodeSuccess, answerA, nil)
+	resolution.IPs = append(make([]string, 0, 4), resolution.IPs...)
+	stub := &stubResolver{resolution: resolution}
+	cache := NewCachingResolver(stub, CacheConfig{MaxTTL: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		got, _ := cache.ResolveTypes("example.com", []string{"A"})
+		if len(got.IPs) != 1 || got.IPs[0] != "93.184.216.34" {
+			t.Fatalf("ResolveTypes() #%d IPs = %v, want [93.184.216.34]", i, got.IPs)
+		}
+		got.IPs = append(got.IPs, "192.0.2.1")
+		got.IPs[0] = "192.0.2.2"
+	}
+}
+
+func TestCachingResolver_Singleflight(t *testing.T) {
+	stub := &stubResolver{
+		resolution: answered(dns.RcodeSuccess, answerA, nil),
+		release:    make(chan struct{}),
+	}
+	cache := NewCachingResolver(stub, CacheConfig{})
+
+	const callers = 8
+	var wg sync.WaitGroup
+	var withMessages atomic.Int64
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resolution, err := cache.ResolveWithDetails("example.com")
+			if err != nil || len(resolution.IPs) != 1 {
+				t.Errorf("ResolveWithDetails() = %+v, %v", resolution, err)
+				return
+			}
+			withMessages.Add(int64(len(resolution.Messages)))
+		}()
+	}
+
+	// Let every caller reach the cache before the query completes
+	for {
+		cache.mu.Lock()
+		waiting := len(cache.inflight) == 1
+		cache.mu.Unlock()
+		if waiting && stub.queries.Load() == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(stub.release)
+	wg.Wait()
+
+	if got := stub.queries.Load(); got != 1 {
+		t.Errorf("queries = %d, want 1", got)
+	}
+	// Only the caller that sent the query logs its messages
+	if got := withMessages.Load(); got != 1 {
+		t.Errorf("messages returned = %d, want 1", got)
+	}
+	// Waiting for the query is not a cache hit
+	if hits, coalesced, misses := cache.CacheStats(); hits != 0 || coalesced != callers-1 || misses != 1 {
+		t.Errorf("CacheStats() = %d, %d, %d, want 0, %d, 1", hits, coalesced, misses, callers-1)
+	}
+}
+
+func TestCachingResolver_EvictLeastRecentlyUsed(t *testing.T) {
+	stub := &stubResolver{resolution: answered(dns.RcodeSuccess, answerA, nil)}
+	cache := NewCachingResolver(stub, CacheConfig{MaxEntries: 2})
+
+	cache.ResolveWithDetails("a.example.com")
+	cache.ResolveWithDetails("b.example.com")
+	cache.ResolveWithDetails("a.example.com") // a is now more recent than b
+	cache.ResolveWithDetails("c.example.com") // evicts b
+
+	tests := []struct {
+		domain string
+		cached bool
+	}{
+		{"a.example.com", true},
+		{"c.example.com", true},
+		{"b.example.com", false},
+	}
+	for _, tt := range tests {
+		before := stub.queries.Load()
+		cache.ResolveWithDetails(tt.domain)
+		if cached := stub.queries.Load() == before; cached != tt.cached {
+			t.Errorf("ResolveWithDetails(%s) cached = %v, want %v", tt.domain, cached, tt.cached)
+		}
+	}
+	if len(cache.entries) != 2 || cache.lru.Len() != 2 {
+		t.Errorf("cache holds %d entries, %d in LRU order, want 2", len(cache.entries), cache.lru.Len())
+	}
+}
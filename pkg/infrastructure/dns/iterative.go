@@ -0,0 +1,499 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/retry"
+	"github.com/miekg/dns"
+)
+
+// maxReferrals bounds the number of zone cuts followed per lookup
+const maxReferrals = 16
+
+// maxGluelessDepth bounds nested lookups of nameserver addresses missing glue
+const maxGluelessDepth = 3
+
+// maxDelegations bounds the zone cuts cached, and maxDelegationTTL how long
+// each is cached, whatever its NS and glue records say
+const (
+	maxDelegations   = 10000
+	maxDelegationTTL = time.Hour
+)
+
+// DefaultRootHints are the IPv4 addresses of the root servers a to m
+var DefaultRootHints = []string{
+	"198.41.0.4",
+	"170.247.170.2",
+	"192.33.4.12",
+	"199.7.91.13",
+	"192.203.230.10",
+	"192.5.5.241",
+	"192.112.36.4",
+	"198.97.190.53",
+	"192.36.148.17",
+	"192.58.128.30",
+	"193.0.14.129",
+	"199.7.83.42",
+	"202.12.27.33",
+}
+
+// IterativeResolver implements service.DNSResolver by walking from the root
+// servers down to the authoritative nameservers of each name, without
+// relying on recursive resolvers
+type IterativeResolver struct {
+	root        zoneCut
+	port        string
+	timeout     time.Duration
+	recordTypes []string
+	limiter     service.RateLimiter
+	retry       service.RetryPolicy
+	udp         *dns.Client
+	tcp         *dns.Client
+	pinnedRoots []string
+	pinned      map[string]zoneCut        // Zone cuts of the pinned roots, once found
+	delegations map[string]cachedCutEntry // Zone cuts learned from referrals, until they expire
+	mu          sync.Mutex
+
+	ednsBufferSize uint16
+}
+
+// IterativeConfig holds iterative resolver configuration
+type IterativeConfig struct {
+	// RootHints are the addresses of the root servers
+	RootHints []string
+	// Port is the port nameservers learned from referrals listen on
+	Port        string
+	Timeout     time.Duration
+	RecordTypes []string
+	// Limiter throttles queries per nameserver; nil disables throttling
+	Limiter service.RateLimiter
+	// Retry decides which failed queries are retried against the same
+	// nameserver before the next one is tried; nil disables retries
+	Retry service.RetryPolicy
+	// PinnedRoots are root domains whose authoritative nameservers are
+	// queried directly once found, instead of walking from the root again
+	PinnedRoots []string
+	// EDNSBufferSize advertises EDNS0 with this UDP payload size; 0 disables EDNS0
+	EDNSBufferSize uint16
+}
+
+// zoneCut is a zone and the addresses of its nameservers
+type zoneCut struct {
+	zone        string
+	nameservers []string
+	addrs       []string
+	ttl         uint32 // Smallest TTL of the NS and glue records
+}
+
+// cachedCutEntry is a zone cut learned from a referral
+type cachedCutEntry struct {
+	cut     zoneCut
+	expires time.Time
+}
+
+// trace collects the queries and zone cuts of a single lookup
+type trace struct {
+	messages    []*entity.DNSMessage
+	delegations []entity.Delegation
+}
+
+// NewIterativeResolver creates a new iterative DNS resolver
+func NewIterativeResolver(config IterativeConfig) *IterativeResolver {
+	if len(config.RootHints) == 0 {
+		config.RootHints = DefaultRootHints
+	}
+
+	if config.Port == "" {
+		config.Port = "53"
+	}
+
+	if len(config.RecordTypes) == 0 {
+		config.RecordTypes = DefaultRecordTypes
+	}
+
+	root := zoneCut{zone: "."}
+	for _, hint := range config.RootHints {
+		root.nameservers = append(root.nameservers, hint)
+		root.addrs = append(root.addrs, withDefaultPort(hint, config.Port))
+	}
+
+	pinnedRoots := make([]string, 0, len(config.PinnedRoots))
+	for _, pinned := range config.PinnedRoots {
+		pinnedRoots = append(pinnedRoots, dns.Fqdn(trimDot(pinned)))
+	}
+
+	return &IterativeResolver{
+		root:        root,
+		port:        config.Port,
+		timeout:     config.Timeout,
+		recordTypes: config.RecordTypes,
+		limiter:     config.Limiter,
+		retry:       config.Retry,
+		udp:         &dns.Client{Net: "udp", Timeout: config.Timeout},
+		tcp:         &dns.Client{Net: "tcp", Timeout: config.Timeout},
+		pinnedRoots: pinnedRoots,
+		pinned:      make(map[string]zoneCut),
+		delegations: make(map[string]cachedCutEntry),
+
+		ednsBufferSize: config.EDNSBufferSize,
+	}
+}
+
+// Resolve implements service.DNSResolver
+func (r *IterativeResolver) Resolve(domain string) ([]string, error) {
+	resolution, err := r.ResolveWithDetails(domain)
+	if err != nil {
+		return nil, err
+	}
+	return append(resolution.IPs, resolution.IPv6...), nil
+}
+
+// ResolveWithDetails implements service.DNSResolver
+func (r *IterativeResolver) ResolveWithDetails(domain string) (*service.DNSResolution, error) {
+	return r.ResolveTypes(domain, r.recordTypes)
+}
+
+// ResolveTypes implements service.DNSResolver
+func (r *IterativeResolver) ResolveTypes(domain string, recordTypes []string) (*service.DNSResolution, error) {
+	requestAt := time.Now()
+
+	resolution := &service.DNSResolution{
+		Domain:    domain,
+		RequestAt: requestAt.UnixMilli(),
+	}
+
+	var lastErr error
+	answered := 0
+
+	for _, recordType := range recordTypes {
+		qtype, ok := dns.StringToType[strings.ToUpper(recordType)]
+		if !ok {
+			lastErr = fmt.Errorf("unsupported record type: %s", recordType)
+			continue
+		}
+
+		name := domain
+		for hop := 0; hop <= maxCNAMEChain; hop++ {
+			t := &trace{}
+			msg, response, err := r.iterate(name, qtype, t, 0)
+			resolution.Messages = append(resolution.Messages, t.messages...)
+			for _, message := range t.messages {
+				resolution.RTTMs += message.RTT
+				resolution.Retries += message.Tries - 1
+			}
+			if resolution.Delegations == nil {
+				resolution.Delegations = t.delegations
+			}
+
+			if err != nil {
+				lastErr = err
+				break
+			}
+
+			answered++
+			if resolution.Server == "" {
+				resolution.Server = t.delegations[len(t.delegations)-1].Server
+				resolution.Rcode = dns.RcodeToString[response.Rcode]
+				resolution.RawRequest = msg.String()
+				resolution.RawResponse = response.String()
+			}
+
+			// Follow the CNAME chain if the answer stops short of the target type
+			target, found := collectAnswers(resolution, name, qtype, response)
+			if found || target == trimDot(name) || qtype == dns.TypeCNAME {
+				break
+			}
+			name = target
+		}
+	}
+
+	resolution.ResponseAt = time.Now().UnixMilli()
+
+	if answered == 0 {
+		errMsg := "no response from any nameserver"
+		if lastErr != nil {
+			errMsg = lastErr.Error()
+		}
+		resolution.Error = errMsg
+		return resolution, fmt.Errorf("%s", errMsg)
+	}
+
+	return resolution, nil
+}
+
+// iterate follows referrals from the closest known zone cut down to the
+// authoritative answer for name. Glueless lookups of nameserver addresses
+// nest up to maxGluelessDepth deep.
+func (r *IterativeResolver) iterate(name string, qtype uint16, t *trace, depth int) (*dns.Msg, *dns.Msg, error) {
+	name = dns.Fqdn(strings.ToLower(name))
+	cut := r.startingCut(name)
+
+	for hop := 0; hop < maxReferrals; hop++ {
+		msg, response, server, err := r.queryCut(cut, name, qtype, t)
+		t.delegations = append(t.delegations, entity.Delegation{
+			Zone:        cut.zone,
+			Nameservers: cut.nameservers,
+			Server:      server,
+		})
+		if err != nil {
+			// A pinned or cached zone cut whose nameservers stopped answering is
+			// walked down to again from the root
+			if hop == 0 && r.forget(cut) {
+				cut = r.root
+				continue
+			}
+			return msg, nil, err
+		}
+
+		next, ok := referral(response, name, cut.zone)
+		if !ok {
+			return msg, response, nil
+		}
+
+		next.addrs, next.ttl = r.glue(response, next)
+		if len(next.addrs) == 0 && depth < maxGluelessDepth {
+			next.addrs = r.lookupAddrs(next.nameservers, t, depth+1)
+		}
+		if len(next.addrs) == 0 {
+			return msg, nil, fmt.Errorf("no addresses for the nameservers of %s", next.zone)
+		}
+
+		r.remember(next)
+		cut = next
+	}
+
+	return nil, nil, fmt.Errorf("too many referrals resolving %s", name)
+}
+
+// startingCut returns the closest zone cut known above name: a pinned root
+// or a cached referral that has not expired, and the root zone otherwise
+func (r *IterativeResolver) startingCut(name string) zoneCut {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, offset := range dns.Split(name) {
+		zone := name[offset:]
+		if cut, ok := r.pinned[zone]; ok {
+			return cut
+		}
+		if entry, ok := r.delegations[zone]; ok {
+			if now.Before(entry.expires) {
+				return entry.cut
+			}
+			delete(r.delegations, zone)
+		}
+	}
+	return r.root
+}
+
+// remember pins the zone cut of a pinned root, and caches any other for the
+// TTL of its records
+func (r *IterativeResolver) remember(cut zoneCut) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, root := range r.pinnedRoots {
+		if strings.EqualFold(root, cut.zone) {
+			r.pinned[root] = cut
+			return
+		}
+	}
+
+	if cut.ttl == 0 {
+		return
+	}
+	now := time.Now()
+	if len(r.delegations) >= maxDelegations {
+		for zone, entry := range r.delegations {
+			if !now.Before(entry.expires) {
+				delete(r.delegations, zone)
+			}
+		}
+		if len(r.delegations) >= maxDelegations {
+			return
+		}
+	}
+	ttl := min(time.Duration(cut.ttl)*time.Second, maxDelegationTTL)
+	r.delegations[cut.zone] = cachedCutEntry{cut: cut, expires: now.Add(ttl)}
+}
+
+// forget drops a pinned or cached zone cut, reporting whether it was known.
+// A pinned root is pinned again the next time a walk from the root reaches it.
+func (r *IterativeResolver) forget(cut zoneCut) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.pinned[cut.zone]; ok {
+		delete(r.pinned, cut.zone)
+		return true
+	}
+	if _, ok := r.delegations[cut.zone]; !ok {
+		return false
+	}
+	delete(r.delegations, cut.zone)
+	return true
+}
+
+// queryCut asks the nameservers of a zone cut in turn until one answers.
+// It returns the query, the response and the address of the server that sent it.
+func (r *IterativeResolver) queryCut(cut zoneCut, name string, qtype uint16, t *trace) (*dns.Msg, *dns.Msg, string, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.RecursionDesired = false
+	if r.ednsBufferSize > 0 {
+		msg.SetEdns0(r.ednsBufferSize, false)
+	}
+
+	err := fmt.Errorf("no nameservers for %s", cut.zone)
+	for _, addr := range cut.addrs {
+		reply := r.query(addr, msg)
+
+		dnsMsg := &entity.DNSMessage{
+			Domain:      trimDot(name),
+			Server:      addr,
+			Transport:   reply.transport,
+			Request:     toDNSDetail(msg),
+			Response:    toDNSDetail(reply.response),
+			RTT:         reply.rtt.Milliseconds(),
+			Tries:       reply.tries,
+			TCPFallback: reply.tcpFallback,
+		}
+		if reply.err != nil {
+			dnsMsg.Error = reply.err.Error()
+		}
+		t.messages = append(t.messages, dnsMsg)
+
+		switch {
+		case reply.err != nil:
+			err = reply.err
+		case reply.response.Rcode == dns.RcodeServerFailure || reply.response.Rcode == dns.RcodeRefused:
+			// Lame or broken nameserver; try the next one
+			err = fmt.Errorf("%s answered %s", addr, dns.RcodeToString[reply.response.Rcode])
+		default:
+			return msg, reply.response, addr, nil
+		}
+	}
+	return msg, nil, "", err
+}
+
+// query sends msg to a nameserver, retrying timeouts and SERVFAIL answers
+// per the retry policy. The reply records the number of tries made.
+func (r *IterativeResolver) query(addr string, msg *dns.Msg) reply {
+	transport := &clientTransport{name: "udp", client: r.udp, fallback: r.tcp, addr: addr}
+	for try := 1; ; try++ {
+		if r.limiter != nil {
+			r.limiter.Wait(service.RateKey{Kind: service.RateKeyDNSServer, Key: addr})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		reply := transport.exchange(ctx, msg)
+		cancel()
+		reply.tries = try
+
+		var errorClass string
+		if reply.err != nil {
+			errorClass = retry.Classify(reply.err)
+		} else {
+			errorClass = retry.ClassifyRcode(reply.response.Rcode)
+		}
+		if r.retry == nil || errorClass == "" {
+			return reply
+		}
+
+		delay, ok := r.retry.Backoff(try, errorClass, 0)
+		if !ok {
+			return reply
+		}
+		time.Sleep(delay)
+	}
+}
+
+// referral returns the zone cut a non-authoritative response delegates name
+// to, if it is below the zone that was queried
+func referral(response *dns.Msg, name, zone string) (zoneCut, bool) {
+	if response.Rcode != dns.RcodeSuccess || response.Authoritative || len(response.Answer) > 0 {
+		return zoneCut{}, false
+	}
+
+	var next zoneCut
+	for _, rr := range response.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		owner := strings.ToLower(ns.Hdr.Name)
+		if !dns.IsSubDomain(owner, name) || !dns.IsSubDomain(zone, owner) || owner == strings.ToLower(zone) {
+			continue
+		}
+		if next.zone == "" {
+			next.zone = owner
+			next.ttl = ns.Hdr.Ttl
+		}
+		if owner == next.zone {
+			next.nameservers = appendUnique(next.nameservers, strings.ToLower(ns.Ns))
+			next.ttl = min(next.ttl, ns.Hdr.Ttl)
+		}
+	}
+	return next, next.zone != ""
+}
+
+// glue returns the addresses the additional section gives for the
+// nameservers of cut, IPv4 first, and the smallest TTL of those records and
+// the cut's
+func (r *IterativeResolver) glue(response *dns.Msg, cut zoneCut) ([]string, uint32) {
+	var ipv4, ipv6 []string
+	ttl := cut.ttl
+	for _, rr := range response.Extra {
+		if !containsString(cut.nameservers, strings.ToLower(rr.Header().Name)) {
+			continue
+		}
+		switch record := rr.(type) {
+		case *dns.A:
+			ipv4 = appendUnique(ipv4, net.JoinHostPort(record.A.String(), r.port))
+		case *dns.AAAA:
+			ipv6 = appendUnique(ipv6, net.JoinHostPort(record.AAAA.String(), r.port))
+		default:
+			continue
+		}
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+	return append(ipv4, ipv6...), ttl
+}
+
+// lookupAddrs resolves the addresses of nameservers given without glue,
+// IPv4 and then IPv6, stopping at the first nameserver that has any
+func (r *IterativeResolver) lookupAddrs(nameservers []string, t *trace, depth int) []string {
+	for _, nameserver := range nameservers {
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			// The queries are logged, but the walk is not part of the delegation path
+			nested := &trace{}
+			_, response, err := r.iterate(nameserver, qtype, nested, depth)
+			t.messages = append(t.messages, nested.messages...)
+			if err != nil {
+				continue
+			}
+
+			var addrs []string
+			for _, rr := range response.Answer {
+				switch record := rr.(type) {
+				case *dns.A:
+					addrs = appendUnique(addrs, net.JoinHostPort(record.A.String(), r.port))
+				case *dns.AAAA:
+					addrs = appendUnique(addrs, net.JoinHostPort(record.AAAA.String(), r.port))
+				}
+			}
+			if len(addrs) > 0 {
+				return addrs
+			}
+		}
+	}
+	return nil
+}
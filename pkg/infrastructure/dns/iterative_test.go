@@ -0,0 +1,333 @@
+package dns
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/retry"
+	"github.com/miekg/dns"
+)
+
+// fakeNameserver answers authoritatively from records, keyed by "name. TYPE",
+// and refers names under delegated zones to the NS and glue records given
+type fakeNameserver struct {
+	records   map[string][]string
+	referrals map[string][]string
+	queries   atomic.Int64
+	// servFails is the number of queries answered SERVFAIL first
+	servFails int64
+}
+
+func (f *fakeNameserver) handler(t *testing.T) dns.HandlerFunc {
+	t.Helper()
+
+	parse := func(values []string) []dns.RR {
+		var rrs []dns.RR
+		for _, value := range values {
+			rr, err := dns.NewRR(value)
+			if err != nil {
+				t.Fatalf("Failed to parse test record %q: %v", value, err)
+			}
+			rrs = append(rrs, rr)
+		}
+		return rrs
+	}
+	records := make(map[string][]dns.RR)
+	for key, values := range f.records {
+		records[key] = parse(values)
+	}
+	referrals := make(map[string][]dns.RR)
+	for zone, values := range f.referrals {
+		referrals[zone] = parse(values)
+	}
+
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		if f.queries.Add(1) <= f.servFails {
+			resp.Rcode = dns.RcodeServerFailure
+			w.WriteMsg(resp)
+			return
+		}
+
+		for zone, rrs := range referrals {
+			if !dns.IsSubDomain(zone, q.Name) {
+				continue
+			}
+			for _, rr := range rrs {
+				if rr.Header().Rrtype == dns.TypeNS {
+					resp.Ns = append(resp.Ns, rr)
+				} else {
+					resp.Extra = append(resp.Extra, rr)
+				}
+			}
+			w.WriteMsg(resp)
+			return
+		}
+
+		resp.Authoritative = true
+		resp.Answer = records[q.Name+" "+dns.TypeToString[q.Qtype]]
+		if len(resp.Answer) == 0 {
+			resp.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(resp)
+	}
+}
+
+// startHierarchy serves the nameservers on consecutive loopback addresses,
+// starting at 127.0.0.1, all on the same port, which it returns
+func startHierarchy(t *testing.T, nameservers ...*fakeNameserver) string {
+	t.Helper()
+
+	port := "0"
+	for i, nameserver := range nameservers {
+		conn, err := net.ListenPacket("udp", net.JoinHostPort(net.IPv4(127, 0, 0, byte(i+1)).String(), port))
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		_, port, _ = net.SplitHostPort(conn.LocalAddr().String())
+
+		server := &dns.Server{PacketConn: conn, Handler: nameserver.handler(t)}
+		go server.ActivateAndServe()
+		t.Cleanup(func() { server.Shutdown() })
+	}
+	return port
+}
+
+// testHierarchy returns a root, a TLD server for com and org, and the
+// authoritative server of example.com and example.org. The nameserver of
+// example.org has no glue.
+func testHierarchy() (root, tld, auth *fakeNameserver) {
+	root = &fakeNameserver{referrals: map[string][]string{
+		"com.": {"com. 172800 IN NS a.gtld.test.", "a.gtld.test. 172800 IN A 127.0.0.2"},
+		"org.": {"org. 172800 IN NS a.gtld.test.", "a.gtld.test. 172800 IN A 127.0.0.2"},
+	}}
+	tld = &fakeNameserver{referrals: map[string][]string{
+		"example.com.": {"example.com. 172800 IN NS ns1.example.com.", "ns1.example.com. 172800 IN A 127.0.0.3"},
+		"example.org.": {"example.org. 172800 IN NS ns1.example.com."},
+	}}
+	auth = &fakeNameserver{records: map[string][]string{
+		"www.example.com. A": {"www.example.com. 300 IN A 93.184.216.34"},
+		"ns1.example.com. A": {"ns1.example.com. 300 IN A 127.0.0.3"},
+		"www.example.org. A": {"www.example.org. 300 IN A 93.184.216.35"},
+	}}
+	return root, tld, auth
+}
+
+func TestIterativeResolver_Walk(t *testing.T) {
+	root, tld, auth := testHierarchy()
+	port := startHierarchy(t, root, tld, auth)
+
+	resolver := NewIterativeResolver(IterativeConfig{
+		RootHints: []string{"127.0.0.1"},
+		Port:      port,
+		Timeout:   2 * time.Second,
+	})
+
+	resolution, err := resolver.ResolveTypes("www.example.com", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+	if len(resolution.IPs) != 1 || resolution.IPs[0] != "93.184.216.34" {
+		t.Errorf("ResolveTypes().IPs = %v, want [93.184.216.34]", resolution.IPs)
+	}
+
+	wantPath := []struct{ zone, server string }{
+		{".", "127.0.0.1"},
+		{"com.", "127.0.0.2"},
+		{"example.com.", "127.0.0.3"},
+	}
+	if len(resolution.Delegations) != len(wantPath) {
+		t.Fatalf("Delegations = %+v, want %d zone cuts", resolution.Delegations, len(wantPath))
+	}
+	for i, want := range wantPath {
+		got := resolution.Delegations[i]
+		if got.Zone != want.zone || got.Server != net.JoinHostPort(want.server, port) {
+			t.Errorf("Delegations[%d] = %+v, want zone %s from %s", i, got, want.zone, want.server)
+		}
+	}
+	if resolution.Server != net.JoinHostPort("127.0.0.3", port) {
+		t.Errorf("Server = %s, want the authoritative nameserver", resolution.Server)
+	}
+
+	// Names that do not exist are answered by the authoritative nameserver too
+	resolution, err = resolver.ResolveTypes("missing.example.com", []string{"A"})
+	if err != nil || resolution.Rcode != "NXDOMAIN" {
+		t.Errorf("ResolveTypes(missing.example.com) = %s, %v, want NXDOMAIN", resolution.Rcode, err)
+	}
+}
+
+func TestIterativeResolver_Glueless(t *testing.T) {
+	root, tld, auth := testHierarchy()
+	port := startHierarchy(t, root, tld, auth)
+
+	resolver := NewIterativeResolver(IterativeConfig{
+		RootHints: []string{"127.0.0.1"},
+		Port:      port,
+		Timeout:   2 * time.Second,
+	})
+
+	resolution, err := resolver.ResolveTypes("www.example.org", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+	if len(resolution.IPs) != 1 || resolution.IPs[0] != "93.184.216.35" {
+		t.Errorf("ResolveTypes().IPs = %v, want [93.184.216.35]", resolution.IPs)
+	}
+
+	// Two queries to find example.org's nameserver, three to resolve its address, one answer
+	if len(resolution.Messages) != 6 {
+		t.Errorf("Messages = %d, want 6", len(resolution.Messages))
+	}
+	if len(resolution.Delegations) != 3 || resolution.Delegations[2].Zone != "example.org." {
+		t.Errorf("Delegations = %+v, want ., org. and example.org.", resolution.Delegations)
+	}
+}
+
+func TestIterativeResolver_Pinned(t *testing.T) {
+	root, tld, auth := testHierarchy()
+	port := startHierarchy(t, root, tld, auth)
+
+	resolver := NewIterativeResolver(IterativeConfig{
+		RootHints:   []string{"127.0.0.1"},
+		Port:        port,
+		Timeout:     2 * time.Second,
+		PinnedRoots: []string{"example.com"},
+	})
+
+	if _, err := resolver.ResolveTypes("www.example.com", []string{"A"}); err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+
+	// Later lookups under the pinned root go straight to its nameservers
+	resolution, err := resolver.ResolveTypes("www.example.com", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+	if len(resolution.Delegations) != 1 || resolution.Delegations[0].Zone != "example.com." {
+		t.Errorf("Delegations = %+v, want only example.com.", resolution.Delegations)
+	}
+	if root.queries.Load() != 1 || tld.queries.Load() != 1 {
+		t.Errorf("root and TLD queries = %d and %d, want 1 and 1", root.queries.Load(), tld.queries.Load())
+	}
+
+	// Other names still walk from the root
+	resolver.ResolveTypes("www.example.org", []string{"A"})
+	if root.queries.Load() != 2 {
+		t.Errorf("root queries = %d, want 2", root.queries.Load())
+	}
+
+	// A pinned cut whose nameservers stopped answering is dropped and
+	// pinned again from a walk from the root
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	dead := conn.LocalAddr().String()
+	conn.Close()
+	resolver.pinned["example.com."] = zoneCut{zone: "example.com.", nameservers: []string{"ns1.example.com."}, addrs: []string{dead}}
+
+	resolution, err = resolver.ResolveTypes("www.example.com", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() with a dead pinned cut error = %v", err)
+	}
+	if len(resolution.IPs) != 1 || resolution.IPs[0] != "93.184.216.34" {
+		t.Errorf("ResolveTypes().IPs = %v, want [93.184.216.34]", resolution.IPs)
+	}
+	if root.queries.Load() != 3 {
+		t.Errorf("root queries = %d, want 3", root.queries.Load())
+	}
+	if addrs := resolver.pinned["example.com."].addrs; len(addrs) != 1 || addrs[0] != net.JoinHostPort("127.0.0.3", port) {
+		t.Errorf("Pinned example.com. addrs = %v, want the authoritative nameserver", addrs)
+	}
+}
+
+func TestIterativeResolver_DelegationCache(t *testing.T) {
+	root, tld, auth := testHierarchy()
+	auth.records["mail.example.com. A"] = []string{"mail.example.com. 300 IN A 93.184.216.36"}
+	port := startHierarchy(t, root, tld, auth)
+
+	resolver := NewIterativeResolver(IterativeConfig{
+		RootHints: []string{"127.0.0.1"},
+		Port:      port,
+		Timeout:   2 * time.Second,
+	})
+
+	if _, err := resolver.ResolveTypes("www.example.com", []string{"A"}); err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+
+	// The zone cut of example.com is cached for the TTL of its records
+	resolution, err := resolver.ResolveTypes("mail.example.com", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+	if len(resolution.IPs) != 1 || resolution.IPs[0] != "93.184.216.36" {
+		t.Errorf("ResolveTypes().IPs = %v, want [93.184.216.36]", resolution.IPs)
+	}
+	if len(resolution.Delegations) != 1 || resolution.Delegations[0].Zone != "example.com." {
+		t.Errorf("Delegations = %+v, want only example.com.", resolution.Delegations)
+	}
+	if root.queries.Load() != 1 || tld.queries.Load() != 1 {
+		t.Errorf("root and TLD queries = %d and %d, want 1 and 1", root.queries.Load(), tld.queries.Load())
+	}
+
+	// Names under zones not cut yet still walk from the root
+	resolver.ResolveTypes("www.example.org", []string{"A"})
+	if root.queries.Load() != 2 {
+		t.Errorf("root queries = %d, want 2", root.queries.Load())
+	}
+}
+
+func TestIterativeResolver_RetryServFail(t *testing.T) {
+	root, tld, auth := testHierarchy()
+	auth.servFails = 2
+	port := startHierarchy(t, root, tld, auth)
+
+	resolver := NewIterativeResolver(IterativeConfig{
+		RootHints: []string{"127.0.0.1"},
+		Port:      port,
+		Timeout:   2 * time.Second,
+		Retry:     retry.NewPolicy(retry.Config{MaxTries: 3, BaseDelay: time.Millisecond}),
+	})
+
+	resolution, err := resolver.ResolveTypes("www.example.com", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+	if len(resolution.IPs) != 1 || resolution.IPs[0] != "93.184.216.34" {
+		t.Errorf("ResolveTypes().IPs = %v, want [93.184.216.34]", resolution.IPs)
+	}
+	if last := resolution.Messages[len(resolution.Messages)-1]; resolution.Retries != 2 || last.Tries != 3 {
+		t.Errorf("Retries = %d, Tries = %d, want 2 and 3", resolution.Retries, last.Tries)
+	}
+}
+
+func TestIterativeResolver_Glue(t *testing.T) {
+	response := new(dns.Msg)
+	for _, value := range []string{
+		"ns1.example.com. 600 IN AAAA 2001:db8::53",
+		"ns1.example.com. 300 IN A 192.0.2.53",
+		"ns9.other.test. 60 IN A 192.0.2.99",
+	} {
+		rr, err := dns.NewRR(value)
+		if err != nil {
+			t.Fatalf("Failed to parse test record %q: %v", value, err)
+		}
+		response.Extra = append(response.Extra, rr)
+	}
+
+	resolver := NewIterativeResolver(IterativeConfig{Port: "53"})
+	addrs, ttl := resolver.glue(response, zoneCut{zone: "example.com.", nameservers: []string{"ns1.example.com."}, ttl: 3600})
+
+	want := []string{"192.0.2.53:53", "[2001:db8::53]:53"}
+	if len(addrs) != len(want) || addrs[0] != want[0] || addrs[1] != want[1] {
+		t.Errorf("glue() addrs = %v, want %v", addrs, want)
+	}
+	if ttl != 300 {
+		t.Errorf("glue() ttl = %d, want 300", ttl)
+	}
+}
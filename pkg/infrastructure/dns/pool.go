@@ -0,0 +1,198 @@
+package dns
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/miekg/dns"
+)
+
+const (
+	// ewmaWeight is the weight of a new sample in the moving averages
+	ewmaWeight = 0.1
+	// initialLatencyMs is the latency assumed for servers not queried yet
+	initialLatencyMs = 50
+	// maxInconsistencies is the number of disagreements with the majority
+	// after which a server is quarantined
+	maxInconsistencies = 3
+)
+
+// serverState tracks the health of a single DNS server
+type serverState struct {
+	addr             string
+	queries          int64
+	errors           int64
+	servFails        int64
+	inconsistencies  int
+	latencyMs        float64 // Moving average of successful queries
+	failureRate      float64 // Moving average of errors and SERVFAILs
+	quarantinedUntil time.Time
+	probedAt         time.Time // Last canary probe
+}
+
+// score rates a server; healthy, fast servers score higher
+func (s *serverState) score() float64 {
+	health := 1 - s.failureRate
+	return health * health / (s.latencyMs + 1)
+}
+
+// pool tracks the health of DNS servers and orders them by score
+type pool struct {
+	servers    []*serverState
+	index      map[string]*serverState
+	quarantine time.Duration
+	mu         sync.Mutex
+}
+
+// newPool creates a pool of healthy servers
+func newPool(servers []string, quarantine time.Duration) *pool {
+	p := &pool{
+		index:      make(map[string]*serverState, len(servers)),
+		quarantine: quarantine,
+	}
+	for _, addr := range servers {
+		if _, ok := p.index[addr]; ok {
+			continue
+		}
+		s := &serverState{addr: addr, latencyMs: initialLatencyMs}
+		p.servers = append(p.servers, s)
+		p.index[addr] = s
+	}
+	return p
+}
+
+// order returns the servers that are not quarantined in a random order
+// weighted by score. If every server is quarantined, all of them are returned.
+func (p *pool) order() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	candidates := make([]*serverState, 0, len(p.servers))
+	for _, s := range p.servers {
+		if now.After(s.quarantinedUntil) {
+			candidates = append(candidates, s)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, p.servers...)
+	}
+
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, s := range candidates {
+		// Keep a floor so that failing servers are still probed now and then
+		weights[i] = max(s.score(), 1e-6)
+		total += weights[i]
+	}
+
+	// Weighted sampling without replacement
+	order := make([]string, 0, len(candidates))
+	for len(candidates) > 0 {
+		target := rand.Float64() * total
+		i := 0
+		for ; i < len(candidates)-1; i++ {
+			target -= weights[i]
+			if target < 0 {
+				break
+			}
+		}
+		order = append(order, candidates[i].addr)
+		total -= weights[i]
+		candidates = append(candidates[:i], candidates[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+	return order
+}
+
+// report records the outcome of a query sent to server
+func (p *pool) report(server string, rtt time.Duration, response *dns.Msg, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.index[server]
+	if !ok {
+		return
+	}
+
+	s.queries++
+	failed := 0.0
+	switch {
+	case err != nil:
+		s.errors++
+		failed = 1
+	case response.Rcode == dns.RcodeServerFailure:
+		s.servFails++
+		failed = 1
+	default:
+		s.latencyMs += ewmaWeight * (float64(rtt.Milliseconds()) - s.latencyMs)
+	}
+	s.failureRate += ewmaWeight * (failed - s.failureRate)
+}
+
+// reportInconsistent records that server disagreed with the majority of servers
+func (p *pool) reportInconsistent(server string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.index[server]
+	if !ok {
+		return
+	}
+
+	s.inconsistencies++
+	if s.inconsistencies >= maxInconsistencies {
+		s.inconsistencies = 0
+		s.quarantinedUntil = time.Now().Add(p.quarantine)
+	}
+}
+
+// quarantineServer stops using server for the quarantine duration
+func (p *pool) quarantineServer(server string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s, ok := p.index[server]; ok {
+		s.quarantinedUntil = time.Now().Add(p.quarantine)
+	}
+}
+
+// probeDue reports whether server is due for a canary probe: on its first
+// use, and then once per quarantine duration, so that a server quarantined
+// by a probe is probed again as soon as it is released and one that starts
+// hijacking later is caught
+func (p *pool) probeDue(server string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.index[server]
+	now := time.Now()
+	if !ok || (!s.probedAt.IsZero() && now.Sub(s.probedAt) < p.quarantine) {
+		return false
+	}
+	s.probedAt = now
+	return true
+}
+
+// stats returns a snapshot of the health of every server
+func (p *pool) stats() []entity.DNSServerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]entity.DNSServerStats, 0, len(p.servers))
+	for _, s := range p.servers {
+		stats = append(stats, entity.DNSServerStats{
+			Server:      s.addr,
+			Queries:     s.queries,
+			Errors:      s.errors,
+			ServFails:   s.servFails,
+			LatencyMs:   s.latencyMs,
+			Score:       s.score(),
+			Quarantined: now.Before(s.quarantinedUntil),
+		})
+	}
+	return stats
+}
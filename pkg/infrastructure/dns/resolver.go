@@ -2,25 +2,88 @@ package dns
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
 	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/retry"
 	"github.com/miekg/dns"
 )
 
+// maxCNAMEChain bounds the number of CNAME hops followed per lookup
+const maxCNAMEChain = 8
+
+// AddressRecordTypes are queried for every name, since the crawl depends on
+// its addresses; CNAME chains are followed and recorded along the way
+var AddressRecordTypes = []string{"A", "AAAA"}
+
+// DefaultRecordTypes are the record types queried when none are configured:
+// the addresses, and the records mined for more names
+var DefaultRecordTypes = []string{"A", "AAAA", "MX", "NS", "TXT"}
+
+// RecordTypes returns the address record types followed by extra, or
+// DefaultRecordTypes when extra is empty
+func RecordTypes(extra []string) []string {
+	if len(extra) == 0 {
+		return DefaultRecordTypes
+	}
+
+	recordTypes := slices.Clone(AddressRecordTypes)
+	for _, recordType := range extra {
+		recordType = strings.ToUpper(recordType)
+		if !slices.Contains(recordTypes, recordType) {
+			recordTypes = append(recordTypes, recordType)
+		}
+	}
+	return recordTypes
+}
+
 // Resolver implements service.DNSResolver
 type Resolver struct {
-	servers []string
-	timeout time.Duration
-	client  *dns.Client
+	pool         *pool
+	race         bool
+	canaryDomain string
+	search       []string
+	ndots        int
+	timeout      time.Duration
+	recordTypes  []string
+	limiter      service.RateLimiter
+	retry        service.RetryPolicy
+	transports   map[string]transport
+
+	ednsBufferSize uint16
 }
 
 // Config holds DNS resolver configuration
 type Config struct {
-	Servers []string
-	Timeout time.Duration
+	// Servers are addresses (UDP) or udp://, tcp://, tls:// and https:// URLs
+	Servers     []string
+	Timeout     time.Duration
+	RecordTypes []string
+	// Limiter throttles queries per DNS server; nil disables throttling
+	Limiter service.RateLimiter
+	// Retry decides which failed queries are retried; nil disables retries
+	Retry service.RetryPolicy
+	// Race sends each query to the two best servers at once and takes the first answer
+	Race bool
+	// QuarantineDuration is how long servers giving bad answers are not used
+	QuarantineDuration time.Duration
+	// CanaryDomain is a domain without wildcard records; servers answering a
+	// random name under it hijack NXDOMAIN and are quarantined. Servers are
+	// probed on first use and again once per QuarantineDuration. Empty
+	// disables the check.
+	CanaryDomain string
+	// Search domains are tried, as in resolv.conf, for names with fewer than Ndots dots
+	Search []string
+	Ndots  int
+	// TLSConfig is used for DNS-over-TLS and DNS-over-HTTPS servers; nil uses the system roots
+	TLSConfig *tls.Config
+	// EDNSBufferSize advertises EDNS0 with this UDP payload size; 0 disables EDNS0
+	EDNSBufferSize uint16
 }
 
 // NewResolver creates a new DNS resolver
@@ -34,12 +97,36 @@ func NewResolver(config Config) *Resolver {
 		}
 	}
 
+	if len(config.RecordTypes) == 0 {
+		config.RecordTypes = DefaultRecordTypes
+	}
+
+	if config.QuarantineDuration <= 0 {
+		config.QuarantineDuration = 5 * time.Minute
+	}
+
+	if config.Ndots <= 0 {
+		config.Ndots = 1
+	}
+
+	transports := make(map[string]transport, len(config.Servers))
+	for _, server := range config.Servers {
+		transports[server] = newTransport(server, config.Timeout, config.TLSConfig)
+	}
+
 	return &Resolver{
-		servers: config.Servers,
-		timeout: config.Timeout,
-		client: &dns.Client{
-			Timeout: config.Timeout,
-		},
+		pool:         newPool(config.Servers, config.QuarantineDuration),
+		search:       config.Search,
+		ndots:        config.Ndots,
+		race:         config.Race,
+		canaryDomain: config.CanaryDomain,
+		timeout:      config.Timeout,
+		recordTypes:  config.RecordTypes,
+		limiter:      config.Limiter,
+		retry:        config.Retry,
+		transports:   transports,
+
+		ednsBufferSize: config.EDNSBufferSize,
 	}
 }
 
@@ -49,95 +136,392 @@ func (r *Resolver) Resolve(domain string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	return resolution.IPs, nil
+	return append(resolution.IPs, resolution.IPv6...), nil
 }
 
 // ResolveWithDetails implements service.DNSResolver
 func (r *Resolver) ResolveWithDetails(domain string) (*service.DNSResolution, error) {
+	return r.ResolveTypes(domain, r.recordTypes)
+}
+
+// ResolveTypes implements service.DNSResolver
+func (r *Resolver) ResolveTypes(domain string, recordTypes []string) (*service.DNSResolution, error) {
+	names := r.searchNames(domain)
+	if len(names) == 1 {
+		return r.resolveName(domain, recordTypes)
+	}
+
+	// Try the search list until a name exists, keeping the queries of every try
+	var messages []*entity.DNSMessage
+	for i, name := range names {
+		resolution, err := r.resolveName(name, recordTypes)
+		messages = append(messages, resolution.Messages...)
+		if i == len(names)-1 || (err == nil && resolution.Rcode != dns.RcodeToString[dns.RcodeNameError]) {
+			resolution.Messages = messages
+			return resolution, err
+		}
+	}
+	return nil, fmt.Errorf("no names to resolve for %s", domain)
+}
+
+// searchNames returns the names to try for domain. Names with fewer than ndots
+// dots are tried under each search domain first. Unlike the system resolver,
+// other names never fall back to the search list, which would turn every
+// NXDOMAIN of a crawl into extra queries.
+func (r *Resolver) searchNames(domain string) []string {
+	if len(r.search) == 0 || strings.HasSuffix(domain, ".") || strings.Count(domain, ".") >= r.ndots {
+		return []string{domain}
+	}
+
+	names := make([]string, 0, len(r.search)+1)
+	for _, search := range r.search {
+		names = append(names, domain+"."+trimDot(search))
+	}
+	return append(names, domain)
+}
+
+// resolveName resolves the given record types of a single name
+func (r *Resolver) resolveName(domain string, recordTypes []string) (*service.DNSResolution, error) {
 	requestAt := time.Now()
 
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
-	msg.RecursionDesired = true
+	resolution := &service.DNSResolution{
+		Domain:    domain,
+		RequestAt: requestAt.UnixMilli(),
+	}
 
 	var lastErr error
-	var response *dns.Msg
-	var usedServer string
-	var rtt time.Duration
-
-	// Try each DNS server
-	for _, server := range r.servers {
-		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
-		resp, rttMs, err := r.client.ExchangeContext(ctx, msg, server)
-		cancel()
-
-		if err == nil && resp != nil {
-			response = resp
-			usedServer = server
-			rtt = rttMs
-			break
+	answered := 0
+
+	for _, recordType := range recordTypes {
+		qtype, ok := dns.StringToType[strings.ToUpper(recordType)]
+		if !ok {
+			lastErr = fmt.Errorf("unsupported record type: %s", recordType)
+			continue
+		}
+
+		name := domain
+		for hop := 0; hop <= maxCNAMEChain; hop++ {
+			msg, reply := r.query(name, qtype)
+			response := reply.response
+
+			dnsMsg := &entity.DNSMessage{
+				Domain:      name,
+				Server:      reply.server,
+				Transport:   reply.transport,
+				Request:     toDNSDetail(msg),
+				Response:    toDNSDetail(response),
+				RTT:         reply.rtt.Milliseconds(),
+				Tries:       reply.tries,
+				TCPFallback: reply.tcpFallback,
+			}
+			if reply.err != nil {
+				dnsMsg.Error = reply.err.Error()
+			}
+			resolution.Messages = append(resolution.Messages, dnsMsg)
+			resolution.RTTMs += reply.rtt.Milliseconds()
+			resolution.Retries += reply.tries - 1
+
+			if response == nil {
+				lastErr = reply.err
+				break
+			}
+
+			answered++
+			if resolution.Server == "" {
+				resolution.Server = reply.server
+				resolution.Rcode = dns.RcodeToString[response.Rcode]
+				resolution.RawRequest = msg.String()
+				resolution.RawResponse = response.String()
+			}
+
+			// Follow the CNAME chain if the answer stops short of the target type
+			target, found := collectAnswers(resolution, name, qtype, response)
+			if found || target == trimDot(name) || qtype == dns.TypeCNAME {
+				break
+			}
+			name = target
 		}
-		lastErr = err
 	}
 
 	responseAt := time.Now()
+	resolution.ResponseAt = responseAt.UnixMilli()
 
-	if response == nil {
+	if answered == 0 {
 		errMsg := "no response from any DNS server"
 		if lastErr != nil {
 			errMsg = lastErr.Error()
 		}
-		return &service.DNSResolution{
-			Domain:     domain,
-			Error:      errMsg,
-			RequestAt:  requestAt.UnixMilli(),
-			ResponseAt: responseAt.UnixMilli(),
-			RTTMs:      responseAt.Sub(requestAt).Milliseconds(),
-		}, fmt.Errorf("%s", errMsg)
+		resolution.Error = errMsg
+		resolution.RTTMs = responseAt.Sub(requestAt).Milliseconds()
+		return resolution, fmt.Errorf("%s", errMsg)
+	}
+
+	return resolution, nil
+}
+
+// query exchanges a query, retrying timeouts and SERVFAIL answers per the
+// retry policy. The reply records the number of tries made.
+func (r *Resolver) query(name string, qtype uint16) (*dns.Msg, reply) {
+	for try := 1; ; try++ {
+		msg, reply := r.exchange(name, qtype)
+		reply.tries = try
+
+		var errorClass string
+		if reply.err != nil {
+			errorClass = retry.Classify(reply.err)
+		} else {
+			errorClass = retry.ClassifyRcode(reply.response.Rcode)
+		}
+		if r.retry == nil || errorClass == "" {
+			return msg, reply
+		}
+
+		delay, ok := r.retry.Backoff(try, errorClass, 0)
+		if !ok {
+			return msg, reply
+		}
+		time.Sleep(delay)
 	}
+}
 
-	// Extract IPs and records
-	var ips []string
-	var records []service.DNSRecord
+// exchange sends a query to the DNS servers, best scoring first, until one
+// answers. With racing enabled the first two servers are queried at once.
+func (r *Resolver) exchange(name string, qtype uint16) (*dns.Msg, reply) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.RecursionDesired = true
+	if r.ednsBufferSize > 0 {
+		msg.SetEdns0(r.ednsBufferSize, false)
+	}
 
+	last := reply{err: fmt.Errorf("no response from any DNS server")}
+
+	servers := r.pool.order()
+	if r.race && len(servers) >= 2 {
+		last = r.raceExchange(msg, servers[:2], servers[2:])
+		if last.err == nil {
+			return msg, last
+		}
+		servers = servers[2:]
+	}
+
+	for _, server := range servers {
+		last = r.exchangeWith(msg, server)
+		if last.err == nil {
+			return msg, last
+		}
+	}
+
+	// Keep the server and transport of the last failure for the log
+	last.response = nil
+	last.rtt = 0
+	return msg, last
+}
+
+// exchangeWith sends a single query to server and records its health
+func (r *Resolver) exchangeWith(msg *dns.Msg, server string) reply {
+	if r.canaryDomain != "" && r.pool.probeDue(server) {
+		go r.probeCanary(server)
+	}
+
+	if r.limiter != nil {
+		r.limiter.Wait(service.RateKey{Kind: service.RateKeyDNSServer, Key: server})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	reply := r.transports[server].exchange(ctx, msg)
+	cancel()
+
+	reply.server = server
+	if reply.err == nil && reply.response == nil {
+		reply.err = fmt.Errorf("empty response from %s", server)
+	}
+	r.pool.report(server, reply.rtt, reply.response, reply.err)
+	return reply
+}
+
+// reply is the outcome of a query sent to one server
+type reply struct {
+	response    *dns.Msg
+	server      string
+	transport   string // "udp", "tcp", "tls" or "https"
+	rtt         time.Duration
+	err         error
+	tries       int
+	tcpFallback bool // The UDP response was truncated and the query repeated over TCP
+}
+
+// usable checks if the reply is an answer worth returning
+func (r reply) usable() bool {
+	return r.err == nil && r.response.Rcode != dns.RcodeServerFailure
+}
+
+// raceExchange sends msg to the racers at once and returns the first usable
+// reply. The slower reply is checked against it in the background, with
+// tiebreakers settling disagreements.
+func (r *Resolver) raceExchange(msg *dns.Msg, racers []string, tiebreakers []string) reply {
+	replies := make(chan reply, len(racers))
+	for _, server := range racers {
+		go func(msg *dns.Msg, server string) {
+			replies <- r.exchangeWith(msg, server)
+		}(msg.Copy(), server)
+	}
+
+	first := <-replies
+	if first.usable() {
+		go r.compare(msg, first, replies, tiebreakers)
+		return first
+	}
+
+	second := <-replies
+	if second.usable() || first.err != nil {
+		return second
+	}
+	return first
+}
+
+// compare waits for the slower racing reply and, if it disagrees with the
+// faster one, asks a tiebreaker. The server in the minority is reported as
+// inconsistent.
+func (r *Resolver) compare(msg *dns.Msg, first reply, replies <-chan reply, tiebreakers []string) {
+	second := <-replies
+	if !second.usable() || sameShape(first.response, second.response) || len(tiebreakers) == 0 {
+		return
+	}
+
+	third := r.exchangeWith(msg.Copy(), tiebreakers[0])
+	if !third.usable() {
+		return
+	}
+
+	switch {
+	case sameShape(third.response, first.response):
+		r.pool.reportInconsistent(second.server)
+	case sameShape(third.response, second.response):
+		r.pool.reportInconsistent(first.server)
+	}
+}
+
+// sameShape checks if two responses agree on the rcode and on whether the
+// name has answers; the records themselves legitimately differ, e.g. for CDNs
+func sameShape(a, b *dns.Msg) bool {
+	return a.Rcode == b.Rcode && (len(a.Answer) == 0) == (len(b.Answer) == 0)
+}
+
+// probeCanary quarantines server if it answers a name that cannot exist
+func (r *Resolver) probeCanary(server string) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(randomLabel()+"."+r.canaryDomain), dns.TypeA)
+	msg.RecursionDesired = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	reply := r.transports[server].exchange(ctx, msg)
+	cancel()
+
+	if resp := reply.response; reply.err == nil && resp != nil && resp.Rcode == dns.RcodeSuccess && len(resp.Answer) > 0 {
+		r.pool.quarantineServer(server)
+	}
+}
+
+// ServerStats implements service.DNSServerReporter
+func (r *Resolver) ServerStats() []entity.DNSServerStats {
+	return r.pool.stats()
+}
+
+// collectAnswers records the answers for name into resolution. It returns the
+// last name of the CNAME chain starting at name, and whether the chain ends in
+// a record of type qtype.
+func collectAnswers(resolution *service.DNSResolution, name string, qtype uint16, response *dns.Msg) (string, bool) {
+	// Index CNAMEs by owner to walk the chain in order
+	cnames := make(map[string]string)
 	for _, answer := range response.Answer {
-		if aRecord, ok := answer.(*dns.A); ok {
-			ip := aRecord.A.String()
-			ips = append(ips, ip)
-			records = append(records, service.DNSRecord{
-				Type:  "A",
-				Value: ip,
-				TTL:   aRecord.Hdr.Ttl,
-				Class: dns.ClassToString[aRecord.Hdr.Class],
-			})
+		if cname, ok := answer.(*dns.CNAME); ok {
+			cnames[strings.ToLower(cname.Hdr.Name)] = cname.Target
 		}
 	}
 
-	// Prepare DNS Message
-	dnsMsg := &entity.DNSMessage{
-		Domain:   domain,
-		Server:   usedServer,
-		Request:  toDNSDetail(msg),
-		Response: toDNSDetail(response),
-		RTT:      rtt.Milliseconds(),
-		Error:    "",
+	owners := map[string]bool{strings.ToLower(dns.Fqdn(name)): true}
+	current := dns.Fqdn(name)
+	for i := 0; i < maxCNAMEChain; i++ {
+		target, ok := cnames[strings.ToLower(current)]
+		if !ok {
+			break
+		}
+		if !containsString(resolution.CNAMEs, trimDot(target)) {
+			resolution.CNAMEs = append(resolution.CNAMEs, trimDot(target))
+			resolution.Records = append(resolution.Records, service.DNSRecord{
+				Name:  trimDot(current),
+				Type:  "CNAME",
+				Value: trimDot(target),
+				Class: "IN",
+			})
+		}
+		owners[strings.ToLower(target)] = true
+		current = target
 	}
-	if lastErr != nil {
-		dnsMsg.Error = lastErr.Error()
+
+	found := false
+	for _, answer := range response.Answer {
+		header := answer.Header()
+		if !owners[strings.ToLower(header.Name)] || header.Rrtype != qtype {
+			continue
+		}
+		found = true
+
+		var value string
+		switch rr := answer.(type) {
+		case *dns.A:
+			value = rr.A.String()
+			resolution.IPs = appendUnique(resolution.IPs, value)
+		case *dns.AAAA:
+			value = rr.AAAA.String()
+			resolution.IPv6 = appendUnique(resolution.IPv6, value)
+		case *dns.MX:
+			value = trimDot(rr.Mx)
+			resolution.MX = appendUnique(resolution.MX, value)
+		case *dns.NS:
+			value = trimDot(rr.Ns)
+			resolution.NS = appendUnique(resolution.NS, value)
+		case *dns.PTR:
+			value = trimDot(rr.Ptr)
+		case *dns.TXT:
+			value = strings.Join(rr.Txt, "")
+			resolution.TXT = appendUnique(resolution.TXT, value)
+		case *dns.SOA:
+			value = fmt.Sprintf("%s %s %d %d %d %d %d", trimDot(rr.Ns), trimDot(rr.Mbox), rr.Serial, rr.Refresh, rr.Retry, rr.Expire, rr.Minttl)
+			resolution.SOA = value
+		case *dns.CNAME:
+			// Already recorded while walking the chain
+			continue
+		default:
+			value = strings.TrimPrefix(answer.String(), header.String())
+		}
+
+		resolution.Records = append(resolution.Records, service.DNSRecord{
+			Name:  trimDot(header.Name),
+			Type:  dns.TypeToString[header.Rrtype],
+			Value: value,
+			TTL:   header.Ttl,
+			Class: dns.ClassToString[header.Class],
+		})
 	}
 
-	return &service.DNSResolution{
-		Domain:      domain,
-		IPs:         ips,
-		Records:     records,
-		Server:      usedServer,
-		RTTMs:       rtt.Milliseconds(),
-		RequestAt:   requestAt.UnixMilli(),
-		ResponseAt:  responseAt.UnixMilli(),
-		RawRequest:  msg.String(),
-		RawResponse: response.String(),
-		Message:     dnsMsg,
-	}, nil
+	return trimDot(current), found
+}
+
+// trimDot lowercases a name and removes its trailing root dot
+func trimDot(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// containsString checks if slice contains value
+func containsString(slice []string, value string) bool {
+	for _, existing := range slice {
+		if existing == value {
+			return true
+		}
+	}
+	return false
 }
 
 func toDNSDetail(msg *dns.Msg) *entity.DNSDetail {
@@ -145,14 +529,19 @@ func toDNSDetail(msg *dns.Msg) *entity.DNSDetail {
 		return nil
 	}
 	detail := &entity.DNSDetail{
-		ID:       msg.Id,
-		Response: msg.Response,
-		Opcode:   msg.Opcode,
-		Rcode:    msg.Rcode,
-		Question: make([]entity.DNSQuestion, len(msg.Question)),
-		Answer:   make([]entity.DNSRR, len(msg.Answer)),
-		Nv:       make([]entity.DNSRR, len(msg.Ns)),
-		Extra:    make([]entity.DNSRR, len(msg.Extra)),
+		ID:        msg.Id,
+		Response:  msg.Response,
+		Opcode:    msg.Opcode,
+		Rcode:     msg.Rcode,
+		Truncated: msg.Truncated,
+		Question:  make([]entity.DNSQuestion, len(msg.Question)),
+		Answer:    make([]entity.DNSRR, len(msg.Answer)),
+		Nv:        make([]entity.DNSRR, len(msg.Ns)),
+		Extra:     make([]entity.DNSRR, len(msg.Extra)),
+	}
+
+	if opt := msg.IsEdns0(); opt != nil {
+		detail.UDPSize = opt.UDPSize()
 	}
 
 	for i, q := range msg.Question {
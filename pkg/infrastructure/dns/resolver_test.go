@@ -0,0 +1,320 @@
+package dns
+
+import (
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/retry"
+	"github.com/miekg/dns"
+)
+
+// startTestServer starts an in-process UDP DNS server answering from zone
+func startTestServer(t *testing.T, zone map[string][]string) string {
+	t.Helper()
+
+	return startTestHandler(t, zoneHandler(t, zone))
+}
+
+// zoneHandler answers from zone, keyed by "name. TYPE"
+func zoneHandler(t *testing.T, zone map[string][]string) dns.HandlerFunc {
+	t.Helper()
+
+	records := make(map[string][]dns.RR)
+	for key, values := range zone {
+		for _, value := range values {
+			rr, err := dns.NewRR(value)
+			if err != nil {
+				t.Fatalf("Failed to parse test record %q: %v", value, err)
+			}
+			records[key] = append(records[key], rr)
+		}
+	}
+
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		resp.Answer = records[q.Name+" "+dns.TypeToString[q.Qtype]]
+		if len(resp.Answer) == 0 {
+			resp.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(resp)
+	}
+}
+
+// startTestHandler starts an in-process UDP DNS server with a custom handler
+func startTestHandler(t *testing.T, handler dns.HandlerFunc) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	server := &dns.Server{PacketConn: conn, Handler: handler}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return conn.LocalAddr().String()
+}
+
+func TestResolver_RecordTypes(t *testing.T) {
+	addr := startTestServer(t, map[string][]string{
+		"example.com. A":    {"example.com. 300 IN A 93.184.216.34"},
+		"example.com. AAAA": {"example.com. 300 IN AAAA 2606:2800:220:1::1"},
+		"example.com. MX":   {"example.com. 300 IN MX 10 mail.example.com."},
+		"example.com. NS":   {"example.com. 300 IN NS ns1.example.com."},
+		"example.com. TXT":  {`example.com. 300 IN TXT "v=spf1 include:_spf.example.com ~all"`},
+	})
+
+	resolver := NewResolver(Config{Servers: []string{addr}, Timeout: time.Second})
+	resolution, err := resolver.ResolveTypes("example.com", []string{"A", "AAAA", "MX", "NS", "TXT"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+
+	if len(resolution.IPs) != 1 || resolution.IPs[0] != "93.184.216.34" {
+		t.Errorf("IPs = %v, want [93.184.216.34]", resolution.IPs)
+	}
+	if len(resolution.IPv6) != 1 || resolution.IPv6[0] != "2606:2800:220:1::1" {
+		t.Errorf("IPv6 = %v, want [2606:2800:220:1::1]", resolution.IPv6)
+	}
+	if len(resolution.MX) != 1 || resolution.MX[0] != "mail.example.com" {
+		t.Errorf("MX = %v, want [mail.example.com]", resolution.MX)
+	}
+	if len(resolution.NS) != 1 || resolution.NS[0] != "ns1.example.com" {
+		t.Errorf("NS = %v, want [ns1.example.com]", resolution.NS)
+	}
+	if len(resolution.TXT) != 1 {
+		t.Errorf("TXT = %v, want 1 record", resolution.TXT)
+	}
+	if len(resolution.Messages) != 5 {
+		t.Errorf("len(Messages) = %d, want 5", len(resolution.Messages))
+	}
+}
+
+func TestResolver_CNAMEChain(t *testing.T) {
+	addr := startTestServer(t, map[string][]string{
+		// The first answer stops at the CDN name, forcing a follow-up query
+		"www.example.com. A": {
+			"www.example.com. 300 IN CNAME www.example.com.cdn.net.",
+			"www.example.com.cdn.net. 300 IN CNAME edge.cdn.net.",
+		},
+		"edge.cdn.net. A": {"edge.cdn.net. 60 IN A 10.0.0.1"},
+	})
+
+	resolver := NewResolver(Config{Servers: []string{addr}, Timeout: time.Second})
+	resolution, err := resolver.ResolveTypes("www.example.com", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+
+	expected := []string{"www.example.com.cdn.net", "edge.cdn.net"}
+	if len(resolution.CNAMEs) != len(expected) {
+		t.Fatalf("CNAMEs = %v, want %v", resolution.CNAMEs, expected)
+	}
+	for i := range expected {
+		if resolution.CNAMEs[i] != expected[i] {
+			t.Errorf("CNAMEs[%d] = %s, want %s", i, resolution.CNAMEs[i], expected[i])
+		}
+	}
+
+	if len(resolution.IPs) != 1 || resolution.IPs[0] != "10.0.0.1" {
+		t.Errorf("IPs = %v, want [10.0.0.1]", resolution.IPs)
+	}
+}
+
+func TestResolver_RetryServFail(t *testing.T) {
+	var queries atomic.Int64
+	addr := startTestHandler(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		if queries.Add(1) <= 2 {
+			resp.Rcode = dns.RcodeServerFailure
+		} else {
+			rr, _ := dns.NewRR("example.com. 300 IN A 93.184.216.34")
+			resp.Answer = []dns.RR{rr}
+		}
+		w.WriteMsg(resp)
+	})
+
+	resolver := NewResolver(Config{
+		Servers: []string{addr},
+		Timeout: time.Second,
+		Retry:   retry.NewPolicy(retry.Config{MaxTries: 3, BaseDelay: time.Millisecond}),
+	})
+	resolution, err := resolver.ResolveTypes("example.com", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+
+	if resolution.Rcode != "NOERROR" || len(resolution.IPs) != 1 {
+		t.Errorf("ResolveTypes() = %s %v, want NOERROR [93.184.216.34]", resolution.Rcode, resolution.IPs)
+	}
+	if resolution.Retries != 2 || resolution.Messages[0].Tries != 3 {
+		t.Errorf("Retries = %d, Tries = %d, want 2 and 3", resolution.Retries, resolution.Messages[0].Tries)
+	}
+}
+
+func TestResolver_Race(t *testing.T) {
+	answer := func(delay time.Duration, ip string) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, req *dns.Msg) {
+			time.Sleep(delay)
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+			rr, _ := dns.NewRR("example.com. 300 IN A " + ip)
+			resp.Answer = []dns.RR{rr}
+			w.WriteMsg(resp)
+		}
+	}
+	slow := startTestHandler(t, answer(time.Second, "10.0.0.1"))
+	fast := startTestHandler(t, answer(0, "10.0.0.2"))
+
+	resolver := NewResolver(Config{Servers: []string{slow, fast}, Timeout: 2 * time.Second, Race: true})
+
+	start := time.Now()
+	resolution, err := resolver.ResolveTypes("example.com", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("ResolveTypes() took %s, want the fast server's answer", elapsed)
+	}
+	if resolution.Server != fast || len(resolution.IPs) != 1 || resolution.IPs[0] != "10.0.0.2" {
+		t.Errorf("ResolveTypes() = %v from %s, want [10.0.0.2] from %s", resolution.IPs, resolution.Server, fast)
+	}
+}
+
+func TestResolver_CanaryQuarantine(t *testing.T) {
+	// A hijacking server answers every name, including ones that cannot exist
+	hijacker := startTestHandler(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 300 IN A 10.0.0.1")
+		resp.Answer = []dns.RR{rr}
+		w.WriteMsg(resp)
+	})
+	honest := startTestServer(t, map[string][]string{
+		"example.com. A": {"example.com. 300 IN A 93.184.216.34"},
+	})
+
+	resolver := NewResolver(Config{Servers: []string{hijacker, honest}, Timeout: time.Second, CanaryDomain: "canary.test"})
+	for _, server := range []string{hijacker, honest} {
+		resolver.exchangeWith(new(dns.Msg).SetQuestion("example.com.", dns.TypeA), server)
+	}
+
+	// The canary probes run in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		order := resolver.pool.order()
+		if len(order) == 1 {
+			if order[0] != honest {
+				t.Errorf("pool.order() = %v, want only %s", order, honest)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Hijacking server %s should be quarantined", hijacker)
+}
+
+func TestPool_ProbeDue(t *testing.T) {
+	p := newPool([]string{"a:53"}, time.Minute)
+
+	tests := []struct {
+		name     string
+		server   string
+		age      time.Duration // Time since the last probe, if set
+		expected bool
+	}{
+		{"first use", "a:53", 0, true},
+		{"just probed", "a:53", 0, false},
+		{"within the quarantine duration", "a:53", 30 * time.Second, false},
+		{"quarantine duration elapsed", "a:53", time.Minute, true},
+		{"unknown server", "b:53", 0, false},
+	}
+
+	for _, tt := range tests {
+		if s, ok := p.index[tt.server]; ok && tt.age > 0 {
+			s.probedAt = time.Now().Add(-tt.age)
+		}
+		if due := p.probeDue(tt.server); due != tt.expected {
+			t.Errorf("%s: probeDue(%s) = %v, want %v", tt.name, tt.server, due, tt.expected)
+		}
+	}
+}
+
+func TestPool_Score(t *testing.T) {
+	p := newPool([]string{"good:53", "bad:53"}, time.Minute)
+
+	servFail := new(dns.Msg)
+	servFail.Rcode = dns.RcodeServerFailure
+	for i := 0; i < 20; i++ {
+		p.report("good:53", 10*time.Millisecond, new(dns.Msg), nil)
+		p.report("bad:53", 10*time.Millisecond, servFail, nil)
+	}
+
+	stats := p.stats()
+	if stats[0].Score <= stats[1].Score {
+		t.Errorf("Score(good) = %f, want > Score(bad) = %f", stats[0].Score, stats[1].Score)
+	}
+	if stats[1].ServFails != 20 || stats[0].Queries != 20 {
+		t.Errorf("stats() = %+v, want 20 queries each and 20 SERVFAILs for bad", stats)
+	}
+
+	for i := 0; i < maxInconsistencies; i++ {
+		p.reportInconsistent("bad:53")
+	}
+	if order := p.order(); len(order) != 1 || order[0] != "good:53" {
+		t.Errorf("pool.order() = %v, want [good:53]", order)
+	}
+}
+
+func TestResolver_Search(t *testing.T) {
+	addr := startTestServer(t, map[string][]string{
+		"intranet.corp.example.com. A": {"intranet.corp.example.com. 300 IN A 10.0.0.1"},
+	})
+
+	resolver := NewResolver(Config{
+		Servers: []string{addr},
+		Timeout: time.Second,
+		Search:  []string{"missing.example.com", "corp.example.com"},
+	})
+
+	resolution, err := resolver.ResolveTypes("intranet", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+	if resolution.Domain != "intranet.corp.example.com" || len(resolution.IPs) != 1 {
+		t.Errorf("ResolveTypes() = %s %v, want intranet.corp.example.com [10.0.0.1]", resolution.Domain, resolution.IPs)
+	}
+	if len(resolution.Messages) != 2 {
+		t.Errorf("ResolveTypes() logged %d queries, want 2", len(resolution.Messages))
+	}
+
+	// Qualified names never fall back to the search list
+	if names := resolver.searchNames("www.example.com"); len(names) != 1 {
+		t.Errorf("searchNames(www.example.com) = %v, want [www.example.com]", names)
+	}
+}
+
+func TestRecordTypes(t *testing.T) {
+	tests := []struct {
+		extra    []string
+		expected []string
+	}{
+		{nil, DefaultRecordTypes},
+		// Addresses are always queried, whatever else is asked for
+		{[]string{"MX"}, []string{"A", "AAAA", "MX"}},
+		{[]string{"soa", "aaaa", "SOA"}, []string{"A", "AAAA", "SOA"}},
+	}
+
+	for _, tt := range tests {
+		if got := RecordTypes(tt.extra); !slices.Equal(got, tt.expected) {
+			t.Errorf("RecordTypes(%v) = %v, want %v", tt.extra, got, tt.expected)
+		}
+	}
+}
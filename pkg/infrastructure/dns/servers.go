@@ -0,0 +1,149 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultResolvConf is the system resolver configuration file
+const DefaultResolvConf = "/etc/resolv.conf"
+
+// hostnameRegex matches DNS server host names
+var hostnameRegex = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// SystemConfig holds the resolver settings of a resolv.conf file
+type SystemConfig struct {
+	Servers  []string // host:port
+	Search   []string
+	Ndots    int
+	Timeout  time.Duration
+	Attempts int
+}
+
+// LoadSystemConfig reads the nameservers, search domains, ndots, timeout and
+// attempts of a resolv.conf file
+func LoadSystemConfig(path string) (*SystemConfig, error) {
+	config, err := dns.ClientConfigFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	servers := make([]string, 0, len(config.Servers))
+	for _, server := range config.Servers {
+		servers = append(servers, net.JoinHostPort(server, config.Port))
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameservers in %s", path)
+	}
+
+	return &SystemConfig{
+		Servers:  servers,
+		Search:   config.Search,
+		Ndots:    config.Ndots,
+		Timeout:  time.Duration(config.Timeout) * time.Second,
+		Attempts: config.Attempts,
+	}, nil
+}
+
+// ParseServer validates a DNS server and normalizes it. Plain addresses such
+// as "1.1.1.1", "1.1.1.1:53", "2606:4700::1111", "[2606:4700::1111]:53" and
+// "dns.example.com:53" become host:port. URLs select a transport:
+// "udp://1.1.1.1", "tcp://1.1.1.1", "tls://1.1.1.1" (port 853 by default)
+// and "https://cloudflare-dns.com/dns-query".
+func ParseServer(server string) (string, error) {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		return "", fmt.Errorf("empty DNS server address")
+	}
+
+	scheme, address, found := strings.Cut(server, "://")
+	if !found {
+		return parseAddress(server, "53")
+	}
+
+	scheme = strings.ToLower(scheme)
+	switch scheme {
+	case "udp":
+		return parseAddress(address, "53")
+	case "tcp", "tls":
+		defaultPort := "53"
+		if scheme == "tls" {
+			defaultPort = "853"
+		}
+		address, err := parseAddress(address, defaultPort)
+		if err != nil {
+			return "", err
+		}
+		return scheme + "://" + address, nil
+	case "https":
+		u, err := url.Parse(server)
+		if err != nil {
+			return "", fmt.Errorf("invalid DNS server %q: %w", server, err)
+		}
+		if u.Hostname() == "" {
+			return "", fmt.Errorf("invalid DNS server %q: missing host", server)
+		}
+		u.Scheme = "https"
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		return u.String(), nil
+	default:
+		return "", fmt.Errorf("invalid DNS server %q: unsupported transport %q", server, scheme)
+	}
+}
+
+// parseAddress validates a server address and normalizes it to host:port
+func parseAddress(server, defaultPort string) (string, error) {
+	if server == "" {
+		return "", fmt.Errorf("empty DNS server address")
+	}
+
+	// Bare IPv4 or IPv6 address, possibly bracketed
+	if ip := parseIP(strings.TrimSuffix(strings.TrimPrefix(server, "["), "]")); ip != "" {
+		return net.JoinHostPort(ip, defaultPort), nil
+	}
+
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		// A bare host name
+		if !strings.Contains(server, ":") {
+			host, port = server, defaultPort
+		} else {
+			return "", fmt.Errorf("invalid DNS server %q: %w", server, err)
+		}
+	}
+
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		return "", fmt.Errorf("invalid DNS server %q: port must be between 1 and 65535", server)
+	}
+
+	if ip := parseIP(host); ip != "" {
+		return net.JoinHostPort(ip, port), nil
+	}
+	if !hostnameRegex.MatchString(host) {
+		return "", fmt.Errorf("invalid DNS server %q: %q is neither an IP address nor a host name", server, host)
+	}
+	return net.JoinHostPort(strings.ToLower(host), port), nil
+}
+
+// parseIP returns the canonical form of an IP address, keeping an IPv6 zone,
+// or "" if s is not an IP address
+func parseIP(s string) string {
+	address, zone, _ := strings.Cut(s, "%")
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	if zone != "" {
+		return ip.String() + "%" + zone
+	}
+	return ip.String()
+}
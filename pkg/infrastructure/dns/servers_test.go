@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseServer(t *testing.T) {
+	tests := []struct {
+		server   string
+		expected string
+		wantErr  bool
+	}{
+		{"1.1.1.1", "1.1.1.1:53", false},
+		{"1.1.1.1:5353", "1.1.1.1:5353", false},
+		{"2606:4700::1111", "[2606:4700::1111]:53", false},
+		{"[2606:4700::1111]", "[2606:4700::1111]:53", false},
+		{"[2606:4700::1111]:853", "[2606:4700::1111]:853", false},
+		{"fe80::1%eth0", "[fe80::1%eth0]:53", false},
+		{"DNS.Example.com:53", "dns.example.com:53", false},
+		{"dns.example.com", "dns.example.com:53", false},
+		{"udp://1.1.1.1", "1.1.1.1:53", false},
+		{"tcp://1.1.1.1", "tcp://1.1.1.1:53", false},
+		{"TLS://dns.example.com", "tls://dns.example.com:853", false},
+		{"tls://[2606:4700::1111]:8853", "tls://[2606:4700::1111]:8853", false},
+		{"https://cloudflare-dns.com", "https://cloudflare-dns.com/dns-query", false},
+		{"https://dns.example.com:8443/resolve", "https://dns.example.com:8443/resolve", false},
+		{"https:///dns-query", "", true},
+		{"quic://1.1.1.1", "", true},
+		{"tcp://", "", true},
+		{"", "", true},
+		{"1.1.1.1:0", "", true},
+		{"1.1.1.1:99999", "", true},
+		{"1.1.1.1:dns", "", true},
+		{"2606:4700::1111:53:", "", true},
+		{"bad host:53", "", true},
+	}
+
+	for _, tt := range tests {
+		result, err := ParseServer(tt.server)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseServer(%q) error = %v, wantErr %v", tt.server, err, tt.wantErr)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("ParseServer(%q) = %q, want %q", tt.server, result, tt.expected)
+		}
+	}
+}
+
+func TestLoadSystemConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	content := "# corporate resolvers\nnameserver 10.0.0.53\nnameserver 2001:db8::53\nsearch corp.example.com example.com\noptions ndots:2 timeout:3 attempts:4\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write resolv.conf: %v", err)
+	}
+
+	config, err := LoadSystemConfig(path)
+	if err != nil {
+		t.Fatalf("LoadSystemConfig() error = %v", err)
+	}
+
+	if len(config.Servers) != 2 || config.Servers[0] != "10.0.0.53:53" || config.Servers[1] != "[2001:db8::53]:53" {
+		t.Errorf("Servers = %v, want [10.0.0.53:53 [2001:db8::53]:53]", config.Servers)
+	}
+	if len(config.Search) != 2 || config.Search[0] != "corp.example.com" {
+		t.Errorf("Search = %v, want [corp.example.com example.com]", config.Search)
+	}
+	if config.Ndots != 2 || config.Timeout != 3*time.Second || config.Attempts != 4 {
+		t.Errorf("Ndots, Timeout, Attempts = %d, %s, %d, want 2, 3s, 4", config.Ndots, config.Timeout, config.Attempts)
+	}
+
+	if _, err := LoadSystemConfig(filepath.Join(t.TempDir(), "missing.conf")); err == nil {
+		t.Error("LoadSystemConfig() should fail for a missing file")
+	}
+}
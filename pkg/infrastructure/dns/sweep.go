@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"net/netip"
+	"sync"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/miekg/dns"
+)
+
+// DefaultCDNRanges are the IPv4 ranges of the major CDNs (Cloudflare, Fastly,
+// Akamai, CloudFront). Their PTR names belong to the CDN, not to the target.
+var DefaultCDNRanges = []string{
+	// Cloudflare
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+	"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+	"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	// Fastly
+	"23.235.32.0/20", "43.249.72.0/22", "103.244.50.0/24", "103.245.222.0/23",
+	"103.245.224.0/24", "104.156.80.0/20", "140.248.64.0/18", "140.248.128.0/17",
+	"146.75.0.0/17", "151.101.0.0/16", "157.52.64.0/18", "167.82.0.0/17",
+	"172.111.64.0/18", "185.31.16.0/22", "199.27.72.0/21", "199.232.0.0/16",
+	// Akamai
+	"2.16.0.0/13", "23.0.0.0/12", "23.32.0.0/11", "23.64.0.0/14", "95.100.0.0/15",
+	"96.16.0.0/15", "104.64.0.0/10", "184.24.0.0/13", "184.50.0.0/15",
+	// CloudFront
+	"13.32.0.0/15", "13.224.0.0/14", "18.64.0.0/14", "52.84.0.0/15", "54.182.0.0/16",
+	"54.192.0.0/16", "54.230.0.0/16", "54.239.128.0/18", "99.84.0.0/16",
+	"143.204.0.0/16", "205.251.192.0/19",
+}
+
+// MinSweepPrefix is the prefix length of the largest block swept, 1024
+// addresses
+const MinSweepPrefix = 22
+
+// PTRSweeper implements service.PTRSweeper for IPv4 addresses
+type PTRSweeper struct {
+	resolver    service.DNSResolver
+	prefix      int
+	concurrency int
+	skip        []netip.Prefix
+	swept       map[netip.Prefix]bool
+	mu          sync.Mutex
+}
+
+// SweepConfig holds PTR sweeper configuration
+type SweepConfig struct {
+	// PrefixLength is the size of the block swept around each address, at
+	// least MinSweepPrefix
+	PrefixLength int
+	// Concurrency is the number of PTR lookups in flight per block
+	Concurrency int
+	// SkipRanges are CIDR blocks never swept; nil means DefaultCDNRanges
+	SkipRanges []string
+}
+
+// NewPTRSweeper creates a PTR sweeper looking up names with resolver
+func NewPTRSweeper(resolver service.DNSResolver, config SweepConfig) *PTRSweeper {
+	if config.PrefixLength < MinSweepPrefix || config.PrefixLength > 32 {
+		config.PrefixLength = 24
+	}
+
+	if config.Concurrency <= 0 {
+		config.Concurrency = 16
+	}
+
+	if config.SkipRanges == nil {
+		config.SkipRanges = DefaultCDNRanges
+	}
+
+	var skip []netip.Prefix
+	for _, cidr := range config.SkipRanges {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			skip = append(skip, prefix.Masked())
+		}
+	}
+
+	return &PTRSweeper{
+		resolver:    resolver,
+		prefix:      config.PrefixLength,
+		concurrency: config.Concurrency,
+		skip:        skip,
+		swept:       make(map[netip.Prefix]bool),
+	}
+}
+
+// Sweep implements service.PTRSweeper
+func (s *PTRSweeper) Sweep(ip string) *service.PTRSweep {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Unmap().Is4() {
+		return nil
+	}
+	addr = addr.Unmap()
+	block := netip.PrefixFrom(addr, s.prefix).Masked()
+
+	s.mu.Lock()
+	swept := s.swept[block]
+	s.swept[block] = true
+	s.mu.Unlock()
+	if swept || s.skipped(block) {
+		return nil
+	}
+
+	var addrs []netip.Addr
+	for current := block.Addr(); block.Contains(current); current = current.Next() {
+		addrs = append(addrs, current)
+	}
+
+	// Lookups run in parallel; records are kept in address order
+	found := make([][]entity.PTRRecord, len(addrs))
+	messages := make([][]*entity.DNSMessage, len(addrs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(s.concurrency, len(addrs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				found[index], messages[index] = s.lookup(addrs[index])
+			}
+		}()
+	}
+	for index := range addrs {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	sweep := &service.PTRSweep{PTRSweep: entity.PTRSweep{Block: block.String(), Pivot: addr.String(), Queried: len(addrs)}}
+	for index := range addrs {
+		sweep.Records = append(sweep.Records, found[index]...)
+		sweep.Messages = append(sweep.Messages, messages[index]...)
+	}
+	return sweep
+}
+
+// lookup resolves the PTR names of addr, with the messages of the answer
+func (s *PTRSweeper) lookup(addr netip.Addr) ([]entity.PTRRecord, []*entity.DNSMessage) {
+	reverse, err := dns.ReverseAddr(addr.String())
+	if err != nil {
+		return nil, nil
+	}
+
+	resolution, err := s.resolver.ResolveTypes(reverse, []string{"PTR"})
+	if err != nil || resolution == nil {
+		return nil, nil
+	}
+
+	var records []entity.PTRRecord
+	for _, record := range resolution.Records {
+		if record.Type == "PTR" {
+			records = append(records, entity.PTRRecord{IP: addr.String(), Name: record.Value})
+		}
+	}
+	if len(records) == 0 {
+		// Misses would flood the DNS log
+		return nil, nil
+	}
+	return records, resolution.Messages
+}
+
+// skipped checks if block overlaps a range that is never swept
+func (s *PTRSweeper) skipped(block netip.Prefix) bool {
+	for _, skip := range s.skip {
+		if skip.Overlaps(block) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package dns
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+)
+
+func TestPTRSweeper_Sweep(t *testing.T) {
+	resolver := NewResolver(Config{
+		Servers: []string{startTestServer(t, map[string][]string{
+			"1.2.0.192.in-addr.arpa. PTR": {"1.2.0.192.in-addr.arpa. 300 IN PTR mail.example.com."},
+			"3.2.0.192.in-addr.arpa. PTR": {"3.2.0.192.in-addr.arpa. 300 IN PTR vpn.example.com."},
+			"9.2.0.192.in-addr.arpa. PTR": {"9.2.0.192.in-addr.arpa. 300 IN PTR outside.example.com."},
+		})},
+		Timeout: 2 * time.Second,
+	})
+	sweeper := NewPTRSweeper(resolver, SweepConfig{
+		PrefixLength: 29,
+		SkipRanges:   []string{"198.51.100.0/24"},
+	})
+
+	sweep := sweeper.Sweep("192.0.2.2")
+	if sweep == nil {
+		t.Fatal("Sweep(192.0.2.2) = nil, want a sweep of 192.0.2.0/29")
+	}
+	want := []entity.PTRRecord{{IP: "192.0.2.1", Name: "mail.example.com"}, {IP: "192.0.2.3", Name: "vpn.example.com"}}
+	if sweep.Block != "192.0.2.0/29" || sweep.Queried != 8 || !slices.Equal(sweep.Records, want) {
+		t.Errorf("Sweep(192.0.2.2) = %+v, want %v in 8 lookups of 192.0.2.0/29", sweep.PTRSweep, want)
+	}
+	if len(sweep.Messages) != len(want) {
+		t.Errorf("Sweep(192.0.2.2) logged %d messages, want %d", len(sweep.Messages), len(want))
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+	}{
+		{"block swept before", "192.0.2.5"},
+		{"skipped range", "198.51.100.7"},
+		{"ipv6", "2001:db8::1"},
+		{"invalid", "not-an-ip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if sweep := sweeper.Sweep(tt.ip); sweep != nil {
+				t.Errorf("Sweep(%s) = %+v, want nil", tt.ip, sweep.PTRSweep)
+			}
+		})
+	}
+}
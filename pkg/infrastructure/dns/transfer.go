@@ -0,0 +1,165 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/miekg/dns"
+)
+
+// ZoneTransferer implements service.ZoneTransferer
+type ZoneTransferer struct {
+	resolver service.DNSResolver
+	port     string
+	timeout  time.Duration
+	limiter  service.RateLimiter
+}
+
+// TransferConfig holds zone transferer configuration
+type TransferConfig struct {
+	// Port is the port nameservers accept zone transfers on
+	Port    string
+	Timeout time.Duration
+	// Limiter throttles transfers per nameserver; nil disables throttling
+	Limiter service.RateLimiter
+}
+
+// NewZoneTransferer creates a zone transferer looking up nameservers with resolver
+func NewZoneTransferer(resolver service.DNSResolver, config TransferConfig) *ZoneTransferer {
+	if config.Port == "" {
+		config.Port = "53"
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &ZoneTransferer{
+		resolver: resolver,
+		port:     config.Port,
+		timeout:  config.Timeout,
+		limiter:  config.Limiter,
+	}
+}
+
+// Transfer implements service.ZoneTransferer
+func (z *ZoneTransferer) Transfer(zone string) []service.ZoneTransfer {
+	zone = trimDot(strings.TrimSpace(zone))
+
+	var transfers []service.ZoneTransfer
+	for _, nameserver := range lookupNameservers(z.resolver, zone, z.port) {
+		transfer := z.transfer(zone, nameserver.addr)
+		transfer.Nameserver = nameserver.name
+		transfers = append(transfers, transfer)
+	}
+	return transfers
+}
+
+// nameserver is an address of one of the nameservers of a zone
+type nameserver struct {
+	name string
+	addr string
+}
+
+// lookupNameservers resolves the NS records of zone and the addresses of
+// each nameserver
+func lookupNameservers(resolver service.DNSResolver, zone, port string) []nameserver {
+	resolution, err := resolver.ResolveTypes(zone, []string{"NS"})
+	if err != nil {
+		return nil
+	}
+
+	var nameservers []nameserver
+	for _, name := range resolution.NS {
+		addrs, err := resolver.ResolveTypes(name, []string{"A", "AAAA"})
+		if err != nil {
+			continue
+		}
+		for _, ip := range append(addrs.IPs, addrs.IPv6...) {
+			nameservers = append(nameservers, nameserver{name: name, addr: net.JoinHostPort(ip, port)})
+		}
+	}
+	return nameservers
+}
+
+// transfer attempts AXFR against server, falling back to IXFR, which some
+// servers allow while refusing AXFR
+func (z *ZoneTransferer) transfer(zone, server string) service.ZoneTransfer {
+	if z.limiter != nil {
+		z.limiter.Wait(service.RateKey{Kind: service.RateKeyDNSServer, Key: server})
+	}
+
+	names, records, err := z.receive(zone, server, dns.TypeAXFR)
+	transferType := dns.TypeAXFR
+	if err != nil {
+		names, records, err = z.receive(zone, server, dns.TypeIXFR)
+		transferType = dns.TypeIXFR
+	}
+
+	transfer := service.ZoneTransfer{
+		ZoneTransfer: entity.ZoneTransfer{
+			Zone:    zone,
+			Server:  server,
+			Type:    dns.TypeToString[transferType],
+			Allowed: err == nil,
+			Records: records,
+		},
+		Names: names,
+	}
+	if err != nil {
+		transfer.Error = err.Error()
+	}
+	return transfer
+}
+
+// receive runs a single transfer and returns the owner names and the number
+// of records it handed over
+func (z *ZoneTransferer) receive(zone, server string, qtype uint16) ([]string, int, error) {
+	msg := new(dns.Msg)
+	if qtype == dns.TypeIXFR {
+		// Serial 0 predates any version the server has, asking for the whole zone
+		msg.SetIxfr(dns.Fqdn(zone), 0, ".", ".")
+	} else {
+		msg.SetAxfr(dns.Fqdn(zone))
+	}
+
+	transfer := &dns.Transfer{
+		DialTimeout:  z.timeout,
+		ReadTimeout:  z.timeout,
+		WriteTimeout: z.timeout,
+	}
+	envelopes, err := transfer.In(msg, server)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	records := 0
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			// Drain the channel so the transfer goroutine exits
+			err = envelope.Error
+			continue
+		}
+		for _, rr := range envelope.RR {
+			records++
+			name := trimDot(rr.Header().Name)
+			if !seen[name] && !strings.Contains(name, "*") {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if records == 0 {
+		return nil, 0, fmt.Errorf("empty %s response", dns.TypeToString[qtype])
+	}
+	return names, records, nil
+}
@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startTransferServer serves zone transfers of records over TCP on addr,
+// answering only the given transfer type and refusing the other
+func startTransferServer(t *testing.T, addr string, allowed uint16, records []string) string {
+	t.Helper()
+
+	var zone []dns.RR
+	for _, value := range records {
+		rr, err := dns.NewRR(value)
+		if err != nil {
+			t.Fatalf("Failed to parse test record %q: %v", value, err)
+		}
+		zone = append(zone, rr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	handler := func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		if req.Question[0].Qtype != allowed {
+			resp.Rcode = dns.RcodeRefused
+		} else {
+			// A full zone is framed by its SOA record
+			resp.Answer = append(append(append([]dns.RR{}, zone[0]), zone[1:]...), zone[0])
+		}
+		w.WriteMsg(resp)
+	}
+
+	server := &dns.Server{Listener: listener, Handler: dns.HandlerFunc(handler)}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return listener.Addr().String()
+}
+
+func TestZoneTransferer_Transfer(t *testing.T) {
+	records := []string{
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 60",
+		"www.example.com. 300 IN A 93.184.216.34",
+		"internal.example.com. 300 IN A 10.0.0.1",
+		"*.dev.example.com. 300 IN A 10.0.0.2",
+	}
+	axfr := startTransferServer(t, "127.0.0.1:0", dns.TypeAXFR, records)
+	_, port, _ := net.SplitHostPort(axfr)
+	startTransferServer(t, net.JoinHostPort("127.0.0.2", port), dns.TypeIXFR, records)
+	startTransferServer(t, net.JoinHostPort("127.0.0.3", port), dns.TypeNone, records)
+
+	resolver := NewResolver(Config{
+		Servers: []string{startTestServer(t, map[string][]string{
+			"example.com. NS": {
+				"example.com. 300 IN NS ns1.example.com.",
+				"example.com. 300 IN NS ns2.example.com.",
+				"example.com. 300 IN NS ns3.example.com.",
+			},
+			"ns1.example.com. A": {"ns1.example.com. 300 IN A 127.0.0.1"},
+			"ns2.example.com. A": {"ns2.example.com. 300 IN A 127.0.0.2"},
+			"ns3.example.com. A": {"ns3.example.com. 300 IN A 127.0.0.3"},
+		})},
+		Timeout: 2 * time.Second,
+	})
+	transferer := NewZoneTransferer(resolver, TransferConfig{Port: port, Timeout: 2 * time.Second})
+
+	transfers := transferer.Transfer("example.com")
+	if len(transfers) != 3 {
+		t.Fatalf("Transfer(example.com) = %d attempts, want 3", len(transfers))
+	}
+
+	tests := []struct {
+		nameserver string
+		wantType   string
+		allowed    bool
+	}{
+		{"ns1.example.com", "AXFR", true},
+		{"ns2.example.com", "IXFR", true},
+		{"ns3.example.com", "IXFR", false},
+	}
+	wantNames := []string{"example.com", "www.example.com", "internal.example.com"}
+
+	for i, tt := range tests {
+		transfer := transfers[i]
+		if transfer.Nameserver != tt.nameserver || transfer.Type != tt.wantType || transfer.Allowed != tt.allowed {
+			t.Errorf("Transfer()[%d] = %+v, want %s from %s, allowed %v", i, transfer.ZoneTransfer, tt.wantType, tt.nameserver, tt.allowed)
+			continue
+		}
+		if !tt.allowed {
+			if transfer.Error == "" || len(transfer.Names) != 0 {
+				t.Errorf("Transfer()[%d] refused with error %q and names %v", i, transfer.Error, transfer.Names)
+			}
+			continue
+		}
+		// Wildcard owners are not crawlable names
+		if !slices.Equal(transfer.Names, wantNames) || transfer.Records != len(records)+1 {
+			t.Errorf("Transfer()[%d] = %v in %d records, want %v in %d", i, transfer.Names, transfer.Records, wantNames, len(records)+1)
+		}
+	}
+}
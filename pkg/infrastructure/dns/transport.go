@@ -0,0 +1,170 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dohMediaType is the content type of DNS-over-HTTPS messages (RFC 8484)
+const dohMediaType = "application/dns-message"
+
+// transport sends DNS messages to a single server
+type transport interface {
+	exchange(ctx context.Context, msg *dns.Msg) reply
+}
+
+// newTransport creates the transport of a server address or URL. Plain
+// addresses and udp:// URLs use UDP, tcp:// uses TCP, tls:// uses DNS over
+// TLS (RFC 7858) and https:// uses DNS over HTTPS (RFC 8484).
+func newTransport(server string, timeout time.Duration, tlsConfig *tls.Config) transport {
+	scheme, address, found := strings.Cut(server, "://")
+	if !found {
+		scheme, address = "udp", server
+	}
+
+	switch strings.ToLower(scheme) {
+	case "udp":
+		return &clientTransport{
+			name:     "udp",
+			client:   &dns.Client{Net: "udp", Timeout: timeout},
+			fallback: &dns.Client{Net: "tcp", Timeout: timeout},
+			addr:     withDefaultPort(address, "53"),
+		}
+	case "tcp":
+		return &clientTransport{
+			name:   "tcp",
+			client: &dns.Client{Net: "tcp", Timeout: timeout},
+			addr:   withDefaultPort(address, "53"),
+		}
+	case "tls":
+		address = withDefaultPort(address, "853")
+		config := cloneTLSConfig(tlsConfig)
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		return &clientTransport{
+			name:   "tls",
+			client: &dns.Client{Net: "tcp-tls", Timeout: timeout, TLSConfig: config},
+			addr:   address,
+		}
+	case "https":
+		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+		httpTransport.TLSClientConfig = cloneTLSConfig(tlsConfig)
+		return &dohTransport{
+			client: &http.Client{Timeout: timeout, Transport: httpTransport},
+			url:    server,
+		}
+	default:
+		return &failedTransport{err: fmt.Errorf("unsupported DNS transport %q", scheme)}
+	}
+}
+
+// clientTransport speaks DNS over UDP, TCP or TLS
+type clientTransport struct {
+	name   string
+	client *dns.Client
+	// fallback repeats truncated UDP queries over TCP
+	fallback *dns.Client
+	addr     string
+}
+
+func (t *clientTransport) exchange(ctx context.Context, msg *dns.Msg) reply {
+	response, rtt, err := t.client.ExchangeContext(ctx, msg, t.addr)
+	if err != nil || !response.Truncated || t.fallback == nil {
+		return reply{response: response, transport: t.name, rtt: rtt, err: err}
+	}
+
+	// The answer did not fit in a datagram; fetch it whole over TCP
+	full, tcpRTT, err := t.fallback.ExchangeContext(ctx, msg, t.addr)
+	if err != nil {
+		// A truncated answer beats none
+		return reply{response: response, transport: t.name, rtt: rtt}
+	}
+	return reply{response: full, transport: "tcp", rtt: rtt + tcpRTT, tcpFallback: true}
+}
+
+// dohTransport speaks DNS over HTTPS
+type dohTransport struct {
+	client *http.Client
+	url    string
+}
+
+func (t *dohTransport) exchange(ctx context.Context, msg *dns.Msg) reply {
+	response, rtt, err := t.roundTrip(ctx, msg)
+	return reply{response: response, transport: "https", rtt: rtt, err: err}
+}
+
+// roundTrip posts msg to the DoH server
+func (t *dohTransport) roundTrip(ctx context.Context, msg *dns.Msg) (*dns.Msg, time.Duration, error) {
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+
+	start := time.Now()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH server returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	rtt := time.Since(start)
+	if err != nil {
+		return nil, rtt, err
+	}
+
+	reply := new(dns.Msg)
+	if err := reply.Unpack(body); err != nil {
+		return nil, rtt, fmt.Errorf("invalid DoH response: %w", err)
+	}
+	if reply.Id != msg.Id {
+		return nil, rtt, dns.ErrId
+	}
+	return reply, rtt, nil
+}
+
+// failedTransport reports a server that cannot be used
+type failedTransport struct {
+	err error
+}
+
+func (t *failedTransport) exchange(ctx context.Context, msg *dns.Msg) reply {
+	return reply{err: t.err}
+}
+
+// withDefaultPort appends port to an address that has none
+func withDefaultPort(address, port string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), port)
+}
+
+// cloneTLSConfig returns a copy of config, or a new config if it is nil
+func cloneTLSConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		return &tls.Config{}
+	}
+	return config.Clone()
+}
@@ -0,0 +1,191 @@
+package dns
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var transportZone = map[string][]string{
+	"example.com. A": {"example.com. 300 IN A 93.184.216.34"},
+}
+
+// startDoHServer starts an in-process DNS-over-HTTPS server answering from zone
+func startDoHServer(t *testing.T, zone map[string][]string) *httptest.Server {
+	t.Helper()
+
+	handler := zoneHandler(t, zone)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohMediaType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		recorder := &recordingWriter{}
+		handler(recorder, req)
+		packed, _ := recorder.msg.Pack()
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(packed)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// recordingWriter captures the reply of a dns.Handler
+type recordingWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *recordingWriter) WriteMsg(msg *dns.Msg) error {
+	w.msg = msg
+	return nil
+}
+
+// startStreamServer starts an in-process DNS server on a TCP or TLS listener
+func startStreamServer(t *testing.T, listener net.Listener, zone map[string][]string) string {
+	t.Helper()
+
+	server := &dns.Server{Listener: listener, Handler: zoneHandler(t, zone)}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return listener.Addr().String()
+}
+
+// trustServer returns a TLS config trusting the certificate of server
+func trustServer(server *httptest.Server) *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return &tls.Config{RootCAs: roots}
+}
+
+func TestResolver_Transports(t *testing.T) {
+	doh := startDoHServer(t, transportZone)
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	tcp := startStreamServer(t, tcpListener, transportZone)
+
+	// DoT reuses the certificate of the DoH server, which is valid for 127.0.0.1
+	tlsListener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: doh.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	dot := startStreamServer(t, tlsListener, transportZone)
+
+	tests := []struct {
+		name   string
+		server string
+	}{
+		{"udp", "udp://" + startTestServer(t, transportZone)},
+		{"tcp", "tcp://" + tcp},
+		{"tls", "tls://" + dot},
+		{"https", doh.URL + "/dns-query"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewResolver(Config{
+				Servers:   []string{tt.server},
+				Timeout:   2 * time.Second,
+				TLSConfig: trustServer(doh),
+			})
+
+			resolution, err := resolver.ResolveTypes("example.com", []string{"A"})
+			if err != nil {
+				t.Fatalf("ResolveTypes() error = %v", err)
+			}
+			if len(resolution.IPs) != 1 || resolution.IPs[0] != "93.184.216.34" {
+				t.Errorf("ResolveTypes().IPs = %v, want [93.184.216.34]", resolution.IPs)
+			}
+
+			// Every transport logs the same message shape
+			message := resolution.Messages[0]
+			if message.Server != tt.server || message.Request == nil || message.Response == nil || len(message.Response.Answer) != 1 {
+				t.Errorf("Messages[0] = %+v, want request and response from %s", message, tt.server)
+			}
+		})
+	}
+}
+
+func TestResolver_UntrustedDoT(t *testing.T) {
+	doh := startDoHServer(t, transportZone)
+	tlsListener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: doh.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	dot := startStreamServer(t, tlsListener, transportZone)
+
+	// Without trusting the test certificate the handshake must fail
+	resolver := NewResolver(Config{Servers: []string{"tls://" + dot}, Timeout: 2 * time.Second})
+	if _, err := resolver.ResolveTypes("example.com", []string{"A"}); err == nil {
+		t.Error("ResolveTypes() should fail for an untrusted DoT server")
+	}
+}
+
+func TestResolver_TruncatedUDP(t *testing.T) {
+	records := zoneHandler(t, transportZone)
+	var udpSize atomic.Uint32
+	handler := func(w dns.ResponseWriter, req *dns.Msg) {
+		if _, ok := w.RemoteAddr().(*net.UDPAddr); !ok {
+			records(w, req)
+			return
+		}
+		// Pretend the answer does not fit in a datagram
+		if opt := req.IsEdns0(); opt != nil {
+			udpSize.Store(uint32(opt.UDPSize()))
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.Truncated = true
+		w.WriteMsg(resp)
+	}
+
+	// Serve UDP and TCP on the same port
+	addr := startTestHandler(t, handler)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &dns.Server{Listener: listener, Handler: dns.HandlerFunc(handler)}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	resolver := NewResolver(Config{
+		Servers:        []string{addr},
+		Timeout:        2 * time.Second,
+		EDNSBufferSize: 1232,
+	})
+
+	resolution, err := resolver.ResolveTypes("example.com", []string{"A"})
+	if err != nil {
+		t.Fatalf("ResolveTypes() error = %v", err)
+	}
+	if len(resolution.IPs) != 1 || resolution.IPs[0] != "93.184.216.34" {
+		t.Errorf("ResolveTypes().IPs = %v, want [93.184.216.34]", resolution.IPs)
+	}
+	if got := udpSize.Load(); got != 1232 {
+		t.Errorf("advertised UDP size = %d, want 1232", got)
+	}
+
+	message := resolution.Messages[0]
+	if !message.TCPFallback || message.Transport != "tcp" || message.Request.UDPSize != 1232 {
+		t.Errorf("Messages[0] = %+v, want a TCP fallback advertising 1232 bytes", message)
+	}
+}
@@ -0,0 +1,274 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/miekg/dns"
+)
+
+// maxStaleProbes is the number of consecutive NSEC3 probes without new
+// hashes after which the zone is assumed to be fully collected
+const maxStaleProbes = 16
+
+// ZoneWalker implements service.ZoneWalker
+type ZoneWalker struct {
+	resolver   service.DNSResolver
+	port       string
+	timeout    time.Duration
+	limiter    service.RateLimiter
+	wordlist   []string
+	maxQueries int
+	udp        *dns.Client
+	tcp        *dns.Client
+}
+
+// WalkConfig holds zone walker configuration
+type WalkConfig struct {
+	// Port is the port of the zone's nameservers
+	Port    string
+	Timeout time.Duration
+	// Limiter throttles queries per nameserver; nil disables throttling
+	Limiter service.RateLimiter
+	// Wordlist holds the labels matched against NSEC3 hashes
+	Wordlist []string
+	// MaxQueries bounds the queries sent per zone
+	MaxQueries int
+}
+
+// NewZoneWalker creates a zone walker looking up nameservers with resolver
+func NewZoneWalker(resolver service.DNSResolver, config WalkConfig) *ZoneWalker {
+	if config.Port == "" {
+		config.Port = "53"
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	if config.MaxQueries <= 0 {
+		config.MaxQueries = 10000
+	}
+
+	return &ZoneWalker{
+		resolver:   resolver,
+		port:       config.Port,
+		timeout:    config.Timeout,
+		limiter:    config.Limiter,
+		wordlist:   config.Wordlist,
+		maxQueries: config.MaxQueries,
+		udp:        &dns.Client{Net: "udp", Timeout: config.Timeout},
+		tcp:        &dns.Client{Net: "tcp", Timeout: config.Timeout},
+	}
+}
+
+// Walk implements service.ZoneWalker
+func (z *ZoneWalker) Walk(zone string) *service.ZoneWalk {
+	zone = trimDot(strings.TrimSpace(zone))
+
+	nameservers := lookupNameservers(z.resolver, zone, z.port)
+	if len(nameservers) == 0 {
+		return nil
+	}
+
+	walk := &zoneWalk{ZoneWalk: &service.ZoneWalk{ZoneWalk: entity.ZoneWalk{Zone: zone}}}
+	for _, nameserver := range nameservers {
+		walk.servers = append(walk.servers, nameserver.addr)
+	}
+
+	// The denial of existence of a random name tells how the zone is signed
+	response, err := z.query(walk, randomLabel()+"."+zone, dns.TypeA)
+	if err != nil {
+		return nil
+	}
+
+	switch {
+	case len(denials[*dns.NSEC](response)) > 0:
+		walk.Method = "nsec"
+		z.walkNSEC(walk)
+	case len(denials[*dns.NSEC3](response)) > 0:
+		walk.Method = "nsec3"
+		z.walkNSEC3(walk, denials[*dns.NSEC3](response))
+	default:
+		return nil
+	}
+
+	walk.Found = len(walk.Names)
+	return walk.ZoneWalk
+}
+
+// zoneWalk is a walk in progress along with the nameservers still to be
+// tried, the first of which is queried
+type zoneWalk struct {
+	*service.ZoneWalk
+	servers []string
+}
+
+// walkNSEC follows the chain of NSEC records from the apex until it wraps
+// around, recording every owner name
+func (z *ZoneWalker) walkNSEC(walk *zoneWalk) {
+	apex := dns.Fqdn(walk.Zone)
+	seen := map[string]bool{apex: true}
+	walk.Names = append(walk.Names, walk.Zone)
+
+	for current := apex; walk.Queries < z.maxQueries; {
+		next, err := z.nextNSEC(walk, current)
+		if err != nil {
+			walk.Error = err.Error()
+			return
+		}
+
+		next = strings.ToLower(next)
+		if seen[next] || !dns.IsSubDomain(apex, next) {
+			return
+		}
+		seen[next] = true
+		if name := trimDot(next); !strings.ContainsAny(name, "*\\") {
+			walk.Names = append(walk.Names, name)
+		}
+		current = next
+	}
+	walk.Error = fmt.Sprintf("stopped after %d queries", walk.Queries)
+}
+
+// nextNSEC returns the name following current in the NSEC chain. It asks for
+// the NSEC record of current, and if the server does not answer that, for
+// the smallest name after current, whose denial carries the same record.
+func (z *ZoneWalker) nextNSEC(walk *zoneWalk, current string) (string, error) {
+	for _, probe := range []struct {
+		name  string
+		qtype uint16
+	}{
+		{current, dns.TypeNSEC},
+		{"\\000." + current, dns.TypeA},
+	} {
+		response, err := z.query(walk, probe.name, probe.qtype)
+		if err != nil {
+			return "", err
+		}
+		for _, nsec := range append(records[*dns.NSEC](response.Answer), denials[*dns.NSEC](response)...) {
+			if strings.EqualFold(nsec.Hdr.Name, current) {
+				return nsec.NextDomain, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no NSEC record for %s", current)
+}
+
+// walkNSEC3 collects NSEC3 hashes from the denials of random names until no
+// new ones turn up, then matches them against the wordlist
+func (z *ZoneWalker) walkNSEC3(walk *zoneWalk, first []*dns.NSEC3) {
+	params := first[0]
+	walk.Algorithm = params.Hash
+	walk.Iterations = params.Iterations
+	walk.Salt = params.Salt
+
+	hashes := make(map[string]bool)
+	collect := func(nsec3s []*dns.NSEC3) bool {
+		added := false
+		for _, nsec3 := range nsec3s {
+			owner, _, _ := strings.Cut(nsec3.Hdr.Name, ".")
+			for _, hash := range []string{strings.ToUpper(owner), strings.ToUpper(nsec3.NextDomain)} {
+				if !hashes[hash] {
+					hashes[hash] = true
+					added = true
+				}
+			}
+		}
+		return added
+	}
+	collect(first)
+
+	for stale := 0; stale < maxStaleProbes && walk.Queries < z.maxQueries; {
+		response, err := z.query(walk, randomLabel()+"."+walk.Zone, dns.TypeA)
+		if err != nil {
+			walk.Error = err.Error()
+			break
+		}
+		if collect(denials[*dns.NSEC3](response)) {
+			stale = 0
+		} else {
+			stale++
+		}
+	}
+
+	for hash := range hashes {
+		walk.Hashes = append(walk.Hashes, hash)
+	}
+	slices.Sort(walk.Hashes)
+
+	// Hashing is offline work; only the matches are confirmed names
+	for _, label := range append([]string{""}, z.wordlist...) {
+		name := walk.Zone
+		if label != "" {
+			name = label + "." + walk.Zone
+		}
+		if hashes[dns.HashName(dns.Fqdn(name), params.Hash, params.Iterations, params.Salt)] {
+			walk.Names = append(walk.Names, name)
+		}
+	}
+}
+
+// query sends a DNSSEC-enabled query to the walked nameserver. A nameserver
+// that fails or refuses is given up for the rest of the walk and the query
+// goes to the next one, as zone transfers try every nameserver.
+func (z *ZoneWalker) query(walk *zoneWalk, name string, qtype uint16) (*dns.Msg, error) {
+	err := fmt.Errorf("no nameserver of %s answered", walk.Zone)
+	for len(walk.servers) > 0 {
+		var response *dns.Msg
+		if response, err = z.queryServer(walk, walk.servers[0], name, qtype); err == nil {
+			walk.Server = walk.servers[0]
+			return response, nil
+		}
+		walk.servers = walk.servers[1:]
+	}
+	return nil, err
+}
+
+// queryServer sends a DNSSEC-enabled query to server
+func (z *ZoneWalker) queryServer(walk *zoneWalk, server, name string, qtype uint16) (*dns.Msg, error) {
+	walk.Queries++
+	if z.limiter != nil {
+		z.limiter.Wait(service.RateKey{Kind: service.RateKeyDNSServer, Key: server})
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.RecursionDesired = false
+	msg.SetEdns0(dns.DefaultMsgSize, true)
+
+	transport := &clientTransport{name: "udp", client: z.udp, fallback: z.tcp, addr: server}
+	ctx, cancel := context.WithTimeout(context.Background(), z.timeout)
+	reply := transport.exchange(ctx, msg)
+	cancel()
+
+	if reply.err != nil {
+		return nil, reply.err
+	}
+	switch rcode := reply.response.Rcode; rcode {
+	case dns.RcodeServerFailure, dns.RcodeRefused, dns.RcodeNotAuth:
+		return nil, fmt.Errorf("%s answered %s", server, dns.RcodeToString[rcode])
+	}
+	return reply.response, nil
+}
+
+// denials returns the records of type T in the authority section
+func denials[T dns.RR](response *dns.Msg) []T {
+	return records[T](response.Ns)
+}
+
+// records returns the records of type T in rrs
+func records[T dns.RR](rrs []dns.RR) []T {
+	var matched []T
+	for _, rr := range rrs {
+		if typed, ok := rr.(T); ok {
+			matched = append(matched, typed)
+		}
+	}
+	return matched
+}
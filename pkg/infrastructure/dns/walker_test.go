@@ -0,0 +1,213 @@
+package dns
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// signedZone serves the NSEC or NSEC3 records of a signed zone holding names
+type signedZone struct {
+	names []string // In canonical order, apex first
+	nsec3 bool
+	// answerNSEC answers NSEC queries; otherwise only denials carry NSEC records
+	answerNSEC bool
+}
+
+const (
+	testSalt       = "AABBCCDD"
+	testIterations = 2
+)
+
+func (s *signedZone) handler(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Authoritative = true
+	q := req.Question[0]
+
+	if s.nsec3 {
+		// Every denial carries the whole chain, which is plenty for a test
+		resp.Rcode = dns.RcodeNameError
+		for i, name := range s.names {
+			next := s.names[(i+1)%len(s.names)]
+			resp.Ns = append(resp.Ns, &dns.NSEC3{
+				Hdr:        dns.RR_Header{Name: dns.HashName(name, dns.SHA1, testIterations, testSalt) + "." + s.names[0], Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+				Hash:       dns.SHA1,
+				Iterations: testIterations,
+				SaltLength: uint8(len(testSalt) / 2),
+				Salt:       testSalt,
+				HashLength: 20,
+				NextDomain: dns.HashName(next, dns.SHA1, testIterations, testSalt),
+				TypeBitMap: []uint16{dns.TypeA},
+			})
+		}
+		w.WriteMsg(resp)
+		return
+	}
+
+	// The NSEC record owned by the queried name, or by the name a
+	// "\000." probe sorts right after; anything else gets the apex's
+	owner := strings.ToLower(strings.TrimPrefix(q.Name, "\\000."))
+	index := slices.Index(s.names, owner)
+	exists := index >= 0 && owner == strings.ToLower(q.Name)
+	if index < 0 {
+		index = 0
+	}
+	nsec := &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: s.names[index], Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+		NextDomain: s.names[(index+1)%len(s.names)],
+		TypeBitMap: []uint16{dns.TypeA, dns.TypeNSEC},
+	}
+
+	switch {
+	case exists && q.Qtype == dns.TypeNSEC && s.answerNSEC:
+		resp.Answer = append(resp.Answer, nsec)
+	case exists:
+		// No data of that type
+		resp.Ns = append(resp.Ns, nsec)
+	default:
+		resp.Rcode = dns.RcodeNameError
+		resp.Ns = append(resp.Ns, nsec)
+	}
+	w.WriteMsg(resp)
+}
+
+func TestZoneWalker_Walk(t *testing.T) {
+	names := []string{"example.com.", "api.example.com.", "secret.example.com.", "www.example.com."}
+
+	tests := []struct {
+		name      string
+		zone      *signedZone
+		want      []string
+		wantTotal int // Hashes collected
+	}{
+		{
+			name: "nsec answers",
+			zone: &signedZone{names: names, answerNSEC: true},
+			want: []string{"example.com", "api.example.com", "secret.example.com", "www.example.com"},
+		},
+		{
+			name: "nsec denials",
+			zone: &signedZone{names: names},
+			want: []string{"example.com", "api.example.com", "secret.example.com", "www.example.com"},
+		},
+		{
+			// "secret" is not in the wordlist, so its hash stays uncracked
+			name:      "nsec3",
+			zone:      &signedZone{names: names, nsec3: true},
+			want:      []string{"example.com", "www.example.com", "api.example.com"},
+			wantTotal: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(tt.zone.handler)}
+			go server.ActivateAndServe()
+			t.Cleanup(func() { server.Shutdown() })
+			_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+
+			resolver := NewResolver(Config{
+				Servers: []string{startTestServer(t, map[string][]string{
+					"example.com. NS":    {"example.com. 300 IN NS ns1.example.com."},
+					"ns1.example.com. A": {"ns1.example.com. 300 IN A 127.0.0.1"},
+				})},
+				Timeout: 2 * time.Second,
+			})
+			walker := NewZoneWalker(resolver, WalkConfig{
+				Port:     port,
+				Timeout:  2 * time.Second,
+				Wordlist: []string{"www", "mail", "api"},
+			})
+
+			walk := walker.Walk("example.com")
+			if walk == nil {
+				t.Fatal("Walk(example.com) = nil, want a signed zone")
+			}
+			if !slices.Equal(walk.Names, tt.want) || walk.Found != len(tt.want) {
+				t.Errorf("Walk(example.com).Names = %v, want %v", walk.Names, tt.want)
+			}
+			if len(walk.Hashes) != tt.wantTotal {
+				t.Errorf("Walk(example.com).Hashes = %d, want %d", len(walk.Hashes), tt.wantTotal)
+			}
+			if tt.zone.nsec3 && (walk.Iterations != testIterations || !strings.EqualFold(walk.Salt, testSalt)) {
+				t.Errorf("Walk(example.com) parameters = %d, %s, want %d, %s", walk.Iterations, walk.Salt, testIterations, testSalt)
+			}
+		})
+	}
+}
+
+func TestZoneWalker_Unsigned(t *testing.T) {
+	resolver := NewResolver(Config{
+		Servers: []string{startTestServer(t, map[string][]string{
+			"example.com. NS":    {"example.com. 300 IN NS ns1.example.com."},
+			"ns1.example.com. A": {"ns1.example.com. 300 IN A 127.0.0.1"},
+		})},
+		Timeout: 2 * time.Second,
+	})
+	_, port, _ := net.SplitHostPort(startTestServer(t, nil))
+	walker := NewZoneWalker(resolver, WalkConfig{Port: port, Timeout: 2 * time.Second})
+
+	if walk := walker.Walk("example.com"); walk != nil {
+		t.Errorf("Walk(example.com) = %+v, want nil for an unsigned zone", walk)
+	}
+}
+
+func TestZoneWalker_Fallback(t *testing.T) {
+	names := []string{"example.com.", "www.example.com."}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	signed := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc((&signedZone{names: names}).handler)}
+	go signed.ActivateAndServe()
+	t.Cleanup(func() { signed.Shutdown() })
+
+	// The first nameserver refuses every query on the same port
+	var refused atomic.Int32
+	lame, err := net.ListenPacket("udp", net.JoinHostPort("127.0.0.2", port))
+	if err != nil {
+		t.Skipf("Cannot listen on 127.0.0.2: %v", err)
+	}
+	refusing := &dns.Server{PacketConn: lame, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		refused.Add(1)
+		resp := new(dns.Msg)
+		resp.SetRcode(req, dns.RcodeRefused)
+		w.WriteMsg(resp)
+	})}
+	go refusing.ActivateAndServe()
+	t.Cleanup(func() { refusing.Shutdown() })
+
+	resolver := NewResolver(Config{
+		Servers: []string{startTestServer(t, map[string][]string{
+			"example.com. NS":    {"example.com. 300 IN NS ns1.example.com."},
+			"ns1.example.com. A": {"ns1.example.com. 300 IN A 127.0.0.2", "ns1.example.com. 300 IN A 127.0.0.1"},
+		})},
+		Timeout: 2 * time.Second,
+	})
+	walker := NewZoneWalker(resolver, WalkConfig{Port: port, Timeout: 2 * time.Second})
+
+	walk := walker.Walk("example.com")
+	if walk == nil {
+		t.Fatal("Walk(example.com) = nil, want the walk of the second nameserver")
+	}
+	if want := []string{"example.com", "www.example.com"}; !slices.Equal(walk.Names, want) {
+		t.Errorf("Walk(example.com).Names = %v, want %v", walk.Names, want)
+	}
+	if want := net.JoinHostPort("127.0.0.1", port); walk.Server != want {
+		t.Errorf("Walk(example.com).Server = %s, want %s", walk.Server, want)
+	}
+	if n := refused.Load(); n != 1 {
+		t.Errorf("Refusing nameserver queried %d times, want once before it is given up", n)
+	}
+}
@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// WildcardDetector implements service.WildcardDetector
+type WildcardDetector struct {
+	resolver service.DNSResolver
+	probes   int
+	cache    map[string]*wildcardEntry
+	mu       sync.Mutex
+}
+
+// wildcardEntry caches the probe result of a single parent domain
+type wildcardEntry struct {
+	once        sync.Once
+	fingerprint *service.WildcardFingerprint
+}
+
+// WildcardConfig holds wildcard detector configuration
+type WildcardConfig struct {
+	// Probes is the number of random labels resolved per parent domain
+	Probes int
+}
+
+// NewWildcardDetector creates a new wildcard detector
+func NewWildcardDetector(resolver service.DNSResolver, config WildcardConfig) *WildcardDetector {
+	if config.Probes <= 0 {
+		config.Probes = 2
+	}
+
+	return &WildcardDetector{
+		resolver: resolver,
+		probes:   config.Probes,
+		cache:    make(map[string]*wildcardEntry),
+	}
+}
+
+// Fingerprint implements service.WildcardDetector
+func (d *WildcardDetector) Fingerprint(parent string) *service.WildcardFingerprint {
+	parent = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(parent), "."))
+
+	d.mu.Lock()
+	entry, ok := d.cache[parent]
+	if !ok {
+		entry = &wildcardEntry{}
+		d.cache[parent] = entry
+	}
+	d.mu.Unlock()
+
+	// Concurrent callers for the same parent wait for a single probe
+	entry.once.Do(func() {
+		entry.fingerprint = d.probe(parent)
+	})
+
+	return entry.fingerprint
+}
+
+// IsWildcard implements service.WildcardDetector
+func (d *WildcardDetector) IsWildcard(domain, root string, resolution *service.DNSResolution) bool {
+	if resolution == nil {
+		return false
+	}
+
+	ips, cnames := fingerprintValues(resolution)
+	if len(ips) == 0 && len(cnames) == 0 {
+		return false
+	}
+
+	for _, parent := range parentDomains(domain, root) {
+		fingerprint := d.Fingerprint(parent)
+		if fingerprint == nil {
+			continue
+		}
+		if intersects(ips, fingerprint.IPs) || intersects(cnames, fingerprint.CNAMEs) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// probe resolves random labels under parent and merges their answers
+func (d *WildcardDetector) probe(parent string) *service.WildcardFingerprint {
+	fingerprint := &service.WildcardFingerprint{Parent: parent}
+
+	for i := 0; i < d.probes; i++ {
+		resolution, err := d.resolver.ResolveTypes(randomLabel()+"."+parent, AddressRecordTypes)
+		if err != nil || resolution == nil {
+			continue
+		}
+
+		ips, cnames := fingerprintValues(resolution)
+		fingerprint.IPs = appendUnique(fingerprint.IPs, ips...)
+		fingerprint.CNAMEs = appendUnique(fingerprint.CNAMEs, cnames...)
+	}
+
+	if len(fingerprint.IPs) == 0 && len(fingerprint.CNAMEs) == 0 {
+		return nil
+	}
+
+	return fingerprint
+}
+
+// fingerprintValues extracts the IPv4/IPv6 addresses and CNAME targets of a resolution
+func fingerprintValues(resolution *service.DNSResolution) ([]string, []string) {
+	ips := make([]string, 0, len(resolution.IPs)+len(resolution.IPv6))
+	ips = append(ips, resolution.IPs...)
+	ips = append(ips, resolution.IPv6...)
+	return ips, resolution.CNAMEs
+}
+
+// parentDomains returns the strict parents of domain, nearest first, stopping at root
+func parentDomains(domain, root string) []string {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	root = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(root), "."))
+
+	if domain == root || !strings.HasSuffix(domain, "."+root) {
+		return nil
+	}
+
+	var parents []string
+	labels := strings.Split(strings.TrimSuffix(domain, "."+root), ".")
+	for i := 1; i < len(labels); i++ {
+		parents = append(parents, strings.Join(labels[i:], ".")+"."+root)
+	}
+	parents = append(parents, root)
+
+	return parents
+}
+
+// randomLabel returns a random DNS label that is unlikely to exist
+func randomLabel() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// intersects checks if two string slices share any element
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appendUnique appends values that are not already present in slice
+func appendUnique(slice []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range slice {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			slice = append(slice, value)
+		}
+	}
+	return slice
+}
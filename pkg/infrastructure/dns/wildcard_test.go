@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// fakeResolver answers from a static table and treats "*.<parent>" keys as wildcards
+type fakeResolver struct {
+	records map[string][]string
+	queries atomic.Int64
+}
+
+func (f *fakeResolver) Resolve(domain string) ([]string, error) {
+	resolution, err := f.ResolveWithDetails(domain)
+	if err != nil {
+		return nil, err
+	}
+	return resolution.IPs, nil
+}
+
+func (f *fakeResolver) ResolveWithDetails(domain string) (*service.DNSResolution, error) {
+	return f.ResolveTypes(domain, DefaultRecordTypes)
+}
+
+func (f *fakeResolver) ResolveTypes(domain string, recordTypes []string) (*service.DNSResolution, error) {
+	f.queries.Add(1)
+
+	ips, ok := f.records[domain]
+	if !ok {
+		if i := strings.Index(domain, "."); i >= 0 {
+			ips = f.records["*"+domain[i:]]
+		}
+	}
+
+	return &service.DNSResolution{Domain: domain, IPs: ips}, nil
+}
+
+func TestWildcardDetector_Fingerprint(t *testing.T) {
+	resolver := &fakeResolver{records: map[string][]string{
+		"*.example.com": {"10.0.0.1"},
+	}}
+	detector := NewWildcardDetector(resolver, WildcardConfig{Probes: 2})
+
+	fingerprint := detector.Fingerprint("example.com")
+	if fingerprint == nil {
+		t.Fatal("Fingerprint(example.com) should detect wildcard")
+	}
+	if len(fingerprint.IPs) != 1 || fingerprint.IPs[0] != "10.0.0.1" {
+		t.Errorf("Fingerprint(example.com).IPs = %v, want [10.0.0.1]", fingerprint.IPs)
+	}
+
+	if detector.Fingerprint("test.com") != nil {
+		t.Error("Fingerprint(test.com) should be nil for non-wildcard parent")
+	}
+
+	// Fingerprints are cached per parent
+	queries := resolver.queries.Load()
+	detector.Fingerprint("example.com")
+	if resolver.queries.Load() != queries {
+		t.Error("Fingerprint should not probe a cached parent again")
+	}
+}
+
+func TestWildcardDetector_IsWildcard(t *testing.T) {
+	resolver := &fakeResolver{records: map[string][]string{
+		"*.example.com":     {"10.0.0.1"},
+		"*.dev.example.com": {"10.0.0.2"},
+	}}
+	detector := NewWildcardDetector(resolver, WildcardConfig{})
+
+	tests := []struct {
+		name     string
+		domain   string
+		ips      []string
+		expected bool
+	}{
+		{"matches root wildcard", "junk.example.com", []string{"10.0.0.1"}, true},
+		{"matches intermediate wildcard", "junk.dev.example.com", []string{"10.0.0.2"}, true},
+		{"distinct address", "www.example.com", []string{"93.184.216.34"}, false},
+		{"root itself", "example.com", []string{"10.0.0.1"}, false},
+		{"no addresses", "api.example.com", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolution := &service.DNSResolution{Domain: tt.domain, IPs: tt.ips}
+			result := detector.IsWildcard(tt.domain, "example.com", resolution)
+			if result != tt.expected {
+				t.Errorf("IsWildcard(%s) = %v, want %v", tt.domain, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParentDomains(t *testing.T) {
+	parents := parentDomains("a.b.example.com", "example.com")
+	expected := []string{"b.example.com", "example.com"}
+
+	if len(parents) != len(expected) {
+		t.Fatalf("parentDomains() = %v, want %v", parents, expected)
+	}
+	for i := range expected {
+		if parents[i] != expected[i] {
+			t.Errorf("parentDomains()[%d] = %s, want %s", i, parents[i], expected[i])
+		}
+	}
+}
@@ -3,8 +3,10 @@ package domainservice
 import (
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
 	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
 	"golang.org/x/net/html"
 	"golang.org/x/net/publicsuffix"
@@ -125,12 +127,18 @@ func (c *Calculator) GetDistance(domain, root string) int {
 // Extractor implements service.DomainExtractor
 type Extractor struct {
 	domainRegex *regexp.Regexp
+	exactRegex  *regexp.Regexp
+	cookieRegex *regexp.Regexp
+	altSvcRegex *regexp.Regexp
 }
 
 // NewExtractor creates a new domain extractor
 func NewExtractor() service.DomainExtractor {
 	return &Extractor{
 		domainRegex: regexp.MustCompile(`(?i)(?:[a-zA-Z0-9](?:[a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}`),
+		exactRegex:  regexp.MustCompile(`(?i)^(?:[a-zA-Z0-9](?:[a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}$`),
+		cookieRegex: regexp.MustCompile(`(?i)\bdomain\s*=\s*\.?([^;,\s]+)`),
+		altSvcRegex: regexp.MustCompile(`="([^"]*)"`),
 	}
 }
 
@@ -230,3 +238,205 @@ func (e *Extractor) ExtractTitle(html string) string {
 	}
 	return ""
 }
+
+// ExtractFromDNSRecords extracts domains from DNS record data
+func (e *Extractor) ExtractFromDNSRecords(records []service.DNSRecord) []service.Discovery {
+	var discoveries []service.Discovery
+	seen := make(map[string]bool)
+
+	for _, record := range records {
+		var candidates []string
+		switch strings.ToUpper(record.Type) {
+		case "CNAME", "MX", "NS", "PTR", "SRV":
+			candidates = e.ExtractFromText(record.Value)
+		case "SOA":
+			// Only the primary nameserver; the mailbox is an encoded address
+			if fields := strings.Fields(record.Value); len(fields) > 0 {
+				candidates = e.ExtractFromText(fields[0])
+			}
+		case "TXT":
+			candidates = e.extractFromTXT(record.Value)
+		default:
+			continue
+		}
+
+		source := service.SourceDNSPrefix + strings.ToLower(record.Type)
+		for _, candidate := range candidates {
+			candidate = strings.TrimSuffix(candidate, ".")
+			if !seen[candidate] {
+				seen[candidate] = true
+				discoveries = append(discoveries, service.Discovery{Domain: candidate, Source: source})
+			}
+		}
+	}
+
+	return discoveries
+}
+
+// extractFromTXT extracts hostnames from TXT data such as SPF mechanisms
+// (include:, a:, mx:, redirect=) and DMARC report addresses (mailto:x@host).
+// Each token must be a complete hostname, so "_spf.example.com" is not
+// truncated to "spf.example.com".
+func (e *Extractor) extractFromTXT(txt string) []string {
+	var domains []string
+	seen := make(map[string]bool)
+
+	tokens := strings.FieldsFunc(txt, func(r rune) bool {
+		switch r {
+		case ' ', '\t', ':', '=', '@', ',', ';', '"', '!':
+			return true
+		}
+		return false
+	})
+
+	for _, token := range tokens {
+		// Drop CIDR suffixes such as a:mail.example.com/24
+		if i := strings.Index(token, "/"); i >= 0 {
+			token = token[:i]
+		}
+		token = strings.ToLower(strings.TrimSuffix(token, "."))
+		if token != "" && !seen[token] && e.exactRegex.MatchString(token) {
+			seen[token] = true
+			domains = append(domains, token)
+		}
+	}
+
+	return domains
+}
+
+// ExtractFromCertificate extracts domains from certificate SANs and CN.
+// Wildcard names such as "*.api.example.com" yield their base domain.
+func (e *Extractor) ExtractFromCertificate(cert *entity.TLSCertificate) []service.Discovery {
+	if cert == nil {
+		return nil
+	}
+
+	var discoveries []service.Discovery
+	seen := make(map[string]bool)
+
+	add := func(name, source string) {
+		name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+		if strings.HasPrefix(name, "*.") {
+			name = strings.TrimPrefix(name, "*.")
+			source = service.SourceTLSWildcard
+		}
+		if name != "" && !seen[name] && e.exactRegex.MatchString(name) {
+			seen[name] = true
+			discoveries = append(discoveries, service.Discovery{Domain: name, Source: source})
+		}
+	}
+
+	for _, name := range cert.DNSNames {
+		add(name, service.SourceTLSSAN)
+	}
+	add(cert.CommonName, service.SourceTLSCN)
+
+	return discoveries
+}
+
+// ExtractFromHeaders extracts domains from HTTP response headers. Headers that
+// carry URLs or hostnames in a known syntax (Location, CSP, CORS, Link,
+// Set-Cookie, Alt-Svc) are parsed; all other header values are scanned as text.
+func (e *Extractor) ExtractFromHeaders(headers map[string]string) []service.Discovery {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var discoveries []service.Discovery
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+		value := headers[name]
+		lowerName := strings.ToLower(name)
+
+		var tokens []string
+		switch lowerName {
+		case "location", "content-location", "access-control-allow-origin", "origin", "referer":
+			tokens = []string{value}
+		case "content-security-policy", "content-security-policy-report-only":
+			tokens = strings.FieldsFunc(value, func(r rune) bool {
+				return r == ' ' || r == ';' || r == '\t'
+			})
+		case "link":
+			for _, part := range strings.Split(value, ",") {
+				start := strings.Index(part, "<")
+				end := strings.Index(part, ">")
+				if start >= 0 && end > start {
+					tokens = append(tokens, part[start+1:end])
+				}
+			}
+		case "set-cookie":
+			for _, match := range e.cookieRegex.FindAllStringSubmatch(value, -1) {
+				tokens = append(tokens, match[1])
+			}
+		case "alt-svc":
+			for _, match := range e.altSvcRegex.FindAllStringSubmatch(value, -1) {
+				tokens = append(tokens, match[1])
+			}
+		default:
+			tokens = e.ExtractFromText(value)
+		}
+
+		source := service.SourceHTTPHeaderPrefix + lowerName
+		for _, token := range tokens {
+			host := e.hostFromToken(token)
+			if host != "" && !seen[host] {
+				seen[host] = true
+				discoveries = append(discoveries, service.Discovery{Domain: host, Source: source})
+			}
+		}
+	}
+
+	return discoveries
+}
+
+// ExtractFromRedirects extracts domains from the hops of a redirect chain
+func (e *Extractor) ExtractFromRedirects(hops []entity.HTTPHop) []service.Discovery {
+	var discoveries []service.Discovery
+	seen := make(map[string]bool)
+
+	for _, hop := range hops {
+		for _, token := range []string{hop.URL, hop.Location} {
+			host := e.hostFromToken(token)
+			if host != "" && !seen[host] {
+				seen[host] = true
+				discoveries = append(discoveries, service.Discovery{Domain: host, Source: service.SourceHTTPRedirect})
+			}
+		}
+	}
+
+	return discoveries
+}
+
+// hostFromToken extracts the hostname of a URL, origin, CSP source or
+// authority token, returning "" if the token holds no valid hostname
+func (e *Extractor) hostFromToken(token string) string {
+	token = strings.Trim(strings.TrimSpace(token), `"'<>`)
+
+	// Strip scheme, userinfo, path, query and fragment
+	if i := strings.Index(token, "://"); i >= 0 {
+		token = token[i+3:]
+	} else if strings.HasPrefix(token, "//") {
+		token = token[2:]
+	}
+	if i := strings.IndexAny(token, "/?#"); i >= 0 {
+		token = token[:i]
+	}
+	if i := strings.LastIndex(token, "@"); i >= 0 {
+		token = token[i+1:]
+	}
+
+	// Strip port and CSP wildcard prefix
+	if i := strings.LastIndex(token, ":"); i >= 0 {
+		token = token[:i]
+	}
+	token = strings.TrimPrefix(token, "*.")
+	token = strings.ToLower(strings.TrimSuffix(token, "."))
+
+	if !e.exactRegex.MatchString(token) {
+		return ""
+	}
+	return token
+}
@@ -1,7 +1,13 @@
 package domainservice
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
 )
 
 func TestValidator_IsValid(t *testing.T) {
@@ -356,3 +362,232 @@ func TestExtractor_ExtractFromHTML(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractor_ExtractFromDNSRecords(t *testing.T) {
+	extractor := NewExtractor()
+
+	records := []service.DNSRecord{
+		{Type: "CNAME", Value: "www.example.com.cdn.net"},
+		{Type: "MX", Value: "mx1.example.com"},
+		{Type: "NS", Value: "ns1.example.com"},
+		{Type: "TXT", Value: "v=spf1 include:_spf.example.com a:mail.example.com/24 ip4:10.0.0.0/8 ~all"},
+		{Type: "TXT", Value: "v=DMARC1; p=none; rua=mailto:dmarc@reports.example.com"},
+		{Type: "SOA", Value: "ns0.example.com hostmaster.example.com 1 7200 3600 1209600 300"},
+		{Type: "A", Value: "93.184.216.34"},
+	}
+
+	expected := map[string]string{
+		"www.example.com.cdn.net": "dns:cname",
+		"mx1.example.com":         "dns:mx",
+		"ns1.example.com":         "dns:ns",
+		"mail.example.com":        "dns:txt",
+		"reports.example.com":     "dns:txt",
+		"ns0.example.com":         "dns:soa",
+	}
+
+	result := extractor.ExtractFromDNSRecords(records)
+	if len(result) != len(expected) {
+		t.Errorf("ExtractFromDNSRecords() returned %d discoveries, want %d: %v", len(result), len(expected), result)
+	}
+
+	for _, discovery := range result {
+		source, ok := expected[discovery.Domain]
+		if !ok {
+			t.Errorf("ExtractFromDNSRecords() extracted unexpected domain %s", discovery.Domain)
+			continue
+		}
+		if discovery.Source != source {
+			t.Errorf("ExtractFromDNSRecords() source of %s = %s, want %s", discovery.Domain, discovery.Source, source)
+		}
+	}
+}
+
+func TestExtractor_ExtractFromCertificate(t *testing.T) {
+	extractor := NewExtractor()
+
+	cert := &entity.TLSCertificate{
+		CommonName: "www.example.com",
+		DNSNames:   []string{"www.example.com", "api.example.com", "*.dev.example.com"},
+	}
+
+	expected := map[string]string{
+		"www.example.com": "tls:san",
+		"api.example.com": "tls:san",
+		"dev.example.com": "tls:wildcard",
+	}
+
+	result := extractor.ExtractFromCertificate(cert)
+	if len(result) != len(expected) {
+		t.Errorf("ExtractFromCertificate() returned %d discoveries, want %d: %v", len(result), len(expected), result)
+	}
+
+	for _, discovery := range result {
+		if source := expected[discovery.Domain]; discovery.Source != source {
+			t.Errorf("ExtractFromCertificate() source of %s = %s, want %s", discovery.Domain, discovery.Source, source)
+		}
+	}
+}
+
+func TestExtractor_ExtractFromHeaders(t *testing.T) {
+	extractor := NewExtractor()
+
+	headers := map[string]string{
+		"Location":                    "https://login.example.com:8443/auth?next=/",
+		"Content-Security-Policy":     "default-src 'self' https://cdn.example.com; img-src *.img.example.com data:",
+		"Access-Control-Allow-Origin": "https://app.example.com",
+		"Link":                        "<https://fonts.example.com/css>; rel=preconnect, </local>; rel=preload",
+		"Set-Cookie":                  "sid=1; Domain=.sso.example.com; Path=/; Secure",
+		"Alt-Svc":                     `h3=":443"; ma=86400, h3="alt.example.com:443"`,
+		"X-Backend":                   "node7.internal.example.com",
+		"Date":                        "Mon, 02 Jan 2006 15:04:05 GMT",
+	}
+
+	expected := map[string]string{
+		"login.example.com":          "http:header:location",
+		"cdn.example.com":            "http:header:content-security-policy",
+		"img.example.com":            "http:header:content-security-policy",
+		"app.example.com":            "http:header:access-control-allow-origin",
+		"fonts.example.com":          "http:header:link",
+		"sso.example.com":            "http:header:set-cookie",
+		"alt.example.com":            "http:header:alt-svc",
+		"node7.internal.example.com": "http:header:x-backend",
+	}
+
+	result := extractor.ExtractFromHeaders(headers)
+	if len(result) != len(expected) {
+		t.Errorf("ExtractFromHeaders() returned %d discoveries, want %d: %v", len(result), len(expected), result)
+	}
+
+	for _, discovery := range result {
+		source, ok := expected[discovery.Domain]
+		if !ok {
+			t.Errorf("ExtractFromHeaders() extracted unexpected domain %s", discovery.Domain)
+			continue
+		}
+		if discovery.Source != source {
+			t.Errorf("ExtractFromHeaders() source of %s = %s, want %s", discovery.Domain, discovery.Source, source)
+		}
+	}
+}
+
+func TestTaskPolicy_Less(t *testing.T) {
+	policy := NewTaskPolicy(DefaultBoostedSources)
+
+	task := func(depth int, source string) *entity.Task {
+		return &entity.Task{Domain: entity.Domain{Depth: depth}, Source: source}
+	}
+
+	tests := []struct {
+		name     string
+		a, b     *entity.Task
+		expected bool
+	}{
+		{"shallower first", task(1, service.SourceHTTPBody), task(2, service.SourceTLSSAN), true},
+		{"deeper later", task(2, service.SourceTLSSAN), task(1, service.SourceHTTPBody), false},
+		{"certificate before body", task(1, service.SourceTLSSAN), task(1, service.SourceHTTPBody), true},
+		{"dns before body", task(1, service.SourceDNSPrefix+"CNAME"), task(1, service.SourceHTTPBody), true},
+		{"body after dns", task(1, service.SourceHTTPBody), task(1, service.SourceDNSPrefix+"MX"), false},
+		{"equal sources", task(1, service.SourceTLSSAN), task(1, service.SourceTLSCN), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := policy.Less(tt.a, tt.b)
+			if result != tt.expected {
+				t.Errorf("Less(%s, %s) = %v, want %v", tt.a.Source, tt.b.Source, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWordlist_Each(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+	os.WriteFile(first, []byte("www\n\n# comment\n  API \n"), 0o644)
+	os.WriteFile(second, []byte("dev.internal.\nmail\n"), 0o644)
+
+	wordlist := NewWordlist([]string{first, second})
+
+	var labels []string
+	if err := wordlist.Each(func(label string) bool {
+		labels = append(labels, label)
+		return true
+	}); err != nil {
+		t.Fatalf("Each() error = %v", err)
+	}
+	if want := []string{"www", "api", "dev.internal", "mail"}; !slices.Equal(labels, want) {
+		t.Errorf("Each() labels = %v, want %v", labels, want)
+	}
+
+	// Returning false stops the iteration
+	labels = nil
+	wordlist.Each(func(label string) bool {
+		labels = append(labels, label)
+		return len(labels) < 3
+	})
+	if len(labels) != 3 {
+		t.Errorf("Each() after stop = %v, want 3 labels", labels)
+	}
+
+	if err := NewWordlist([]string{filepath.Join(dir, "missing.txt")}).Each(func(string) bool { return true }); err == nil {
+		t.Error("Each() on a missing file should fail")
+	}
+}
+
+func TestPermutator_Permute(t *testing.T) {
+	permutator := NewPermutator(PermutatorConfig{Words: []string{}})
+	permutator.Permute("staging.example.com", "example.com")
+	candidates := permutator.Permute("api-dev.example.com", "example.com")
+
+	// Tokens learned from one name are applied to the next
+	for _, want := range []string{
+		"api-dev2.example.com",        // increment
+		"api-staging.example.com",     // swap
+		"dev-api.example.com",         // join
+		"dev.api.example.com",         // join
+		"staging.api-dev.example.com", // insert
+	} {
+		if !slices.Contains(candidates, want) {
+			t.Errorf("Permute(api-dev.example.com) = %v, missing %s", candidates, want)
+		}
+	}
+	if slices.Contains(candidates, "staging.example.com") {
+		t.Errorf("Permute(api-dev.example.com) = %v, should not repeat a known name", candidates)
+	}
+
+	tests := []struct {
+		name     string
+		config   PermutatorConfig
+		input    string
+		expected []string
+	}{
+		{
+			name:     "increment numbers",
+			config:   PermutatorConfig{Rules: []string{RuleIncrement}, Words: []string{}},
+			input:    "web01.eu.example.com",
+			expected: []string{"web02.eu.example.com", "web00.eu.example.com"},
+		},
+		{
+			name:     "outside the root",
+			config:   PermutatorConfig{},
+			input:    "www.example.org",
+			expected: nil,
+		},
+		{
+			name:     "budget per root",
+			config:   PermutatorConfig{MaxPerRoot: 4},
+			input:    "api.example.com",
+			expected: []string{"api2.example.com", "dev.example.com", "test.example.com", "qa.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewPermutator(tt.config).Permute(tt.input, "example.com")
+			if !slices.Equal(result, tt.expected) {
+				t.Errorf("Permute(%s) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
@@ -130,6 +130,11 @@ func (e *Expander) ExpandDomain(domain string) []string {
 	return expanded
 }
 
+// Subdomains returns the subdomain prefixes the expander uses
+func (e *Expander) Subdomains() []string {
+	return append([]string{}, e.subdomains...)
+}
+
 // IsSLD checks if a domain is a second-level domain (no subdomain parts)
 func (e *Expander) IsSLD(domain string) bool {
 	domain = strings.ToLower(strings.TrimSpace(domain))
@@ -0,0 +1,248 @@
+package domainservice
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// Permutation rules
+const (
+	// RuleInsert adds a known token before or after a name, as a label or with "-"
+	RuleInsert = "insert"
+	// RuleSwap replaces a token of a name with another known token
+	RuleSwap = "swap"
+	// RuleIncrement bumps the numbers in a name, or appends one
+	RuleIncrement = "increment"
+	// RuleJoin reorders the tokens of a name, joined with "-" or "."
+	RuleJoin = "join"
+)
+
+// DefaultPermutationRules are the rules applied when none are configured
+var DefaultPermutationRules = []string{RuleInsert, RuleSwap, RuleIncrement, RuleJoin}
+
+// DefaultPermutationWords seed the tokens of every root: environments and regions
+var DefaultPermutationWords = []string{
+	"dev", "test", "qa", "uat", "stage", "staging", "prod", "internal", "admin",
+	"us", "eu", "asia", "east", "west",
+}
+
+// Permutator implements service.Permutator. It learns the tokens of the
+// names discovered under each root and mutates new names with them.
+type Permutator struct {
+	rules      map[string]bool
+	words      []string
+	maxPerRoot int
+	roots      map[string]*permutationState
+	mu         sync.Mutex
+}
+
+// PermutatorConfig holds permutator configuration
+type PermutatorConfig struct {
+	// Rules are the mutations applied (RuleInsert, RuleSwap, ...)
+	Rules []string
+	// Words are tokens known under every root before any is learned
+	Words []string
+	// MaxPerRoot bounds the number of candidates generated per root
+	MaxPerRoot int
+}
+
+// permutationState holds the tokens and candidates of a single root
+type permutationState struct {
+	tokens    []string
+	known     map[string]bool
+	generated map[string]bool // Names seen or generated, never returned twice
+	count     int             // Candidates generated
+}
+
+// NewPermutator creates a new permutator
+func NewPermutator(config PermutatorConfig) service.Permutator {
+	if len(config.Rules) == 0 {
+		config.Rules = DefaultPermutationRules
+	}
+
+	if config.Words == nil {
+		config.Words = DefaultPermutationWords
+	}
+
+	if config.MaxPerRoot <= 0 {
+		config.MaxPerRoot = 1000
+	}
+
+	rules := make(map[string]bool)
+	for _, rule := range config.Rules {
+		rules[strings.ToLower(rule)] = true
+	}
+
+	return &Permutator{
+		rules:      rules,
+		words:      config.Words,
+		maxPerRoot: config.MaxPerRoot,
+		roots:      make(map[string]*permutationState),
+	}
+}
+
+// Permute learns the tokens of name and returns new candidate names under
+// root, until the root's budget is spent
+func (p *Permutator) Permute(name, root string) []string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	root = strings.ToLower(root)
+	sub, ok := strings.CutSuffix(name, "."+root)
+	if !ok || sub == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.state(root, name)
+	labels := strings.Split(sub, ".")
+	for _, token := range tokenize(labels) {
+		state.learn(token)
+	}
+
+	var candidates []string
+	for _, guess := range p.mutate(labels, state.tokens) {
+		if state.count >= p.maxPerRoot {
+			break
+		}
+		candidate := guess + "." + root
+		if !state.generated[candidate] && isLabelSequence(guess) {
+			state.generated[candidate] = true
+			state.count++
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// state returns the state of root, marking name as already known
+func (p *Permutator) state(root, name string) *permutationState {
+	state, ok := p.roots[root]
+	if !ok {
+		state = &permutationState{known: make(map[string]bool), generated: make(map[string]bool)}
+		for _, word := range p.words {
+			state.learn(strings.ToLower(word))
+		}
+		p.roots[root] = state
+	}
+	state.generated[name] = true
+	return state
+}
+
+// learn adds a token to the root's vocabulary
+func (s *permutationState) learn(token string) {
+	if !s.known[token] {
+		s.known[token] = true
+		s.tokens = append(s.tokens, token)
+	}
+}
+
+// mutate applies the enabled rules to the labels of a name, leftmost first
+func (p *Permutator) mutate(labels []string, tokens []string) []string {
+	sub := strings.Join(labels, ".")
+	first := labels[0]
+	rest := strings.Join(labels[1:], ".")
+	withRest := func(label string) string {
+		if rest == "" {
+			return label
+		}
+		return label + "." + rest
+	}
+
+	var guesses []string
+	parts := strings.Split(first, "-")
+
+	if p.rules[RuleIncrement] {
+		guesses = append(guesses, increments(first, withRest)...)
+	}
+
+	if p.rules[RuleSwap] {
+		for i, part := range parts {
+			for _, token := range tokens {
+				if token == part {
+					continue
+				}
+				swapped := append(append(append([]string{}, parts[:i]...), token), parts[i+1:]...)
+				guesses = append(guesses, withRest(strings.Join(swapped, "-")))
+			}
+		}
+	}
+
+	if p.rules[RuleJoin] && len(parts) == 2 {
+		guesses = append(guesses,
+			withRest(parts[1]+"-"+parts[0]),
+			withRest(parts[0]+"."+parts[1]),
+			withRest(parts[1]+"."+parts[0]),
+		)
+	}
+
+	if p.rules[RuleInsert] {
+		for _, token := range tokens {
+			if slices.Contains(parts, token) {
+				continue
+			}
+			guesses = append(guesses,
+				withRest(first+"-"+token),
+				withRest(token+"-"+first),
+				token+"."+sub,
+			)
+		}
+	}
+
+	return guesses
+}
+
+// increments bumps the trailing number of label up and down, keeping its
+// zero padding, or appends a 2 to a label without one
+func increments(label string, withRest func(string) string) []string {
+	end := len(label)
+	start := end
+	for start > 0 && unicode.IsDigit(rune(label[start-1])) {
+		start--
+	}
+
+	if start == end {
+		return []string{withRest(label + "2")}
+	}
+
+	number, err := strconv.Atoi(label[start:end])
+	if err != nil {
+		return nil
+	}
+	width := end - start
+	guesses := []string{withRest(label[:start] + fmt.Sprintf("%0*d", width, number+1))}
+	if number > 0 {
+		guesses = append(guesses, withRest(label[:start]+fmt.Sprintf("%0*d", width, number-1)))
+	}
+	return guesses
+}
+
+// tokenize splits labels into their "-" separated words, without numbers
+func tokenize(labels []string) []string {
+	var tokens []string
+	for _, label := range labels {
+		for _, part := range strings.Split(label, "-") {
+			part = strings.TrimRightFunc(part, unicode.IsDigit)
+			if part != "" {
+				tokens = append(tokens, part)
+			}
+		}
+	}
+	return tokens
+}
+
+// isLabelSequence checks if s is made of valid DNS labels
+func isLabelSequence(s string) bool {
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+	}
+	return true
+}
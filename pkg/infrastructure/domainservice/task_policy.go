@@ -0,0 +1,42 @@
+package domainservice
+
+import (
+	"strings"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// DefaultBoostedSources are discovery source prefixes with a high signal:
+// names from certificates and DNS answers almost always exist, unlike regex
+// hits in page bodies
+var DefaultBoostedSources = []string{"tls:", "dns:"}
+
+// TaskPolicy implements service.TaskPolicy. Shallow tasks come first; at
+// equal depth, tasks discovered from a boosted source come first.
+type TaskPolicy struct {
+	boostedSources []string
+}
+
+// NewTaskPolicy creates a task policy boosting the given source prefixes
+func NewTaskPolicy(boostedSources []string) service.TaskPolicy {
+	return &TaskPolicy{boostedSources: boostedSources}
+}
+
+// Less reports whether task a should be crawled before task b
+func (p *TaskPolicy) Less(a, b *entity.Task) bool {
+	if a.Domain.Depth != b.Domain.Depth {
+		return a.Domain.Depth < b.Domain.Depth
+	}
+	return p.isBoosted(a.Source) && !p.isBoosted(b.Source)
+}
+
+// isBoosted checks if a discovery source matches a boosted prefix
+func (p *TaskPolicy) isBoosted(source string) bool {
+	for _, prefix := range p.boostedSources {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	return false
+}
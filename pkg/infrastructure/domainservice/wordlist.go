@@ -0,0 +1,54 @@
+package domainservice
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// Wordlist implements service.Wordlist over files with one label per line.
+// The files are read as they are iterated, so they can be arbitrarily large.
+type Wordlist struct {
+	paths []string
+}
+
+// NewWordlist creates a wordlist reading the given files in order
+func NewWordlist(paths []string) service.Wordlist {
+	return &Wordlist{paths: paths}
+}
+
+// Each calls yield with every label in turn until it returns false. Blank
+// lines and lines starting with "#" are skipped.
+func (w *Wordlist) Each(yield func(label string) bool) error {
+	for _, path := range w.paths {
+		stop, err := w.eachInFile(path, yield)
+		if err != nil || stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachInFile yields the labels of a single file and reports whether yield
+// asked to stop
+func (w *Wordlist) eachInFile(path string, yield func(label string) bool) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		label := strings.ToLower(strings.Trim(strings.TrimSpace(scanner.Text()), "."))
+		if label == "" || strings.HasPrefix(label, "#") {
+			continue
+		}
+		if !yield(label) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -1,21 +1,30 @@
 package http
 
 import (
-	"fmt"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
 	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/retry"
 )
 
 // Fetcher implements service.HTTPFetcher
 type Fetcher struct {
 	client          *http.Client
+	pinnedClient    *http.Client
 	maxResponseSize int64
 	userAgent       string
+	limiter         service.RateLimiter
+	roots           []string
+	retry           service.RetryPolicy
 }
 
 // Config holds HTTP fetcher configuration
@@ -23,27 +32,96 @@ type Config struct {
 	Timeout         time.Duration
 	MaxResponseSize int64
 	UserAgent       string
+	// InsecureSkipVerify accepts invalid certificates so their names can still be harvested
+	InsecureSkipVerify bool
+	// RedirectPolicy is one of RedirectFollow, RedirectNone or RedirectInScope
+	RedirectPolicy string
+	MaxRedirects   int
+	// Scope decides which hosts are in scope for RedirectInScope
+	Scope service.DomainValidator
+	// Limiter throttles requests per root domain and per IP address; nil disables throttling
+	Limiter service.RateLimiter
+	// Roots are the root domains requests are throttled under
+	Roots []string
+	// Retry decides which failed fetches are retried; nil disables retries
+	Retry service.RetryPolicy
 }
 
 // NewFetcher creates a new HTTP fetcher
 func NewFetcher(config Config) *Fetcher {
-	return &Fetcher{
-		client: &http.Client{
-			Timeout: config.Timeout,
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) >= 10 {
-					return fmt.Errorf("too many redirects")
-				}
-				return nil
-			},
-		},
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialPinned(dialer.DialContext)
+
+	// Connections are pooled by host, so fetches of one host from several
+	// addresses must not share them
+	pinned := transport.Clone()
+	pinned.DisableKeepAlives = true
+
+	f := &Fetcher{
 		maxResponseSize: config.MaxResponseSize,
 		userAgent:       config.UserAgent,
+		limiter:         config.Limiter,
+		roots:           config.Roots,
+		retry:           config.Retry,
+	}
+	checkRedirect := f.throttleRedirect(newCheckRedirect(config))
+	f.client = &http.Client{
+		Timeout:       config.Timeout,
+		Transport:     &redirectRecorder{next: transport},
+		CheckRedirect: checkRedirect,
 	}
+	f.pinnedClient = &http.Client{
+		Timeout:       config.Timeout,
+		Transport:     &redirectRecorder{next: pinned},
+		CheckRedirect: checkRedirect,
+	}
+	return f
 }
 
 // Fetch implements service.HTTPFetcher
-func (f *Fetcher) Fetch(url string) (*service.HTTPResponse, error) {
+func (f *Fetcher) Fetch(url string, ips []string) (*service.HTTPResponse, error) {
+	return f.fetch(f.client, url, ips)
+}
+
+// FetchAt implements service.PinnedFetcher. The URL's host is still sent in
+// the Host header and as the TLS server name.
+func (f *Fetcher) FetchAt(url, ip string) (*service.HTTPResponse, error) {
+	return f.fetch(f.pinnedClient, url, []string{ip})
+}
+
+// fetch fetches url with client, from ips if there are any, retrying as the
+// policy allows
+func (f *Fetcher) fetch(client *http.Client, url string, ips []string) (*service.HTTPResponse, error) {
+	for try := 1; ; try++ {
+		resp, err := f.fetchOnce(client, url, ips)
+		resp.Tries = try
+		if resp.Message != nil {
+			resp.Message.Tries = try
+		}
+
+		// Server-side failures are retried like transport errors
+		errorClass := resp.ErrorClass
+		var retryAfter time.Duration
+		if err == nil {
+			errorClass = retry.ClassifyStatus(resp.StatusCode)
+			retryAfter = retry.ParseRetryAfter(resp.Headers["Retry-After"], time.Now())
+		}
+		if f.retry == nil || errorClass == "" {
+			return resp, err
+		}
+
+		delay, ok := f.retry.Backoff(try, errorClass, retryAfter)
+		if !ok {
+			return resp, err
+		}
+		time.Sleep(delay)
+	}
+}
+
+// fetchOnce performs a single try of a fetch
+func (f *Fetcher) fetchOnce(client *http.Client, url string, ips []string) (*service.HTTPResponse, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return &service.HTTPResponse{URL: url, Error: err.Error()}, err
@@ -51,6 +129,13 @@ func (f *Fetcher) Fetch(url string) (*service.HTTPResponse, error) {
 
 	req.Header.Set("User-Agent", f.userAgent)
 
+	// Wait for the rate limits before the client timeout starts ticking
+	ctx := f.throttle(req, ips)
+
+	// Record the redirect chain while the client follows it
+	var hops []entity.HTTPHop
+	req = req.WithContext(context.WithValue(ctx, hopsKey{}, &hops))
+
 	// Read request body (usually empty for GET)
 	var reqBody string
 	if req.Body != nil {
@@ -74,21 +159,35 @@ func (f *Fetcher) Fetch(url string) (*service.HTTPResponse, error) {
 		httpMsg.Request.Header[k] = strings.Join(v, ", ")
 	}
 
-	resp, err := f.client.Do(req)
+	start := time.Now()
+	resp, err := client.Do(req)
+	httpMsg.Redirects = hops
 	if err != nil {
-		return &service.HTTPResponse{URL: url, Error: err.Error(), Message: httpMsg}, err
+		return &service.HTTPResponse{
+			URL:        url,
+			Error:      err.Error(),
+			ErrorClass: classifyError(err),
+			LatencyMs:  time.Since(start).Milliseconds(),
+			Redirects:  hops,
+			Message:    httpMsg,
+		}, err
 	}
 	defer resp.Body.Close()
 
 	// Limit response size
 	limitedReader := io.LimitReader(resp.Body, f.maxResponseSize)
 	body, err := io.ReadAll(limitedReader)
+	latency := time.Since(start).Milliseconds()
 	if err != nil {
 		// Even if reading body fails, we might want to return what we have
 		return &service.HTTPResponse{
 			URL:        url,
+			FinalURL:   resp.Request.URL.String(),
 			StatusCode: resp.StatusCode,
 			Error:      err.Error(),
+			ErrorClass: classifyError(err),
+			LatencyMs:  latency,
+			Redirects:  hops,
 			Message:    httpMsg,
 		}, err
 	}
@@ -99,6 +198,8 @@ func (f *Fetcher) Fetch(url string) (*service.HTTPResponse, error) {
 		headers[key] = strings.Join(values, ", ")
 	}
 
+	certificate := toTLSCertificate(resp.TLS)
+
 	// Populate response part of HTTPMessage
 	httpMsg.Response = &entity.HTTPResponse{
 		Proto:         resp.Proto,
@@ -107,14 +208,46 @@ func (f *Fetcher) Fetch(url string) (*service.HTTPResponse, error) {
 		Header:        headers,
 		Body:          bodyStr,
 		ContentLength: resp.ContentLength,
+		Certificate:   certificate,
 	}
 
 	return &service.HTTPResponse{
 		URL:           url,
+		FinalURL:      resp.Request.URL.String(),
 		StatusCode:    resp.StatusCode,
 		Headers:       headers,
 		Body:          bodyStr,
 		ContentLength: len(body),
+		LatencyMs:     latency,
+		Redirects:     hops,
+		Certificate:   certificate,
 		Message:       httpMsg,
 	}, nil
 }
+
+// classifyError maps a fetch error to one of the service.ErrorClass values
+func classifyError(err error) string {
+	if strings.Contains(err.Error(), "too many redirects") {
+		return service.ErrorClassRedirect
+	}
+	return retry.Classify(err)
+}
+
+// toTLSCertificate extracts the leaf certificate of a TLS connection
+func toTLSCertificate(state *tls.ConnectionState) *entity.TLSCertificate {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	leaf := state.PeerCertificates[0]
+	fingerprint := sha256.Sum256(leaf.Raw)
+
+	return &entity.TLSCertificate{
+		CommonName:  leaf.Subject.CommonName,
+		DNSNames:    leaf.DNSNames,
+		Issuer:      leaf.Issuer.String(),
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+	}
+}
@@ -0,0 +1,190 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/retry"
+)
+
+func TestFetcher_Certificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<title>Test</title>")
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(Config{
+		Timeout:            5 * time.Second,
+		MaxResponseSize:    1024,
+		UserAgent:          "test",
+		InsecureSkipVerify: true,
+	})
+
+	resp, err := fetcher.Fetch(server.URL, nil)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	if resp.Certificate == nil {
+		t.Fatal("Fetch() should capture the peer certificate")
+	}
+
+	// The test certificate is issued for example.com and *.example.com
+	names := make(map[string]bool)
+	for _, name := range resp.Certificate.DNSNames {
+		names[name] = true
+	}
+	if !names["example.com"] || !names["*.example.com"] {
+		t.Errorf("Certificate.DNSNames = %v, want example.com and *.example.com", resp.Certificate.DNSNames)
+	}
+
+	if len(resp.Certificate.Fingerprint) != 64 {
+		t.Errorf("Certificate.Fingerprint = %q, want SHA-256 hex", resp.Certificate.Fingerprint)
+	}
+
+	if resp.Message.Response.Certificate != resp.Certificate {
+		t.Error("HTTP log message should carry the certificate")
+	}
+}
+
+func TestFetcher_PlainHTTPHasNoCertificate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(Config{Timeout: 5 * time.Second, MaxResponseSize: 1024})
+
+	resp, err := fetcher.Fetch(server.URL, nil)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	if resp.Certificate != nil {
+		t.Error("Plain HTTP responses should not carry a certificate")
+	}
+}
+
+func TestFetcher_RedirectChain(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.RedirectHandler("/step", http.StatusMovedPermanently))
+	mux.Handle("/step", http.RedirectHandler("/final", http.StatusFound))
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "done")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		policy     string
+		statusCode int
+		hops       int
+	}{
+		{"follow", RedirectFollow, http.StatusOK, 2},
+		{"none", RedirectNone, http.StatusMovedPermanently, 1},
+		{"in-scope without scope", RedirectInScope, http.StatusMovedPermanently, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := NewFetcher(Config{
+				Timeout:         5 * time.Second,
+				MaxResponseSize: 1024,
+				RedirectPolicy:  tt.policy,
+			})
+
+			resp, err := fetcher.Fetch(server.URL, nil)
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("StatusCode = %d, want %d", resp.StatusCode, tt.statusCode)
+			}
+			if len(resp.Redirects) != tt.hops {
+				t.Fatalf("len(Redirects) = %d, want %d", len(resp.Redirects), tt.hops)
+			}
+			if resp.Redirects[0].Location != "/step" {
+				t.Errorf("Redirects[0].Location = %q, want /step", resp.Redirects[0].Location)
+			}
+			if len(resp.Message.Redirects) != tt.hops {
+				t.Errorf("HTTP log message should carry %d redirects, got %d", tt.hops, len(resp.Message.Redirects))
+			}
+		})
+	}
+}
+
+func TestFetcher_TooManyRedirects(t *testing.T) {
+	server := httptest.NewServer(http.RedirectHandler("/", http.StatusFound))
+	defer server.Close()
+
+	fetcher := NewFetcher(Config{Timeout: 5 * time.Second, MaxResponseSize: 1024, MaxRedirects: 3})
+
+	resp, err := fetcher.Fetch(server.URL, nil)
+	if err == nil {
+		t.Fatal("Fetch() should fail on a redirect loop")
+	}
+	if resp.ErrorClass != "redirect" {
+		t.Errorf("ErrorClass = %q, want redirect", resp.ErrorClass)
+	}
+	if len(resp.Redirects) != 3 {
+		t.Errorf("len(Redirects) = %d, want 3", len(resp.Redirects))
+	}
+}
+
+func TestFetcher_Retry(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(Config{
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+		UserAgent:       "test",
+		Retry:           retry.NewPolicy(retry.Config{MaxTries: 3, BaseDelay: time.Millisecond}),
+	})
+
+	resp, err := fetcher.Fetch(server.URL, nil)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Tries != 3 || resp.Message.Tries != 3 {
+		t.Errorf("Fetch() = %d after %d tries, want 200 after 3", resp.StatusCode, resp.Tries)
+	}
+}
+
+func TestFetcher_NoRetryOnClientError(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(Config{
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+		UserAgent:       "test",
+		Retry:           retry.NewPolicy(retry.Config{MaxTries: 3, BaseDelay: time.Millisecond}),
+	})
+
+	resp, _ := fetcher.Fetch(server.URL, nil)
+	if resp.Tries != 1 || requests.Load() != 1 {
+		t.Errorf("Fetch() tried %d times, want 1", requests.Load())
+	}
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+)
+
+// Redirect policies
+const (
+	// RedirectFollow follows every redirect up to the configured limit
+	RedirectFollow = "follow"
+	// RedirectNone never follows redirects; the 3xx response is returned as-is
+	RedirectNone = "none"
+	// RedirectInScope only follows redirects to hosts under a crawled root
+	RedirectInScope = "in-scope"
+)
+
+// defaultMaxRedirects is used when no redirect limit is configured
+const defaultMaxRedirects = 10
+
+// hopsKey is the request context key of the redirect chain being recorded
+type hopsKey struct{}
+
+// newCheckRedirect builds the http.Client redirect policy from the fetcher configuration
+func newCheckRedirect(config Config) func(req *http.Request, via []*http.Request) error {
+	maxRedirects := config.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		switch config.RedirectPolicy {
+		case RedirectNone:
+			return http.ErrUseLastResponse
+		case RedirectInScope:
+			if config.Scope == nil || !config.Scope.IsInScope(req.URL.Hostname(), "") {
+				return http.ErrUseLastResponse
+			}
+		}
+
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("too many redirects")
+		}
+		return nil
+	}
+}
+
+// redirectRecorder records every redirect response into the hop list carried
+// by the request context
+type redirectRecorder struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *redirectRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	hops, ok := req.Context().Value(hopsKey{}).(*[]entity.HTTPHop)
+	if ok && isRedirect(resp.StatusCode) {
+		*hops = append(*hops, entity.HTTPHop{
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Location:   resp.Header.Get("Location"),
+			LatencyMs:  time.Since(start).Milliseconds(),
+		})
+	}
+
+	return resp, nil
+}
+
+// isRedirect checks if a status code asks the client to go elsewhere
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"golang.org/x/net/publicsuffix"
+)
+
+// pinKey is the request context key of the addresses a host is dialed at
+type pinKey struct{}
+
+// pinnedHost maps a host to the IP addresses it was throttled under, dialed
+// in order
+type pinnedHost struct {
+	host string
+	ips  []string
+	// limiter throttles the fallback addresses before they are dialed
+	limiter service.RateLimiter
+}
+
+// throttle waits for the rate limits of the request's root domain and IP
+// address, charging the global rate once. The host's ips, if any, are pinned
+// in the returned context so that the connection goes to the IP that was
+// throttled rather than to a fresh lookup of the host.
+func (f *Fetcher) throttle(req *http.Request, ips []string) context.Context {
+	ctx := req.Context()
+	host := strings.ToLower(req.URL.Hostname())
+	if len(ips) > 0 {
+		ctx = context.WithValue(ctx, pinKey{}, &pinnedHost{host: host, ips: ips, limiter: f.limiter})
+	}
+	if f.limiter != nil {
+		f.limiter.Wait(f.rateKeys(host, ips)...)
+	}
+	return ctx
+}
+
+// throttleRedirect wraps a redirect policy so that every hop it allows waits
+// for the rate limits like the first request did
+func (f *Fetcher) throttleRedirect(checkRedirect func(req *http.Request, via []*http.Request) error) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if err := checkRedirect(req, via); err != nil || f.limiter == nil {
+			return err
+		}
+
+		// The addresses are only known for the host that was pinned; other
+		// hosts are throttled per root domain alone
+		host := strings.ToLower(req.URL.Hostname())
+		var ips []string
+		if pin, ok := req.Context().Value(pinKey{}).(*pinnedHost); ok && pin.host == host {
+			ips = pin.ips
+		}
+		f.limiter.Wait(f.rateKeys(host, ips)...)
+		return nil
+	}
+}
+
+// rateKeys returns the keys a request to host is throttled under: its root
+// domain and the address it is dialed at first, either ips[0] or the host
+// itself if it is an IP literal
+func (f *Fetcher) rateKeys(host string, ips []string) []service.RateKey {
+	keys := []service.RateKey{{Kind: service.RateKeyRoot, Key: f.rootOf(host)}}
+	if len(ips) > 0 {
+		keys = append(keys, service.RateKey{Kind: service.RateKeyIP, Key: ips[0]})
+	} else if ip := net.ParseIP(host); ip != nil {
+		keys = append(keys, service.RateKey{Kind: service.RateKeyIP, Key: ip.String()})
+	}
+	return keys
+}
+
+// rootOf returns the configured root domain of host, falling back to its
+// registrable domain
+func (f *Fetcher) rootOf(host string) string {
+	root := ""
+	for _, candidate := range f.roots {
+		if (host == candidate || strings.HasSuffix(host, "."+candidate)) && len(candidate) > len(root) {
+			root = candidate
+		}
+	}
+	if root != "" {
+		return root
+	}
+
+	if registrable, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return registrable
+	}
+	return host
+}
+
+// dialPinned returns a dial function that connects to the pinned addresses
+// of a host, if the request context carries them, falling back to the next
+// address when one cannot be reached
+func dialPinned(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		pin, ok := ctx.Value(pinKey{}).(*pinnedHost)
+		if !ok {
+			return dial(ctx, network, addr)
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || !strings.EqualFold(host, pin.host) {
+			return dial(ctx, network, addr)
+		}
+
+		for i, ip := range pin.ips {
+			if i > 0 && pin.limiter != nil {
+				pin.limiter.WaitKeys(service.RateKey{Kind: service.RateKeyIP, Key: ip})
+			}
+			var conn net.Conn
+			conn, err = dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil || ctx.Err() != nil {
+				return conn, err
+			}
+		}
+		return nil, err
+	}
+}
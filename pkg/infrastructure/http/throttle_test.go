@@ -0,0 +1,160 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+func TestDialPinned(t *testing.T) {
+	tests := []struct {
+		name     string
+		pin      *pinnedHost
+		addr     string
+		down     []string
+		dialed   []string
+		expected string
+	}{
+		{
+			name:     "unpinned",
+			addr:     "example.com:443",
+			dialed:   []string{"example.com:443"},
+			expected: "example.com:443",
+		},
+		{
+			name:     "other host",
+			pin:      &pinnedHost{host: "example.com", ips: []string{"192.0.2.1"}},
+			addr:     "cdn.example.net:443",
+			dialed:   []string{"cdn.example.net:443"},
+			expected: "cdn.example.net:443",
+		},
+		{
+			name:     "first address",
+			pin:      &pinnedHost{host: "example.com", ips: []string{"192.0.2.1", "192.0.2.2"}},
+			addr:     "example.com:443",
+			dialed:   []string{"192.0.2.1:443"},
+			expected: "192.0.2.1:443",
+		},
+		{
+			name:     "fallback",
+			pin:      &pinnedHost{host: "example.com", ips: []string{"192.0.2.1", "2001:db8::1", "192.0.2.3"}},
+			addr:     "example.com:80",
+			down:     []string{"192.0.2.1:80"},
+			dialed:   []string{"192.0.2.1:80", "[2001:db8::1]:80"},
+			expected: "[2001:db8::1]:80",
+		},
+		{
+			name:   "all down",
+			pin:    &pinnedHost{host: "example.com", ips: []string{"192.0.2.1", "192.0.2.2"}},
+			addr:   "example.com:80",
+			down:   []string{"192.0.2.1:80", "192.0.2.2:80"},
+			dialed: []string{"192.0.2.1:80", "192.0.2.2:80"},
+		},
+	}
+
+	for _, tt := range tests {
+		var dialed []string
+		dial := dialPinned(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			if slices.Contains(tt.down, addr) {
+				return nil, errors.New("connection refused")
+			}
+			client, server := net.Pipe()
+			server.Close()
+			return &addrConn{Conn: client, addr: addr}, nil
+		})
+
+		ctx := context.Background()
+		if tt.pin != nil {
+			ctx = context.WithValue(ctx, pinKey{}, tt.pin)
+		}
+		conn, err := dial(ctx, "tcp", tt.addr)
+
+		if !slices.Equal(dialed, tt.dialed) {
+			t.Errorf("%s: dialed %v, want %v", tt.name, dialed, tt.dialed)
+		}
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("%s: dial succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: dial error = %v", tt.name, err)
+			continue
+		}
+		if addr := conn.(*addrConn).addr; addr != tt.expected {
+			t.Errorf("%s: connected to %s, want %s", tt.name, addr, tt.expected)
+		}
+		conn.Close()
+	}
+}
+
+// addrConn remembers the address it was dialed at
+type addrConn struct {
+	net.Conn
+	addr string
+}
+
+// recordingLimiter records the keys of every wait
+type recordingLimiter struct {
+	mu    sync.Mutex
+	waits [][]service.RateKey
+}
+
+func (l *recordingLimiter) Wait(keys ...service.RateKey) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waits = append(l.waits, keys)
+	return 0
+}
+
+func (l *recordingLimiter) WaitKeys(keys ...service.RateKey) time.Duration { return 0 }
+
+func (l *recordingLimiter) Throttled() time.Duration { return 0 }
+
+func TestFetcher_ThrottleRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/step", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	limiter := &recordingLimiter{}
+	fetcher := NewFetcher(Config{Timeout: 5 * time.Second, MaxResponseSize: 1024, Limiter: limiter})
+
+	// The host does not resolve; it is only reachable at the pinned address
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	resp, err := fetcher.Fetch("http://www.example.test:"+port+"/", []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Fetch() = %d, want 200", resp.StatusCode)
+	}
+
+	keys := []service.RateKey{
+		{Kind: service.RateKeyRoot, Key: "example.test"},
+		{Kind: service.RateKeyIP, Key: "127.0.0.1"},
+	}
+	if len(limiter.waits) != 2 {
+		t.Fatalf("Fetch() waited %d times, want once per hop (2)", len(limiter.waits))
+	}
+	for i, waited := range limiter.waits {
+		if !slices.Equal(waited, keys) {
+			t.Errorf("Wait() #%d keys = %v, want %v", i, waited, keys)
+		}
+	}
+}
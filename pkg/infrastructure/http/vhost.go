@@ -0,0 +1,169 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// VHostProber implements service.VHostProber
+type VHostProber struct {
+	fetcher     service.PinnedFetcher
+	baselines   int
+	concurrency int
+	ports       map[string]string
+}
+
+// VHostConfig holds virtual host prober configuration
+type VHostConfig struct {
+	// Baselines is the number of random names requested per address and protocol
+	Baselines int
+	// Concurrency is the number of names requested at once per address
+	Concurrency int
+	// Ports overrides the default port of a protocol, e.g. "https" -> "8443"
+	Ports map[string]string
+}
+
+// fingerprint summarizes a response with the requested host removed, since
+// default pages often echo it back
+type fingerprint struct {
+	status int
+	length int
+	hash   string
+}
+
+// NewVHostProber creates a virtual host prober fetching with fetcher
+func NewVHostProber(fetcher service.PinnedFetcher, config VHostConfig) *VHostProber {
+	if config.Baselines <= 0 {
+		config.Baselines = 2
+	}
+
+	if config.Concurrency <= 0 {
+		config.Concurrency = 8
+	}
+
+	return &VHostProber{
+		fetcher:     fetcher,
+		baselines:   config.Baselines,
+		concurrency: config.Concurrency,
+		ports:       config.Ports,
+	}
+}
+
+// Probe implements service.VHostProber
+func (p *VHostProber) Probe(ip, root string, names, protocols []string) []service.VHost {
+	var vhosts []service.VHost
+	for _, protocol := range protocols {
+		baseline := p.baseline(ip, root, protocol)
+		if len(baseline) == 0 {
+			// Nothing answers on this protocol
+			continue
+		}
+
+		found := make([]*service.VHost, len(names))
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for i := 0; i < min(p.concurrency, len(names)); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for index := range indexes {
+					found[index] = p.probe(ip, names[index], protocol, baseline)
+				}
+			}()
+		}
+		for index := range names {
+			indexes <- index
+		}
+		close(indexes)
+		wg.Wait()
+
+		for _, vhost := range found {
+			if vhost != nil {
+				vhosts = append(vhosts, *vhost)
+			}
+		}
+	}
+	return vhosts
+}
+
+// baseline fingerprints the responses of ip to random names under root
+func (p *VHostProber) baseline(ip, root, protocol string) []fingerprint {
+	var baseline []fingerprint
+	for i := 0; i < p.baselines; i++ {
+		name := randomLabel() + "." + root
+		resp, err := p.fetcher.FetchAt(p.url(protocol, name), ip)
+		if err != nil {
+			continue
+		}
+		baseline = append(baseline, fingerprintOf(resp, name))
+	}
+	return baseline
+}
+
+// probe requests name from ip and reports it unless the response looks like
+// one of the baseline responses
+func (p *VHostProber) probe(ip, name, protocol string, baseline []fingerprint) *service.VHost {
+	resp, err := p.fetcher.FetchAt(p.url(protocol, name), ip)
+	if err != nil {
+		return nil
+	}
+
+	current := fingerprintOf(resp, name)
+	for _, base := range baseline {
+		if current.matches(base) {
+			return nil
+		}
+	}
+
+	return &service.VHost{
+		VHost: entity.VHost{
+			IP:             ip,
+			Protocol:       protocol,
+			StatusCode:     resp.StatusCode,
+			ContentLength:  resp.ContentLength,
+			BaselineStatus: baseline[0].status,
+			BaselineLength: baseline[0].length,
+		},
+		Name:    name,
+		Message: resp.Message,
+	}
+}
+
+// url returns the URL of name over protocol, on the configured port if any
+func (p *VHostProber) url(protocol, name string) string {
+	if port, ok := p.ports[protocol]; ok {
+		return protocol + "://" + net.JoinHostPort(name, port) + "/"
+	}
+	return protocol + "://" + name + "/"
+}
+
+// fingerprintOf fingerprints the response to a request for name
+func fingerprintOf(resp *service.HTTPResponse, name string) fingerprint {
+	body := strings.ReplaceAll(strings.ToLower(resp.Body), strings.ToLower(name), "")
+	hash := sha256.Sum256([]byte(body))
+	return fingerprint{status: resp.StatusCode, length: len(body), hash: hex.EncodeToString(hash[:])}
+}
+
+// matches checks if f looks like base: same status and body, or a body of
+// nearly the same length, which tolerates tokens and timestamps
+func (f fingerprint) matches(base fingerprint) bool {
+	if f.status != base.status {
+		return false
+	}
+	tolerance := max(32, base.length/20)
+	return f.hash == base.hash || (f.length >= base.length-tolerance && f.length <= base.length+tolerance)
+}
+
+// randomLabel returns a label that is very unlikely to be a configured vhost
+func randomLabel() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
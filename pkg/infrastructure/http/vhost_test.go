@@ -0,0 +1,85 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/retry"
+)
+
+func TestVHostProber_Probe(t *testing.T) {
+	// A default page echoing the host, and one internal vhost that is only
+	// served when both the Host header and the TLS server name ask for it
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.Host)
+		if host == "admin.example.com" && r.TLS.ServerName == host {
+			fmt.Fprint(w, "<title>Admin</title>"+strings.Repeat("internal dashboard ", 20))
+			return
+		}
+		fmt.Fprintf(w, "<html>Welcome! No site is configured for %s</html>", host)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	fetcher := NewFetcher(Config{Timeout: 5 * time.Second, MaxResponseSize: 1 << 16, InsecureSkipVerify: true})
+	prober := NewVHostProber(fetcher, VHostConfig{Ports: map[string]string{"https": serverURL.Port()}})
+
+	vhosts := prober.Probe(serverURL.Hostname(), "example.com", []string{"www.example.com", "admin.example.com", "mail.example.com"}, []string{"https"})
+	if len(vhosts) != 1 || vhosts[0].Name != "admin.example.com" {
+		t.Fatalf("Probe() = %+v, want only admin.example.com", vhosts)
+	}
+
+	vhost := vhosts[0]
+	if vhost.IP != serverURL.Hostname() || vhost.Protocol != "https" || vhost.StatusCode != http.StatusOK || vhost.ContentLength == vhost.BaselineLength {
+		t.Errorf("Probe() = %+v, want an https vhost distinct from the baseline", vhost.VHost)
+	}
+	if vhost.Message == nil || vhost.Message.Response == nil {
+		t.Error("Probe() should return the HTTP message of the vhost")
+	}
+}
+
+func TestVHostProber_NothingListening(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	fetcher := NewFetcher(Config{Timeout: 2 * time.Second, MaxResponseSize: 1024})
+	prober := NewVHostProber(fetcher, VHostConfig{Ports: map[string]string{"http": port}})
+
+	if vhosts := prober.Probe("127.0.0.1", "example.com", []string{"admin.example.com"}, []string{"http"}); len(vhosts) != 0 {
+		t.Errorf("Probe() = %+v, want none without a baseline", vhosts)
+	}
+}
+
+func TestVHostProber_RetryBaseline(t *testing.T) {
+	// The first request fails; a baseline made of it would tell every name
+	// apart from the default page
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "<html>Welcome! No site is configured here</html>")
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	fetcher := NewFetcher(Config{
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1 << 16,
+		Retry:           retry.NewPolicy(retry.Config{MaxTries: 2, BaseDelay: time.Millisecond}),
+	})
+	prober := NewVHostProber(fetcher, VHostConfig{Baselines: 1, Ports: map[string]string{"http": serverURL.Port()}})
+
+	if vhosts := prober.Probe(serverURL.Hostname(), "example.com", []string{"www.example.com"}, []string{"http"}); len(vhosts) != 0 {
+		t.Errorf("Probe() = %+v, want none against a retried baseline", vhosts)
+	}
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// maxBuckets is the number of per-key buckets kept before idle ones are pruned
+const maxBuckets = 10000
+
+// Rate is a token bucket refill rate; zero means unlimited
+type Rate struct {
+	PerSecond float64
+	// Burst is the bucket capacity; it defaults to one second worth of tokens
+	Burst int
+}
+
+// Config holds rate limiter configuration
+type Config struct {
+	// Global limits all requests together
+	Global Rate
+	// PerKey limits requests sharing a key, by key kind (service.RateKeyRoot, ...)
+	PerKey map[string]Rate
+}
+
+// Limiter implements service.RateLimiter with token buckets
+type Limiter struct {
+	global    *bucket
+	perKey    map[string]Rate
+	buckets   map[string]*bucket
+	throttled atomic.Int64
+	mu        sync.Mutex
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewLimiter creates a new token bucket rate limiter. It returns nil when no
+// rate is set, so callers skip throttling altogether.
+func NewLimiter(config Config) service.RateLimiter {
+	if !config.limited() {
+		return nil
+	}
+
+	l := &Limiter{
+		perKey:  config.PerKey,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}
+	if config.Global.PerSecond > 0 {
+		l.global = newBucket(config.Global, l.now())
+	}
+	return l
+}
+
+// limited checks if any rate of the configuration is set
+func (c Config) limited() bool {
+	if c.Global.PerSecond > 0 {
+		return true
+	}
+	for _, rate := range c.PerKey {
+		if rate.PerSecond > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait implements service.RateLimiter
+func (l *Limiter) Wait(keys ...service.RateKey) time.Duration {
+	return l.wait(true, keys)
+}
+
+// WaitKeys implements service.RateLimiter
+func (l *Limiter) WaitKeys(keys ...service.RateKey) time.Duration {
+	return l.wait(false, keys)
+}
+
+// wait reserves a token from the global bucket, if global is set, and from
+// the bucket of every key, then sleeps until the slowest is available
+func (l *Limiter) wait(global bool, keys []service.RateKey) time.Duration {
+	l.mu.Lock()
+	now := l.now()
+
+	var delay time.Duration
+	if global && l.global != nil {
+		delay = l.global.reserve(now)
+	}
+	for _, key := range keys {
+		rate := l.perKey[key.Kind]
+		if rate.PerSecond <= 0 {
+			continue
+		}
+		id := key.Kind + ":" + key.Key
+		b, ok := l.buckets[id]
+		if !ok {
+			if len(l.buckets) >= maxBuckets {
+				l.pruneIdle(now)
+			}
+			b = newBucket(rate, now)
+			l.buckets[id] = b
+		}
+		if d := b.reserve(now); d > delay {
+			delay = d
+		}
+	}
+	l.mu.Unlock()
+
+	if delay > 0 {
+		l.sleep(delay)
+		l.throttled.Add(int64(delay))
+	}
+	return delay
+}
+
+// Throttled implements service.RateLimiter
+func (l *Limiter) Throttled() time.Duration {
+	return time.Duration(l.throttled.Load())
+}
+
+// pruneIdle drops buckets that have refilled completely; recreating them is
+// equivalent
+func (l *Limiter) pruneIdle(now time.Time) {
+	for id, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// bucket is a token bucket whose token count may go negative while
+// reservations are waiting
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket creates a full bucket
+func newBucket(rate Rate, now time.Time) *bucket {
+	burst := float64(rate.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Floor(rate.PerSecond))
+	}
+	return &bucket{rate: rate.PerSecond, burst: burst, tokens: burst, last: now}
+}
+
+// reserve takes a token and returns how long to wait until it is available
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full checks if the bucket has refilled completely
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// refill adds the tokens accumulated since the last update
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
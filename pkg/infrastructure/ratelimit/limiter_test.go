@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// newTestLimiter creates a limiter on a fake clock that advances when it sleeps
+func newTestLimiter(config Config) *Limiter {
+	clock := time.Unix(0, 0)
+	l := NewLimiter(config).(*Limiter)
+	l.now = func() time.Time { return clock }
+	l.sleep = func(d time.Duration) {}
+	if l.global != nil {
+		l.global.last = clock
+	}
+	return l
+}
+
+func TestLimiter_PerKey(t *testing.T) {
+	limiter := newTestLimiter(Config{PerKey: map[string]Rate{
+		service.RateKeyRoot: {PerSecond: 2, Burst: 1},
+	}})
+
+	tests := []struct {
+		kind     string
+		key      string
+		expected time.Duration
+	}{
+		{service.RateKeyRoot, "example.com", 0},
+		{service.RateKeyRoot, "example.com", 500 * time.Millisecond},
+		{service.RateKeyRoot, "example.com", time.Second},
+		{service.RateKeyRoot, "test.com", 0},
+		{service.RateKeyIP, "10.0.0.1", 0},
+		{service.RateKeyIP, "10.0.0.1", 0},
+	}
+
+	for _, tt := range tests {
+		delay := limiter.Wait(service.RateKey{Kind: tt.kind, Key: tt.key})
+		if delay != tt.expected {
+			t.Errorf("Wait(%s, %s) = %s, want %s", tt.kind, tt.key, delay, tt.expected)
+		}
+	}
+
+	if throttled := limiter.Throttled(); throttled != 1500*time.Millisecond {
+		t.Errorf("Throttled() = %s, want 1.5s", throttled)
+	}
+}
+
+func TestLimiter_Global(t *testing.T) {
+	limiter := newTestLimiter(Config{Global: Rate{PerSecond: 4, Burst: 2}})
+
+	expected := []time.Duration{0, 0, 250 * time.Millisecond, 500 * time.Millisecond}
+	for i, want := range expected {
+		if delay := limiter.Wait(service.RateKey{Kind: service.RateKeyDNSServer, Key: "8.8.8.8:53"}); delay != want {
+			t.Errorf("Wait() #%d = %s, want %s", i, delay, want)
+		}
+	}
+}
+
+func TestLimiter_GlobalOncePerRequest(t *testing.T) {
+	limiter := newTestLimiter(Config{
+		Global: Rate{PerSecond: 4, Burst: 2},
+		PerKey: map[string]Rate{
+			service.RateKeyRoot: {PerSecond: 100},
+			service.RateKeyIP:   {PerSecond: 100},
+		},
+	})
+	root := service.RateKey{Kind: service.RateKeyRoot, Key: "example.com"}
+	ip := service.RateKey{Kind: service.RateKeyIP, Key: "192.0.2.1"}
+
+	tests := []struct {
+		name     string
+		wait     func(keys ...service.RateKey) time.Duration
+		expected time.Duration
+	}{
+		{"Wait", limiter.Wait, 0},
+		{"WaitKeys", limiter.WaitKeys, 0},
+		{"Wait", limiter.Wait, 0},
+		{"WaitKeys", limiter.WaitKeys, 0},
+		{"Wait", limiter.Wait, 250 * time.Millisecond},
+	}
+
+	for i, tt := range tests {
+		if delay := tt.wait(root, ip); delay != tt.expected {
+			t.Errorf("%s(root, ip) #%d = %s, want %s", tt.name, i, delay, tt.expected)
+		}
+	}
+}
+
+func TestBucket_Refill(t *testing.T) {
+	start := time.Unix(0, 0)
+	b := newBucket(Rate{PerSecond: 10}, start)
+
+	// Ten tokens of burst, then one every 100ms
+	for i := 0; i < 10; i++ {
+		if delay := b.reserve(start); delay != 0 {
+			t.Fatalf("reserve() #%d = %s, want 0", i, delay)
+		}
+	}
+	if delay := b.reserve(start); delay != 100*time.Millisecond {
+		t.Errorf("reserve() = %s, want 100ms", delay)
+	}
+	if b.full(start.Add(time.Second)) {
+		t.Error("Bucket should not be full after 1s with a pending reservation")
+	}
+	if !b.full(start.Add(2 * time.Second)) {
+		t.Error("Bucket should be full after 2s")
+	}
+}
+
+func TestNewLimiter_Unlimited(t *testing.T) {
+	tests := []struct {
+		config  Config
+		limited bool
+	}{
+		{Config{}, false},
+		{Config{PerKey: map[string]Rate{service.RateKeyRoot: {}, service.RateKeyIP: {}}}, false},
+		{Config{Global: Rate{PerSecond: 1}}, true},
+		{Config{PerKey: map[string]Rate{service.RateKeyIP: {PerSecond: 0.5}}}, true},
+	}
+
+	for _, tt := range tests {
+		if limited := NewLimiter(tt.config) != nil; limited != tt.limited {
+			t.Errorf("NewLimiter(%+v) != nil = %v, want %v", tt.config, limited, tt.limited)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package retry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/miekg/dns"
+)
+
+// Classify maps a network error to one of the service.ErrorClass values
+func Classify(err error) string {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return service.ErrorClassDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return service.ErrorClassConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return service.ErrorClassConnectionReset
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		return service.ErrorClassTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return service.ErrorClassTimeout
+	case strings.Contains(err.Error(), "tls:"):
+		return service.ErrorClassTLS
+	default:
+		return service.ErrorClassOther
+	}
+}
+
+// ClassifyStatus maps a failed HTTP status code to an error class, or "" if
+// the status is not a server-side failure
+func ClassifyStatus(statusCode int) string {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return service.ErrorClassRateLimited
+	case statusCode >= 500 && statusCode < 600:
+		return service.ErrorClassServerError
+	default:
+		return ""
+	}
+}
+
+// ClassifyRcode maps a failed DNS response code to an error class, or "" if
+// the response is an answer (including NXDOMAIN)
+func ClassifyRcode(rcode int) string {
+	if rcode == dns.RcodeServerFailure {
+		return service.ErrorClassServFail
+	}
+	return ""
+}
+
+// ParseRetryAfter parses a Retry-After header in either delay-seconds or
+// HTTP-date form, returning 0 if it is absent or invalid
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package retry
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// DefaultRetryable are the error classes that are usually transient
+var DefaultRetryable = []string{
+	service.ErrorClassTimeout,
+	service.ErrorClassConnectionReset,
+	service.ErrorClassServFail,
+	service.ErrorClassServerError,
+	service.ErrorClassRateLimited,
+}
+
+// Config holds retry policy configuration
+type Config struct {
+	// MaxTries is the maximum number of tries per request, including the first
+	MaxTries int
+	// BaseDelay is the backoff ceiling after the first failure; it doubles
+	// with every further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff; a longer Retry-After gives up instead
+	MaxDelay time.Duration
+	// Retryable lists the error classes worth retrying
+	Retryable []string
+}
+
+// Policy implements service.RetryPolicy with jittered exponential backoff
+type Policy struct {
+	maxTries  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	retryable map[string]bool
+}
+
+// NewPolicy creates a new retry policy
+func NewPolicy(config Config) service.RetryPolicy {
+	if config.MaxTries <= 0 {
+		config.MaxTries = 1
+	}
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = 500 * time.Millisecond
+	}
+	if config.MaxDelay < config.BaseDelay {
+		config.MaxDelay = 30 * time.Second
+	}
+	if config.Retryable == nil {
+		config.Retryable = DefaultRetryable
+	}
+
+	retryable := make(map[string]bool, len(config.Retryable))
+	for _, class := range config.Retryable {
+		retryable[class] = true
+	}
+
+	return &Policy{
+		maxTries:  config.MaxTries,
+		baseDelay: config.BaseDelay,
+		maxDelay:  config.MaxDelay,
+		retryable: retryable,
+	}
+}
+
+// Backoff implements service.RetryPolicy
+func (p *Policy) Backoff(try int, errorClass string, retryAfter time.Duration) (time.Duration, bool) {
+	if try >= p.maxTries || !p.retryable[errorClass] {
+		return 0, false
+	}
+
+	// Servers asking to wait longer than we are willing to are given up on
+	if retryAfter > p.maxDelay {
+		return 0, false
+	}
+
+	// Full jitter: a random delay up to the exponential ceiling
+	ceiling := p.baseDelay
+	for i := 1; i < try && ceiling < p.maxDelay; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, p.maxDelay)
+	delay := time.Duration(rand.Int64N(int64(ceiling) + 1))
+
+	return max(delay, retryAfter), true
+}
@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+	"github.com/miekg/dns"
+)
+
+func TestPolicy_Backoff(t *testing.T) {
+	policy := NewPolicy(Config{MaxTries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+
+	tests := []struct {
+		name       string
+		try        int
+		errorClass string
+		retryAfter time.Duration
+		maxDelay   time.Duration
+		expected   bool
+	}{
+		{"timeout", 1, service.ErrorClassTimeout, 0, 100 * time.Millisecond, true},
+		{"servfail backs off", 2, service.ErrorClassServFail, 0, 200 * time.Millisecond, true},
+		{"out of tries", 3, service.ErrorClassTimeout, 0, 0, false},
+		{"connection refused", 1, service.ErrorClassConnectionRefused, 0, 0, false},
+		{"tls", 1, service.ErrorClassTLS, 0, 0, false},
+		{"retry after", 1, service.ErrorClassRateLimited, 500 * time.Millisecond, 500 * time.Millisecond, true},
+		{"retry after too long", 1, service.ErrorClassRateLimited, time.Minute, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := policy.Backoff(tt.try, tt.errorClass, tt.retryAfter)
+			if ok != tt.expected {
+				t.Fatalf("Backoff(%d, %s) retry = %v, want %v", tt.try, tt.errorClass, ok, tt.expected)
+			}
+			if ok && (delay > tt.maxDelay || delay < tt.retryAfter) {
+				t.Errorf("Backoff(%d, %s) = %s, want between %s and %s", tt.try, tt.errorClass, delay, tt.retryAfter, tt.maxDelay)
+			}
+		})
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		expected   string
+	}{
+		{http.StatusOK, ""},
+		{http.StatusNotFound, ""},
+		{http.StatusTooManyRequests, service.ErrorClassRateLimited},
+		{http.StatusBadGateway, service.ErrorClassServerError},
+		{http.StatusServiceUnavailable, service.ErrorClassServerError},
+	}
+
+	for _, tt := range tests {
+		if result := ClassifyStatus(tt.statusCode); result != tt.expected {
+			t.Errorf("ClassifyStatus(%d) = %q, want %q", tt.statusCode, result, tt.expected)
+		}
+	}
+
+	if result := ClassifyRcode(dns.RcodeServerFailure); result != service.ErrorClassServFail {
+		t.Errorf("ClassifyRcode(SERVFAIL) = %q, want %q", result, service.ErrorClassServFail)
+	}
+	if result := ClassifyRcode(dns.RcodeNameError); result != "" {
+		t.Errorf("ClassifyRcode(NXDOMAIN) = %q, want \"\"", result)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second},
+		{"Sun, 31 Dec 2023 23:59:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		if result := ParseRetryAfter(tt.value, now); result != tt.expected {
+			t.Errorf("ParseRetryAfter(%q) = %s, want %s", tt.value, result, tt.expected)
+		}
+	}
+}
@@ -60,6 +60,17 @@ func (bf *BloomFilter) Save(filename string) error {
 	return err
 }
 
+// Copy returns an independent copy of the filter
+func (bf *BloomFilter) Copy() repository.DomainFilter {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+	return &BloomFilter{
+		filter: bf.filter.Copy(),
+		size:   bf.size,
+		fpRate: bf.fpRate,
+	}
+}
+
 // Load restores the filter state
 func (bf *BloomFilter) Load(filename string) error {
 	bf.mu.Lock()
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/repository"
+)
+
+// checkpointFile is the name of the checkpoint inside a session directory
+const checkpointFile = "checkpoint.json"
+
+// CheckpointStore implements repository.CheckpointStore
+type CheckpointStore struct {
+	dir string
+}
+
+// NewCheckpointStore creates a checkpoint store in a session directory
+func NewCheckpointStore(dir string) (repository.CheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &CheckpointStore{dir: dir}, nil
+}
+
+// Save persists a checkpoint, replacing the previous one atomically
+func (s *CheckpointStore) Save(checkpoint *entity.Checkpoint) error {
+	filename := filepath.Join(s.dir, checkpointFile)
+	tmpFile := filename + ".tmp"
+
+	file, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(file).Encode(checkpoint); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, filename)
+}
+
+// Load restores the last saved checkpoint
+func (s *CheckpointStore) Load() (*entity.Checkpoint, error) {
+	file, err := os.Open(filepath.Join(s.dir, checkpointFile))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var checkpoint entity.Checkpoint
+	if err := json.NewDecoder(file).Decode(&checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
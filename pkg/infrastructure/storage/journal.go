@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/repository"
+)
+
+// TaskJournal implements repository.TaskJournal
+type TaskJournal struct {
+	entries map[string]*journalEntry
+	mu      sync.Mutex
+}
+
+// journalEntry counts the outstanding tasks of a single domain
+type journalEntry struct {
+	task  *entity.Task
+	count int
+}
+
+// NewTaskJournal creates a new task journal
+func NewTaskJournal() repository.TaskJournal {
+	return &TaskJournal{
+		entries: make(map[string]*journalEntry),
+	}
+}
+
+// Add records a task as pending
+func (j *TaskJournal) Add(task *entity.Task) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry, ok := j.entries[task.Domain.Name]; ok {
+		entry.count++
+		return
+	}
+	j.entries[task.Domain.Name] = &journalEntry{task: task, count: 1}
+}
+
+// Done marks a pending task for the domain as completed
+func (j *TaskJournal) Done(domain string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.entries[domain]
+	if !ok {
+		return
+	}
+
+	entry.count--
+	if entry.count <= 0 {
+		delete(j.entries, domain)
+	}
+}
+
+// Pending returns a snapshot of all pending and in-flight tasks
+func (j *TaskJournal) Pending() []*entity.Task {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	tasks := make([]*entity.Task, 0, len(j.entries))
+	for _, entry := range j.entries {
+		tasks = append(tasks, entry.task)
+	}
+	return tasks
+}
+
+// Len returns the number of pending and in-flight tasks
+func (j *TaskJournal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return len(j.entries)
+}
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/repository"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
+)
+
+// PriorityTaskQueue implements repository.TaskQueue. Each root domain has its
+// own heap ordered by a service.TaskPolicy, and roots take turns so that a
+// single huge root cannot starve the others. Tasks beyond the in-memory window
+// wait in an overflow queue of their root and are only ordered once they are
+// moved in; the window is refilled from the overflowing roots in turn.
+type PriorityTaskQueue struct {
+	policy  service.TaskPolicy
+	window  int
+	journal repository.TaskJournal
+	heaps   map[string]*taskHeap
+	roots   []string // Round-robin order of roots with queued tasks
+	next    int
+	length  int
+	seq     uint64
+	closed  bool
+	mu      sync.Mutex
+	cond    *sync.Cond
+
+	newOverflow   func(root string) (repository.TaskQueue, error)
+	overflows     map[string]repository.TaskQueue
+	overflowRoots []string // Round-robin order of roots with an overflow queue
+	nextOverflow  int
+	overflowed    int
+}
+
+// PriorityConfig holds priority task queue configuration
+type PriorityConfig struct {
+	// Window is the maximum number of tasks ordered in memory; 0 means unbounded
+	Window int
+	// Overflow creates the queue receiving the tasks of a root that do not
+	// fit in the window; nil keeps every task in memory
+	Overflow func(root string) (repository.TaskQueue, error)
+	// Roots are the roots whose overflow queues are created at once, to
+	// restore the tasks they held
+	Roots []string
+	// Journal records the tasks handed out by Dequeue until they are done
+	Journal repository.TaskJournal
+}
+
+// NewPriorityTaskQueue creates a new priority task queue
+func NewPriorityTaskQueue(policy service.TaskPolicy, config PriorityConfig) (repository.TaskQueue, error) {
+	q := &PriorityTaskQueue{
+		policy:      policy,
+		window:      config.Window,
+		journal:     config.Journal,
+		heaps:       make(map[string]*taskHeap),
+		newOverflow: config.Overflow,
+		overflows:   make(map[string]repository.TaskQueue),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	for _, root := range config.Roots {
+		if _, err := q.overflow(root); err != nil {
+			return nil, fmt.Errorf("failed to restore overflow of %s: %w", root, err)
+		}
+	}
+	return q, nil
+}
+
+// Enqueue adds a task to the queue
+func (q *PriorityTaskQueue) Enqueue(task *entity.Task) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+
+	// Once a root overflows, its newer tasks must follow
+	root := task.Domain.Root
+	if q.newOverflow != nil && q.window > 0 && (q.length >= q.window || q.overflowLen(root) > 0) {
+		overflow, err := q.overflow(root)
+		if err != nil || !overflow.Enqueue(task) {
+			return false
+		}
+		q.overflowed++
+		q.cond.Signal()
+		return true
+	}
+
+	q.push(task)
+	q.cond.Signal()
+	return true
+}
+
+// push adds a task to the heap of its root
+func (q *PriorityTaskQueue) push(task *entity.Task) {
+	root := task.Domain.Root
+	h, ok := q.heaps[root]
+	if !ok {
+		h = &taskHeap{policy: q.policy}
+		q.heaps[root] = h
+		q.roots = append(q.roots, root)
+	}
+
+	// The sequence number keeps tasks the policy considers equal in FIFO order
+	q.seq++
+	heap.Push(h, &queuedTask{task: task, seq: q.seq})
+	q.length++
+}
+
+// Dequeue removes and returns the best task of the next root in turn
+func (q *PriorityTaskQueue) Dequeue() (*entity.Task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.length == 0 && q.overflowed == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	q.refill()
+	if q.length == 0 {
+		return nil, false
+	}
+
+	if q.next >= len(q.roots) {
+		q.next = 0
+	}
+	root := q.roots[q.next]
+	h := q.heaps[root]
+
+	item := heap.Pop(h).(*queuedTask)
+	q.length--
+
+	if h.Len() == 0 {
+		// Drop the exhausted root; the next root slides into its slot
+		delete(q.heaps, root)
+		q.roots = append(q.roots[:q.next], q.roots[q.next+1:]...)
+	} else {
+		q.next++
+	}
+
+	if q.journal != nil {
+		q.journal.Add(item.task)
+	}
+	return item.task, true
+}
+
+// Len returns the current queue length, including overflowed tasks
+func (q *PriorityTaskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.length + q.overflowed
+}
+
+// Spilled returns the number of tasks the overflow queues wrote to disk
+func (q *PriorityTaskQueue) Spilled() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var spilled int64
+	for _, overflow := range q.overflows {
+		if counter, ok := overflow.(repository.SpillCounter); ok {
+			spilled += counter.Spilled()
+		}
+	}
+	return spilled
+}
+
+// Snapshot implements repository.TaskQueueSnapshotter
+func (q *PriorityTaskQueue) Snapshot() ([]*entity.Task, []entity.SpillPosition, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tasks := make([]*entity.Task, 0, q.length)
+	for _, root := range q.roots {
+		for _, item := range q.heaps[root].items {
+			tasks = append(tasks, item.task)
+		}
+	}
+
+	var positions []entity.SpillPosition
+	for _, root := range q.overflowRoots {
+		snapshotter, ok := q.overflows[root].(repository.TaskQueueSnapshotter)
+		if !ok {
+			return nil, nil, fmt.Errorf("overflow queue of %s cannot be checkpointed", root)
+		}
+		overflowed, rootPositions, err := snapshotter.Snapshot()
+		if err != nil {
+			return nil, nil, err
+		}
+		tasks = append(tasks, overflowed...)
+		positions = append(positions, rootPositions...)
+	}
+	return tasks, positions, nil
+}
+
+// Release implements repository.TaskQueueSnapshotter
+func (q *PriorityTaskQueue) Release(positions []entity.SpillPosition) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, overflow := range q.overflows {
+		if snapshotter, ok := overflow.(repository.TaskQueueSnapshotter); ok {
+			snapshotter.Release(positions)
+		}
+	}
+}
+
+// Close closes the queue; remaining tasks can still be dequeued
+func (q *PriorityTaskQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	for _, overflow := range q.overflows {
+		overflow.Close()
+	}
+	q.cond.Broadcast()
+}
+
+// refill moves overflowed tasks into the heaps until the window is full,
+// taking one from each overflowing root in turn
+func (q *PriorityTaskQueue) refill() {
+	for empty := 0; q.length < q.window && q.overflowed > 0 && empty < len(q.overflowRoots); {
+		if q.nextOverflow >= len(q.overflowRoots) {
+			q.nextOverflow = 0
+		}
+		overflow := q.overflows[q.overflowRoots[q.nextOverflow]]
+		q.nextOverflow++
+		if overflow.Len() == 0 {
+			empty++
+			continue
+		}
+		empty = 0
+
+		// All access to the overflow queues happens under q.mu, so this
+		// cannot block
+		task, ok := overflow.Dequeue()
+		if !ok {
+			return
+		}
+		q.overflowed--
+		q.push(task)
+	}
+}
+
+// overflow returns the overflow queue of root, creating it on first use
+func (q *PriorityTaskQueue) overflow(root string) (repository.TaskQueue, error) {
+	if overflow, ok := q.overflows[root]; ok {
+		return overflow, nil
+	}
+
+	overflow, err := q.newOverflow(root)
+	if err != nil {
+		return nil, err
+	}
+	q.overflows[root] = overflow
+	q.overflowRoots = append(q.overflowRoots, root)
+	q.overflowed += overflow.Len()
+	return overflow, nil
+}
+
+// overflowLen returns the number of tasks of root waiting in its overflow
+// queue
+func (q *PriorityTaskQueue) overflowLen(root string) int {
+	if overflow, ok := q.overflows[root]; ok {
+		return overflow.Len()
+	}
+	return 0
+}
+
+// queuedTask is a task with its insertion sequence number
+type queuedTask struct {
+	task *entity.Task
+	seq  uint64
+}
+
+// taskHeap implements heap.Interface over a service.TaskPolicy
+type taskHeap struct {
+	policy service.TaskPolicy
+	items  []*queuedTask
+}
+
+func (h *taskHeap) Len() int { return len(h.items) }
+
+func (h *taskHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.policy.Less(a.task, b.task) {
+		return true
+	}
+	if h.policy.Less(b.task, a.task) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (h *taskHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *taskHeap) Push(x any) { h.items = append(h.items, x.(*queuedTask)) }
+
+func (h *taskHeap) Pop() any {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[:n-1]
+	return item
+}
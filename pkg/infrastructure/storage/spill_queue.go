@@ -0,0 +1,408 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/repository"
+)
+
+// SpillingTaskQueue implements repository.TaskQueue with a bounded in-memory
+// window. Tasks that do not fit are appended to on-disk segment logs and read
+// back in FIFO order once the window drains. Checkpoints reference the
+// segment logs instead of copying the spilled tasks, so segments are only
+// deleted once no saved checkpoint needs them.
+type SpillingTaskQueue struct {
+	dir         string
+	window      int
+	segmentSize int
+	journal     repository.TaskJournal
+
+	memory  []*entity.Task
+	diskLen int
+	spilled int64
+
+	// Segment being appended to
+	writeSeg    int
+	writeCount  int
+	writeOffset int64
+	writer      *os.File
+	bufWriter   *bufio.Writer
+
+	// Segment being read from
+	readSeg    int
+	readCount  int
+	readOffset int64
+	reader     *os.File
+	bufReader  *bufio.Reader
+
+	// Segments before removed are deleted; those from pinned on may be
+	// referenced by a checkpoint
+	removed int
+	pinned  int
+
+	closed bool
+	mu     sync.Mutex
+	cond   *sync.Cond
+}
+
+// SpillConfig holds spilling task queue configuration
+type SpillConfig struct {
+	// Dir holds the segment logs; it is cleared when the queue is created
+	Dir string
+	// Window is the maximum number of tasks kept in memory
+	Window int
+	// SegmentSize is the number of tasks per segment log
+	SegmentSize int
+	// Journal records the tasks handed out by Dequeue until they are done;
+	// nil when the queue is the overflow of another queue
+	Journal repository.TaskJournal
+	// Restore reopens the segment logs of a checkpoint instead of clearing Dir
+	Restore *entity.SpillPosition
+}
+
+// NewSpillingTaskQueue creates a new disk-spilling task queue
+func NewSpillingTaskQueue(config SpillConfig) (repository.TaskQueue, error) {
+	if config.Window <= 0 {
+		return nil, fmt.Errorf("spill queue window must be > 0, got %d", config.Window)
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = 10000
+	}
+
+	q := &SpillingTaskQueue{
+		dir:         config.Dir,
+		window:      config.Window,
+		segmentSize: config.SegmentSize,
+		journal:     config.Journal,
+		memory:      make([]*entity.Task, 0, config.Window),
+		pinned:      math.MaxInt,
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	if config.Restore != nil && config.Restore.Tasks > 0 {
+		if err := q.restore(*config.Restore); err != nil {
+			return nil, fmt.Errorf("failed to restore spilled tasks: %w", err)
+		}
+		return q, nil
+	}
+
+	// Leftovers of a run without a checkpoint to resume are stale
+	if err := os.RemoveAll(config.Dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// restore resumes reading the segment logs at a checkpointed position,
+// discarding whatever was spilled or read after the checkpoint
+func (q *SpillingTaskQueue) restore(position entity.SpillPosition) error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		var seg int
+		if _, err := fmt.Sscanf(entry.Name(), "segment-%06d.jsonl", &seg); err != nil {
+			continue
+		}
+		if seg < position.ReadSegment || seg > position.WriteSegment {
+			os.Remove(filepath.Join(q.dir, entry.Name()))
+		}
+	}
+
+	err = os.Truncate(q.segmentPath(position.WriteSegment), position.WriteOffset)
+	if err != nil && !(os.IsNotExist(err) && position.WriteOffset == 0) {
+		return err
+	}
+
+	q.diskLen = position.Tasks
+	q.readSeg = position.ReadSegment
+	q.readCount = position.ReadCount
+	q.readOffset = position.ReadOffset
+	q.writeSeg = position.WriteSegment
+	q.writeCount = position.WriteCount
+	q.writeOffset = position.WriteOffset
+	q.removed = position.ReadSegment
+	return nil
+}
+
+// Enqueue adds a task to the queue, spilling it to disk if the window is full
+func (q *SpillingTaskQueue) Enqueue(task *entity.Task) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+
+	// Once anything is on disk, newer tasks must follow it to keep FIFO order
+	if q.diskLen == 0 && len(q.memory) < q.window {
+		q.memory = append(q.memory, task)
+		q.cond.Signal()
+		return true
+	}
+
+	if err := q.spill(task); err != nil {
+		return false
+	}
+	q.diskLen++
+	q.spilled++
+	q.cond.Signal()
+	return true
+}
+
+// Dequeue removes and returns a task, blocking until one is available or the
+// queue is closed and drained
+func (q *SpillingTaskQueue) Dequeue() (*entity.Task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		for len(q.memory) == 0 && q.diskLen == 0 && !q.closed {
+			q.cond.Wait()
+		}
+
+		if len(q.memory) == 0 && q.diskLen > 0 {
+			q.refill()
+		}
+
+		if len(q.memory) > 0 {
+			task := q.memory[0]
+			q.memory[0] = nil
+			q.memory = q.memory[1:]
+			if q.journal != nil {
+				q.journal.Add(task)
+			}
+			return task, true
+		}
+
+		if q.closed && q.diskLen == 0 {
+			return nil, false
+		}
+	}
+}
+
+// Len returns the current queue length, including spilled tasks
+func (q *SpillingTaskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.memory) + q.diskLen
+}
+
+// Spilled returns the number of tasks written to disk so far
+func (q *SpillingTaskQueue) Spilled() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.spilled
+}
+
+// Snapshot implements repository.TaskQueueSnapshotter
+func (q *SpillingTaskQueue) Snapshot() ([]*entity.Task, []entity.SpillPosition, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tasks := slices.Clone(q.memory)
+	if q.diskLen == 0 {
+		return tasks, nil, nil
+	}
+
+	// The position must only cover tasks that reached the segment logs
+	if q.bufWriter != nil {
+		if err := q.bufWriter.Flush(); err != nil {
+			return nil, nil, err
+		}
+	}
+	q.pinned = min(q.pinned, q.readSeg)
+
+	return tasks, []entity.SpillPosition{{
+		Dir:          q.dir,
+		Tasks:        q.diskLen,
+		ReadSegment:  q.readSeg,
+		ReadCount:    q.readCount,
+		ReadOffset:   q.readOffset,
+		WriteSegment: q.writeSeg,
+		WriteCount:   q.writeCount,
+		WriteOffset:  q.writeOffset,
+	}}, nil
+}
+
+// Release implements repository.TaskQueueSnapshotter
+func (q *SpillingTaskQueue) Release(positions []entity.SpillPosition) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pinned = math.MaxInt
+	for _, position := range positions {
+		if position.Dir == q.dir {
+			q.pinned = position.ReadSegment
+		}
+	}
+	q.removeSegments(q.readSeg)
+}
+
+// Close closes the queue; remaining tasks can still be dequeued
+func (q *SpillingTaskQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// spill appends a task to the current write segment
+func (q *SpillingTaskQueue) spill(task *entity.Task) error {
+	if q.writer == nil {
+		file, err := os.OpenFile(q.segmentPath(q.writeSeg), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		q.writer = file
+		q.bufWriter = bufio.NewWriter(file)
+	}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	if _, err := q.bufWriter.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	q.writeCount++
+	q.writeOffset += int64(len(data)) + 1
+	if q.writeCount >= q.segmentSize {
+		if err := q.closeWriter(); err != nil {
+			return err
+		}
+		q.writeSeg++
+		q.writeCount = 0
+		q.writeOffset = 0
+	}
+	return nil
+}
+
+// refill moves up to a window of tasks from disk into memory. A segment that
+// cannot be read is discarded.
+func (q *SpillingTaskQueue) refill() {
+	for len(q.memory) < q.window && q.diskLen > 0 {
+		task, err := q.readOne()
+		if err != nil {
+			q.reset()
+			return
+		}
+		q.memory = append(q.memory, task)
+	}
+}
+
+// readOne reads the oldest spilled task
+func (q *SpillingTaskQueue) readOne() (*entity.Task, error) {
+	// Make buffered writes visible when reading the segment being written
+	if q.readSeg == q.writeSeg && q.bufWriter != nil {
+		if err := q.bufWriter.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.reader == nil {
+		file, err := os.Open(q.segmentPath(q.readSeg))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(q.readOffset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		q.reader = file
+		q.bufReader = bufio.NewReader(file)
+	}
+
+	line, err := q.bufReader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	var task entity.Task
+	if err := json.Unmarshal(line, &task); err != nil {
+		return nil, err
+	}
+
+	q.diskLen--
+	q.readCount++
+	q.readOffset += int64(len(line))
+
+	switch {
+	case q.diskLen == 0:
+		// Fully drained; start over with a fresh segment
+		q.reset()
+	case q.readCount >= q.segmentSize:
+		// Segment complete; the writer has already moved on
+		q.reader.Close()
+		q.reader = nil
+		q.readSeg++
+		q.readCount = 0
+		q.readOffset = 0
+		q.removeSegments(q.readSeg)
+	}
+
+	return &task, nil
+}
+
+// reset discards all segments and starts a new one
+func (q *SpillingTaskQueue) reset() {
+	if q.reader != nil {
+		q.reader.Close()
+		q.reader = nil
+	}
+	q.closeWriter()
+
+	q.diskLen = 0
+	q.writeSeg++
+	q.writeCount = 0
+	q.writeOffset = 0
+	q.readSeg = q.writeSeg
+	q.readCount = 0
+	q.readOffset = 0
+	q.removeSegments(q.readSeg)
+}
+
+// removeSegments deletes the segments before seg that no checkpoint may
+// reference
+func (q *SpillingTaskQueue) removeSegments(seg int) {
+	for ; q.removed < min(seg, q.pinned); q.removed++ {
+		os.Remove(q.segmentPath(q.removed))
+	}
+}
+
+// closeWriter flushes and closes the current write segment
+func (q *SpillingTaskQueue) closeWriter() error {
+	if q.writer == nil {
+		return nil
+	}
+
+	err := q.bufWriter.Flush()
+	if closeErr := q.writer.Close(); err == nil {
+		err = closeErr
+	}
+	q.writer = nil
+	q.bufWriter = nil
+	return err
+}
+
+// segmentPath returns the file name of a segment log
+func (q *SpillingTaskQueue) segmentPath(seg int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("segment-%06d.jsonl", seg))
+}
@@ -1,10 +1,14 @@
 package storage
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/repository"
 )
 
 func TestBloomFilter_Basic(t *testing.T) {
@@ -175,3 +179,393 @@ func TestResultQueue_Close(t *testing.T) {
 		t.Error("Receiving from closed empty queue should return false")
 	}
 }
+
+func TestTaskJournal_AddDone(t *testing.T) {
+	journal := NewTaskJournal()
+
+	task := &entity.Task{Domain: entity.Domain{Name: "www.example.com", Root: "example.com", Depth: 1}}
+
+	// The same domain may be enqueued twice and must stay pending until both complete
+	journal.Add(task)
+	journal.Add(task)
+	journal.Add(&entity.Task{Domain: entity.Domain{Name: "api.example.com", Root: "example.com", Depth: 1}})
+
+	if journal.Len() != 2 {
+		t.Errorf("Journal length should be 2, got %d", journal.Len())
+	}
+
+	journal.Done("www.example.com")
+	if journal.Len() != 2 {
+		t.Errorf("Journal should keep www.example.com until its last task is done, got length %d", journal.Len())
+	}
+
+	journal.Done("www.example.com")
+	journal.Done("unknown.example.com")
+
+	pending := journal.Pending()
+	if len(pending) != 1 || pending[0].Domain.Name != "api.example.com" {
+		t.Errorf("Pending() = %v, want only api.example.com", pending)
+	}
+}
+
+func TestCheckpointStore_SaveLoad(t *testing.T) {
+	store, err := NewCheckpointStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint store: %v", err)
+	}
+
+	checkpoint := &entity.Checkpoint{
+		RootDomains: []string{"example.com"},
+		Tasks: []*entity.Task{
+			{Domain: entity.Domain{Name: "www.example.com", Root: "example.com", Depth: 1}},
+		},
+		Metrics:      entity.Metrics{TasksProcessed: 42},
+		OutputOffset: 1234,
+	}
+
+	if err := store.Save(checkpoint); err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+
+	if len(loaded.Tasks) != 1 || loaded.Tasks[0].Domain.Name != "www.example.com" {
+		t.Errorf("Loaded tasks = %v, want www.example.com", loaded.Tasks)
+	}
+	if loaded.Metrics.TasksProcessed != 42 {
+		t.Errorf("Loaded TasksProcessed = %d, want 42", loaded.Metrics.TasksProcessed)
+	}
+	if loaded.OutputOffset != 1234 {
+		t.Errorf("Loaded OutputOffset = %d, want 1234", loaded.OutputOffset)
+	}
+}
+
+func TestResultWriter_Resume(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "result.jsonl")
+
+	writer, err := NewResultWriter(filename)
+	if err != nil {
+		t.Fatalf("Failed to create result writer: %v", err)
+	}
+	writer.Write(&entity.CrawlResult{Domain: "www.example.com"})
+	offset, err := writer.Offset()
+	if err != nil {
+		t.Fatalf("Failed to get offset: %v", err)
+	}
+	writer.Write(&entity.CrawlResult{Domain: "lost.example.com"})
+	writer.Close()
+
+	// Resuming drops the result written after the checkpoint offset
+	writer, err = ResumeResultWriter(filename, offset)
+	if err != nil {
+		t.Fatalf("Failed to resume result writer: %v", err)
+	}
+	writer.Write(&entity.CrawlResult{Domain: "api.example.com"})
+	writer.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+
+	content := string(data)
+	if strings.Contains(content, "lost.example.com") {
+		t.Error("Resumed output should not contain results after the checkpoint offset")
+	}
+	if !strings.Contains(content, "www.example.com") || !strings.Contains(content, "api.example.com") {
+		t.Errorf("Resumed output should keep earlier and new results, got %q", content)
+	}
+}
+
+func TestSpillingTaskQueue_Order(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := NewSpillingTaskQueue(SpillConfig{Dir: dir, Window: 2, SegmentSize: 3})
+	if err != nil {
+		t.Fatalf("Failed to create spilling queue: %v", err)
+	}
+
+	const total = 10
+	for i := 0; i < total; i++ {
+		task := &entity.Task{Domain: entity.Domain{Name: fmt.Sprintf("host%d.example.com", i)}}
+		if !queue.Enqueue(task) {
+			t.Fatalf("Enqueue(%d) should succeed", i)
+		}
+	}
+
+	if queue.Len() != total {
+		t.Errorf("Queue length should be %d, got %d", total, queue.Len())
+	}
+
+	if spilled := queue.(*SpillingTaskQueue).Spilled(); spilled != total-2 {
+		t.Errorf("Spilled() = %d, want %d", spilled, total-2)
+	}
+
+	// Interleave enqueues with dequeues to exercise the shared write segment
+	queue.Enqueue(&entity.Task{Domain: entity.Domain{Name: fmt.Sprintf("host%d.example.com", total)}})
+
+	for i := 0; i <= total; i++ {
+		task, ok := queue.Dequeue()
+		if !ok {
+			t.Fatalf("Dequeue(%d) should succeed", i)
+		}
+		if want := fmt.Sprintf("host%d.example.com", i); task.Domain.Name != want {
+			t.Errorf("Dequeue(%d) = %s, want %s", i, task.Domain.Name, want)
+		}
+	}
+
+	if queue.Len() != 0 {
+		t.Errorf("Queue should be empty, got length %d", queue.Len())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Drained queue should leave no segments, found %d", len(entries))
+	}
+}
+
+func TestSpillingTaskQueue_SnapshotRestore(t *testing.T) {
+	dir := t.TempDir()
+	journal := NewTaskJournal()
+	queue, err := NewSpillingTaskQueue(SpillConfig{Dir: dir, Window: 2, SegmentSize: 3, Journal: journal})
+	if err != nil {
+		t.Fatalf("Failed to create spilling queue: %v", err)
+	}
+	name := func(i int) string { return fmt.Sprintf("host%d.example.com", i) }
+
+	for i := 0; i < 10; i++ {
+		queue.Enqueue(&entity.Task{Domain: entity.Domain{Name: name(i)}})
+	}
+	// Read into the second segment so the snapshot starts mid-segment
+	for i := 0; i < 5; i++ {
+		queue.Dequeue()
+	}
+	if journal.Len() != 5 {
+		t.Errorf("Journal length = %d, want 5 dequeued tasks", journal.Len())
+	}
+
+	snapshotter := queue.(repository.TaskQueueSnapshotter)
+	tasks, positions, err := snapshotter.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Domain.Name != name(5) {
+		t.Errorf("Snapshot() tasks = %v, want [%s]", tasks, name(5))
+	}
+	if len(positions) != 1 || positions[0].Tasks != 4 {
+		t.Fatalf("Snapshot() positions = %+v, want 4 spilled tasks", positions)
+	}
+
+	// Work done after the snapshot is discarded on restore
+	queue.Enqueue(&entity.Task{Domain: entity.Domain{Name: name(10)}})
+	for i := 0; i < 6; i++ {
+		queue.Dequeue()
+	}
+	queue.Close()
+
+	restored, err := NewSpillingTaskQueue(SpillConfig{Dir: dir, Window: 2, SegmentSize: 3, Restore: &positions[0]})
+	if err != nil {
+		t.Fatalf("Failed to restore spilling queue: %v", err)
+	}
+	if restored.Len() != 4 {
+		t.Errorf("Restored queue length = %d, want 4", restored.Len())
+	}
+	for i := 6; i < 10; i++ {
+		task, ok := restored.Dequeue()
+		if !ok {
+			t.Fatalf("Dequeue(%d) should succeed", i)
+		}
+		if task.Domain.Name != name(i) {
+			t.Errorf("Dequeue(%d) = %s, want %s", i, task.Domain.Name, name(i))
+		}
+	}
+
+	// Segments are deleted once no checkpoint references them
+	restored.(repository.TaskQueueSnapshotter).Release(nil)
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Released queue should leave no segments, found %d", len(entries))
+	}
+}
+
+func TestSpillingTaskQueue_Close(t *testing.T) {
+	queue, err := NewSpillingTaskQueue(SpillConfig{Dir: t.TempDir(), Window: 1})
+	if err != nil {
+		t.Fatalf("Failed to create spilling queue: %v", err)
+	}
+
+	task := &entity.Task{Domain: entity.Domain{Name: "example.com"}}
+	queue.Enqueue(task)
+	queue.Enqueue(task)
+
+	queue.Close()
+
+	if queue.Enqueue(task) {
+		t.Error("Enqueue should fail after close")
+	}
+
+	// Both the in-memory and the spilled task drain after close
+	for i := 0; i < 2; i++ {
+		if _, ok := queue.Dequeue(); !ok {
+			t.Errorf("Dequeue(%d) should drain remaining tasks after close", i)
+		}
+	}
+
+	if _, ok := queue.Dequeue(); ok {
+		t.Error("Dequeue from closed empty queue should return false")
+	}
+}
+
+// depthPolicy orders tasks by depth only
+type depthPolicy struct{}
+
+func (depthPolicy) Less(a, b *entity.Task) bool {
+	return a.Domain.Depth < b.Domain.Depth
+}
+
+func TestPriorityTaskQueue_Order(t *testing.T) {
+	queue, err := NewPriorityTaskQueue(depthPolicy{}, PriorityConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create priority queue: %v", err)
+	}
+
+	tasks := []entity.Domain{
+		{Name: "a.b.example.com", Root: "example.com", Depth: 2},
+		{Name: "a.example.com", Root: "example.com", Depth: 1},
+		{Name: "b.example.com", Root: "example.com", Depth: 1},
+		{Name: "a.test.com", Root: "test.com", Depth: 1},
+		{Name: "a.b.test.com", Root: "test.com", Depth: 2},
+	}
+	for _, domain := range tasks {
+		queue.Enqueue(&entity.Task{Domain: domain})
+	}
+
+	// Shallow first within a root, FIFO among equals, roots take turns
+	expected := []string{"a.example.com", "a.test.com", "b.example.com", "a.b.test.com", "a.b.example.com"}
+	for i, want := range expected {
+		task, ok := queue.Dequeue()
+		if !ok {
+			t.Fatalf("Dequeue(%d) should succeed", i)
+		}
+		if task.Domain.Name != want {
+			t.Errorf("Dequeue(%d) = %s, want %s", i, task.Domain.Name, want)
+		}
+	}
+}
+
+func TestPriorityTaskQueue_Overflow(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := NewPriorityTaskQueue(depthPolicy{}, PriorityConfig{Window: 2, Overflow: func(root string) (repository.TaskQueue, error) {
+		return NewSpillingTaskQueue(SpillConfig{Dir: filepath.Join(dir, root), Window: 1})
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create priority queue: %v", err)
+	}
+
+	for depth := 4; depth > 0; depth-- {
+		name := fmt.Sprintf("host%d.example.com", depth)
+		queue.Enqueue(&entity.Task{Domain: entity.Domain{Name: name, Root: "example.com", Depth: depth}})
+	}
+
+	if queue.Len() != 4 {
+		t.Errorf("Queue length should be 4, got %d", queue.Len())
+	}
+	if spilled := queue.(*PriorityTaskQueue).Spilled(); spilled != 1 {
+		t.Errorf("Spilled() = %d, want 1", spilled)
+	}
+
+	// Only tasks inside the window are reordered
+	queue.Close()
+	expected := []string{"host3.example.com", "host2.example.com", "host1.example.com", "host4.example.com"}
+	for i, want := range expected {
+		task, ok := queue.Dequeue()
+		if !ok {
+			t.Fatalf("Dequeue(%d) should succeed", i)
+		}
+		if task.Domain.Name != want {
+			t.Errorf("Dequeue(%d) = %s, want %s", i, task.Domain.Name, want)
+		}
+	}
+
+	if _, ok := queue.Dequeue(); ok {
+		t.Error("Dequeue on a closed, drained queue should fail")
+	}
+}
+
+func TestPriorityTaskQueue_OverflowPerRoot(t *testing.T) {
+	queue, err := NewPriorityTaskQueue(depthPolicy{}, PriorityConfig{Window: 2, Overflow: func(root string) (repository.TaskQueue, error) {
+		return NewTaskQueue(100), nil
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create priority queue: %v", err)
+	}
+
+	// A large root fills the window and overflows before a small one arrives
+	for i := 1; i <= 4; i++ {
+		name := fmt.Sprintf("host%d.big.com", i)
+		queue.Enqueue(&entity.Task{Domain: entity.Domain{Name: name, Root: "big.com", Depth: 1}})
+	}
+	for i := 1; i <= 2; i++ {
+		name := fmt.Sprintf("host%d.small.com", i)
+		queue.Enqueue(&entity.Task{Domain: entity.Domain{Name: name, Root: "small.com", Depth: 1}})
+	}
+
+	// The window is refilled from both overflows in turn, so the small root
+	// does not wait for the large one to drain
+	expected := []string{"host1.big.com", "host2.big.com", "host1.small.com", "host3.big.com", "host2.small.com", "host4.big.com"}
+	for i, want := range expected {
+		task, ok := queue.Dequeue()
+		if !ok {
+			t.Fatalf("Dequeue(%d) should succeed", i)
+		}
+		if task.Domain.Name != want {
+			t.Errorf("Dequeue(%d) = %s, want %s", i, task.Domain.Name, want)
+		}
+	}
+}
+
+func TestPriorityTaskQueue_SnapshotRestore(t *testing.T) {
+	dir := t.TempDir()
+	config := PriorityConfig{Window: 1, Overflow: func(root string) (repository.TaskQueue, error) {
+		return NewSpillingTaskQueue(SpillConfig{Dir: filepath.Join(dir, root), Window: 1})
+	}}
+	queue, err := NewPriorityTaskQueue(depthPolicy{}, config)
+	if err != nil {
+		t.Fatalf("Failed to create priority queue: %v", err)
+	}
+	for _, root := range []string{"a.com", "b.com"} {
+		for i := 0; i < 3; i++ {
+			queue.Enqueue(&entity.Task{Domain: entity.Domain{Name: fmt.Sprintf("host%d.%s", i, root), Root: root}})
+		}
+	}
+
+	tasks, positions, err := queue.(repository.TaskQueueSnapshotter).Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	// One task in the window, one in memory per overflow, the rest spilled
+	if len(tasks) != 3 || len(positions) != 2 {
+		t.Fatalf("Snapshot() = %d tasks, %+v, want 3 tasks and 2 positions", len(tasks), positions)
+	}
+	queue.Close()
+
+	config.Roots = []string{"a.com", "b.com"}
+	config.Overflow = func(root string) (repository.TaskQueue, error) {
+		dir := filepath.Join(dir, root)
+		for i := range positions {
+			if positions[i].Dir == dir {
+				return NewSpillingTaskQueue(SpillConfig{Dir: dir, Window: 1, Restore: &positions[i]})
+			}
+		}
+		return NewSpillingTaskQueue(SpillConfig{Dir: dir, Window: 1})
+	}
+	restored, err := NewPriorityTaskQueue(depthPolicy{}, config)
+	if err != nil {
+		t.Fatalf("Failed to restore priority queue: %v", err)
+	}
+	if restored.Len() != 3 {
+		t.Errorf("Restored queue length = %d, want the 3 spilled tasks", restored.Len())
+	}
+}
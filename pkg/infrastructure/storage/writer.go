@@ -2,6 +2,7 @@ package storage
 
 import (
 	"encoding/json"
+	"io"
 	"os"
 	"sync"
 
@@ -29,6 +30,29 @@ func NewResultWriter(filename string) (repository.ResultWriter, error) {
 	}, nil
 }
 
+// ResumeResultWriter reopens a result file, discarding anything written after
+// offset so that results of tasks which will be crawled again are not duplicated
+func ResumeResultWriter(filename string, offset int64) (repository.ResultWriter, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &ResultWriter{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
 // Write writes a single result
 func (w *ResultWriter) Write(result *entity.CrawlResult) error {
 	w.mu.Lock()
@@ -45,6 +69,14 @@ func (w *ResultWriter) Flush() error {
 	return w.file.Sync()
 }
 
+// Offset returns the number of bytes written to the output so far
+func (w *ResultWriter) Offset() (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Seek(0, io.SeekCurrent)
+}
+
 // Close closes the writer
 func (w *ResultWriter) Close() error {
 	w.mu.Lock()
@@ -83,6 +115,27 @@ func NewLogWriter(httpLogFile, dnsLogFile string) (repository.LogWriter, error)
 	}, nil
 }
 
+// ResumeLogWriter reopens existing log files for appending
+func ResumeLogWriter(httpLogFile, dnsLogFile string) (repository.LogWriter, error) {
+	httpFile, err := os.OpenFile(httpLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	dnsFile, err := os.OpenFile(dnsLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		httpFile.Close()
+		return nil, err
+	}
+
+	return &LogWriter{
+		httpFile: httpFile,
+		dnsFile:  dnsFile,
+		httpEnc:  json.NewEncoder(httpFile),
+		dnsEnc:   json.NewEncoder(dnsFile),
+	}, nil
+}
+
 // WriteHTTPLog writes an HTTP request/response log
 func (w *LogWriter) WriteHTTPLog(data any) error {
 	w.mu.Lock()
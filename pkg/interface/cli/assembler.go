@@ -2,14 +2,21 @@ package cli
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/WangYihang/Subdomain-Crawler/pkg/application"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/entity"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/repository"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/domain/service"
 	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/dns"
 	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/domainservice"
 	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/http"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/ratelimit"
+	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/retry"
 	"github.com/WangYihang/Subdomain-Crawler/pkg/infrastructure/storage"
 )
 
@@ -25,10 +32,46 @@ func NewAssembler(config *Config) *Assembler {
 
 // AssembleUseCase assembles the crawl use case with all dependencies
 func (a *Assembler) AssembleUseCase() (*application.CrawlUseCase, error) {
-	// Load root domains
-	rootDomains, err := a.loadRootDomains()
+	// Open the session used for checkpoints
+	checkpoints, err := storage.NewCheckpointStore(a.config.SessionDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load root domains: %w", err)
+		return nil, fmt.Errorf("failed to open session directory: %w", err)
+	}
+
+	// A new crawl would overwrite the checkpoint and spilled tasks of the
+	// session, which can only be resumed as long as they are there
+	if a.config.Resume == "" && !a.config.Force {
+		if _, err := checkpoints.Load(); !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("session directory %s holds a checkpoint; pass --resume %s to continue that crawl or --force to discard it", a.config.SessionDir, a.config.SessionDir)
+		}
+	}
+
+	// Restore output paths and root domains when resuming a session
+	var checkpoint *entity.Checkpoint
+	var rootDomains []string
+	if a.config.Resume != "" {
+		checkpoint, err = checkpoints.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+		}
+		a.config.OutputFile = checkpoint.OutputFile
+		a.config.HTTPLogFile = checkpoint.HTTPLogFile
+		a.config.DNSLogFile = checkpoint.DNSLogFile
+		a.config.BloomFilterFile = checkpoint.BloomFilterFile
+		rootDomains = checkpoint.RootDomains
+	} else {
+		// Load root domains
+		rootDomains, err = a.loadRootDomains()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load root domains: %w", err)
+		}
+
+		// Checkpoints record absolute paths so a session can be resumed from anywhere
+		for _, path := range []*string{&a.config.OutputFile, &a.config.HTTPLogFile, &a.config.DNSLogFile, &a.config.BloomFilterFile} {
+			if abs, err := filepath.Abs(*path); err == nil {
+				*path = abs
+			}
+		}
 	}
 
 	if len(rootDomains) == 0 {
@@ -40,19 +83,153 @@ func (a *Assembler) AssembleUseCase() (*application.CrawlUseCase, error) {
 	calculator := domainservice.NewCalculator()
 	extractor := domainservice.NewExtractor()
 
+	// Create rate limiter shared by HTTP and DNS
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		Global: ratelimit.Rate{PerSecond: a.config.RateLimit},
+		PerKey: map[string]ratelimit.Rate{
+			service.RateKeyRoot:      {PerSecond: a.config.RootRateLimit},
+			service.RateKeyIP:        {PerSecond: a.config.IPRateLimit},
+			service.RateKeyDNSServer: {PerSecond: a.config.DNSServerRateLimit},
+		},
+	})
+
+	// Create retry policy shared by HTTP and DNS
+	retryPolicy := retry.NewPolicy(retry.Config{
+		MaxTries:  a.config.Retries + 1,
+		BaseDelay: a.config.RetryDelayDuration,
+		MaxDelay:  a.config.RetryMaxDelayDuration,
+	})
+
 	// Create HTTP fetcher
 	fetcher := http.NewFetcher(http.Config{
-		Timeout:         a.config.HTTPTimeoutDuration,
-		MaxResponseSize: a.config.MaxResponseSize,
-		UserAgent:       a.config.UserAgent,
+		Timeout:            a.config.HTTPTimeoutDuration,
+		MaxResponseSize:    a.config.MaxResponseSize,
+		UserAgent:          a.config.UserAgent,
+		InsecureSkipVerify: a.config.Insecure,
+		RedirectPolicy:     a.config.RedirectPolicy,
+		MaxRedirects:       a.config.MaxRedirects,
+		Scope:              validator,
+		Limiter:            limiter,
+		Roots:              rootDomains,
+		Retry:              retryPolicy,
 	})
 
-	// Create DNS resolver
-	resolver := dns.NewResolver(dns.Config{
-		Servers: a.config.DNSServers,
-		Timeout: a.config.DNSTimeoutDuration,
+	// Create DNS resolver; the system configuration overrides the timeout and retries
+	dnsServers, system, err := a.loadDNSServers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load DNS servers: %w", err)
+	}
+	dnsConfig := dns.Config{
+		Servers:     dnsServers,
+		Timeout:     a.config.DNSTimeoutDuration,
+		RecordTypes: dns.RecordTypes(a.config.RecordTypes),
+		Limiter:     limiter,
+		Retry:       retryPolicy,
+
+		EDNSBufferSize: a.config.EDNSSize,
+
+		Race:               a.config.DNSRace,
+		QuarantineDuration: a.config.DNSQuarantineDuration,
+		CanaryDomain:       a.config.DNSCanary,
+	}
+	if system != nil {
+		dnsConfig.Search = system.Search
+		dnsConfig.Ndots = system.Ndots
+		dnsConfig.Timeout = system.Timeout
+		dnsConfig.Retry = retry.NewPolicy(retry.Config{
+			MaxTries:  system.Attempts,
+			BaseDelay: a.config.RetryDelayDuration,
+			MaxDelay:  a.config.RetryMaxDelayDuration,
+		})
+	}
+	var resolver service.DNSResolver
+	if a.config.Iterative {
+		resolver = dns.NewIterativeResolver(dns.IterativeConfig{
+			RootHints:      a.config.RootHints,
+			Timeout:        dnsConfig.Timeout,
+			RecordTypes:    dns.RecordTypes(a.config.RecordTypes),
+			Limiter:        limiter,
+			Retry:          dnsConfig.Retry,
+			PinnedRoots:    a.config.PinnedRoots,
+			EDNSBufferSize: a.config.EDNSSize,
+		})
+	} else {
+		resolver = dns.NewResolver(dnsConfig)
+	}
+	if a.config.DNSCacheSize > 0 {
+		resolver = dns.NewCachingResolver(resolver, dns.CacheConfig{
+			MaxTTL:     a.config.DNSCacheMaxTTLDuration,
+			MaxEntries: a.config.DNSCacheSize,
+		})
+	}
+
+	// Create wildcard detector
+	wildcard := dns.NewWildcardDetector(resolver, dns.WildcardConfig{
+		Probes: a.config.WildcardProbes,
 	})
 
+	// Create zone transferer for the pre-crawl phase
+	var transferer service.ZoneTransferer
+	if a.config.ZoneTransfer {
+		transferer = dns.NewZoneTransferer(resolver, dns.TransferConfig{
+			Timeout: dnsConfig.Timeout,
+			Limiter: limiter,
+		})
+	}
+
+	// Create zone walker for DNSSEC-signed roots
+	var walker service.ZoneWalker
+	if a.config.ZoneWalk {
+		walker = dns.NewZoneWalker(resolver, dns.WalkConfig{
+			Timeout:  dnsConfig.Timeout,
+			Limiter:  limiter,
+			Wordlist: domainservice.NewExpander(nil).Subdomains(),
+		})
+	}
+
+	// Create wordlist for brute forcing
+	var wordlist service.Wordlist
+	if len(a.config.Wordlists) > 0 {
+		wordlist = domainservice.NewWordlist(a.config.Wordlists)
+	}
+
+	// Create permutator for discovered names
+	var permutator service.Permutator
+	if a.config.Permute {
+		permutator = domainservice.NewPermutator(domainservice.PermutatorConfig{
+			Rules:      a.config.PermuteRules,
+			Words:      a.config.PermuteWords,
+			MaxPerRoot: a.config.PermuteMaxPerRoot,
+		})
+	}
+
+	// Create PTR sweeper for discovered addresses
+	var sweeper service.PTRSweeper
+	if a.config.PTRSweep {
+		sweeper = dns.NewPTRSweeper(resolver, dns.SweepConfig{
+			PrefixLength: a.config.PTRPrefix,
+			Concurrency:  a.config.PTRWorkers,
+			SkipRanges:   append(append([]string{}, dns.DefaultCDNRanges...), a.config.PTRSkipCIDRs...),
+		})
+	}
+
+	// Create virtual host prober; redirects and certificates of the probed
+	// names are beside the point, only how the response differs matters.
+	// Failed baselines are retried, or the protocol would go unprobed.
+	var prober service.VHostProber
+	if a.config.VHostProbe {
+		prober = http.NewVHostProber(http.NewFetcher(http.Config{
+			Timeout:            a.config.HTTPTimeoutDuration,
+			MaxResponseSize:    a.config.MaxResponseSize,
+			UserAgent:          a.config.UserAgent,
+			InsecureSkipVerify: true,
+			RedirectPolicy:     http.RedirectNone,
+			Limiter:            limiter,
+			Roots:              rootDomains,
+			Retry:              retryPolicy,
+		}), http.VHostConfig{Concurrency: a.config.VHostWorkers})
+	}
+
 	// Create repositories
 	filter := storage.NewBloomFilter(storage.Config{
 		Size:              a.config.RealBloomFilterSize,
@@ -64,15 +241,74 @@ func (a *Assembler) AssembleUseCase() (*application.CrawlUseCase, error) {
 		fmt.Fprintf(os.Stderr, "Warning: failed to load bloom filter: %v\n", err)
 	}
 
-	taskQueue := storage.NewTaskQueue(a.config.QueueSize)
+	// Queues journal the tasks they hand out; checkpoints reference the
+	// spilled ones in place
+	journal := storage.NewTaskJournal()
+	queueDir, err := filepath.Abs(filepath.Join(a.config.SessionDir, "queue"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate task queue: %w", err)
+	}
+	var taskQueue repository.TaskQueue
+	if a.config.QueueOrder == "priority" {
+		// Order tasks within the in-memory window; each root spills the rest
+		// to a queue of its own
+		var roots []string
+		if checkpoint == nil {
+			err = os.RemoveAll(queueDir)
+		} else {
+			for _, spill := range checkpoint.Spills {
+				if filepath.Dir(spill.Dir) == queueDir {
+					roots = append(roots, filepath.Base(spill.Dir))
+				}
+			}
+		}
+		if err == nil {
+			taskQueue, err = storage.NewPriorityTaskQueue(
+				domainservice.NewTaskPolicy(a.config.BoostedSources),
+				storage.PriorityConfig{
+					Window: a.config.QueueSize,
+					Overflow: func(root string) (repository.TaskQueue, error) {
+						dir := filepath.Join(queueDir, root)
+						return storage.NewSpillingTaskQueue(storage.SpillConfig{
+							Dir:     dir,
+							Window:  overflowWindow,
+							Restore: spillPosition(checkpoint, dir),
+						})
+					},
+					Roots:   roots,
+					Journal: journal,
+				},
+			)
+		}
+	} else {
+		taskQueue, err = storage.NewSpillingTaskQueue(storage.SpillConfig{
+			Dir:     queueDir,
+			Window:  a.config.QueueSize,
+			Journal: journal,
+			Restore: spillPosition(checkpoint, queueDir),
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task queue: %w", err)
+	}
 	resultQueue := storage.NewResultQueue(a.config.QueueSize)
 
-	resultWriter, err := storage.NewResultWriter(a.config.OutputFile)
+	var resultWriter repository.ResultWriter
+	if checkpoint != nil {
+		resultWriter, err = storage.ResumeResultWriter(a.config.OutputFile, checkpoint.OutputOffset)
+	} else {
+		resultWriter, err = storage.NewResultWriter(a.config.OutputFile)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create result writer: %w", err)
 	}
 
-	logWriter, err := storage.NewLogWriter(a.config.HTTPLogFile, a.config.DNSLogFile)
+	var logWriter repository.LogWriter
+	if checkpoint != nil {
+		logWriter, err = storage.ResumeLogWriter(a.config.HTTPLogFile, a.config.DNSLogFile)
+	} else {
+		logWriter, err = storage.NewLogWriter(a.config.HTTPLogFile, a.config.DNSLogFile)
+	}
 	if err != nil {
 		resultWriter.Close()
 		return nil, fmt.Errorf("failed to create log writer: %w", err)
@@ -86,22 +322,96 @@ func (a *Assembler) AssembleUseCase() (*application.CrawlUseCase, error) {
 			Protocols:       a.config.Protocols,
 			RootDomains:     rootDomains,
 			BloomFilterFile: a.config.BloomFilterFile,
+			WildcardMode:    a.config.WildcardMode,
+
+			BruteForceWorkers:    a.config.BruteForceWorkers,
+			RecursiveDepth:       a.config.RecursiveDepth,
+			RecursiveMinChildren: a.config.RecursiveMinChildren,
+			RecursiveWords:       domainservice.NewExpander(nil).Subdomains(),
+			VHostMaxNames:        a.config.VHostMaxNames,
+			PTRBlocks:            a.config.PTRBlocks,
+
+			OutputFile:         a.config.OutputFile,
+			HTTPLogFile:        a.config.HTTPLogFile,
+			DNSLogFile:         a.config.DNSLogFile,
+			CheckpointInterval: a.config.CheckpointIntervalDuration,
+			Resume:             checkpoint,
 		},
 		validator,
 		calculator,
 		extractor,
 		fetcher,
 		resolver,
+		wildcard,
+		limiter,
+		transferer,
+		walker,
+		wordlist,
+		permutator,
+		sweeper,
+		prober,
 		filter,
 		taskQueue,
 		resultQueue,
 		resultWriter,
 		logWriter,
+		journal,
+		checkpoints,
 	)
 
 	return useCase, nil
 }
 
+// loadDNSServers collects the DNS servers given as flags and in the resolvers
+// file. It also returns the system configuration if "system" is one of them.
+func (a *Assembler) loadDNSServers() ([]string, *dns.SystemConfig, error) {
+	entries := append([]string{}, a.config.DNSServers...)
+
+	if a.config.ResolversFile != "" {
+		file, err := os.Open(a.config.ResolversFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var servers []string
+	var system *dns.SystemConfig
+	for _, entry := range entries {
+		if strings.EqualFold(entry, "system") {
+			if system == nil {
+				config, err := dns.LoadSystemConfig(dns.DefaultResolvConf)
+				if err != nil {
+					return nil, nil, err
+				}
+				system = config
+				servers = append(servers, system.Servers...)
+			}
+			continue
+		}
+
+		server, err := dns.ParseServer(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		servers = append(servers, server)
+	}
+
+	return servers, system, nil
+}
+
 // loadRootDomains loads root domains from input
 func (a *Assembler) loadRootDomains() ([]string, error) {
 	var scanner *bufio.Scanner
@@ -157,3 +467,21 @@ func (a *Assembler) expandSLDs(domains []string) []string {
 
 	return expanded
 }
+
+// overflowWindow is the number of overflowed tasks each root of a priority
+// queue keeps in memory before spilling to disk
+const overflowWindow = 100
+
+// spillPosition returns the position of the spilling queue in dir recorded
+// by a checkpoint, or nil
+func spillPosition(checkpoint *entity.Checkpoint, dir string) *entity.SpillPosition {
+	if checkpoint == nil {
+		return nil
+	}
+	for i := range checkpoint.Spills {
+		if checkpoint.Spills[i].Dir == dir {
+			return &checkpoint.Spills[i]
+		}
+	}
+	return nil
+}
@@ -2,10 +2,13 @@ package cli
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
+	"github.com/miekg/dns"
 )
 
 // Config holds all application configuration
@@ -19,25 +22,95 @@ type Config struct {
 	// Crawling
 	MaxDepth   int  `long:"max-depth" description:"Maximum subdomain depth to crawl" default:"3"`
 	NumWorkers int  `long:"workers" description:"Number of concurrent workers" default:"32"`
-	QueueSize  int  `long:"queue-size" description:"Size of task queue" default:"10000"`
+	QueueSize  int  `long:"queue-size" description:"Number of tasks kept in memory; the rest spill to the session directory" default:"10000"`
 	ExpandSLD  bool `long:"expand-sld" description:"Automatically expand SLD with common subdomains (www, api, mail, etc.)"`
 
+	// Brute force
+	Wordlists         []string `long:"wordlist" description:"File of subdomain labels, one per line, resolved under every root domain; names that resolve are crawled (repeatable)"`
+	BruteForceWorkers int      `long:"brute-workers" description:"Number of concurrent resolutions of wordlist, permutation and recursive guesses" default:"64"`
+
+	// Recursion
+	RecursiveDepth       int `long:"recurse-depth" description:"Deepest discovered subdomain brute forced with the common subdomain list when it has its own NS/SOA records or enough children (0 disables)" default:"0"`
+	RecursiveMinChildren int `long:"recurse-min-children" description:"Number of resolving children after which a subdomain is brute forced without NS/SOA records" default:"3"`
+
+	// Permutation
+	Permute           bool     `long:"permute" description:"Resolve permutations of discovered subdomains (api-dev -> api-staging, api-dev2, dev.api) and crawl those that exist"`
+	PermuteRules      []string `long:"permute-rule" description:"Permutation rule to apply (repeatable; defaults to all)" choice:"insert" choice:"swap" choice:"increment" choice:"join"`
+	PermuteWords      []string `long:"permute-word" description:"Token combined with discovered names in addition to those learned from them (repeatable; defaults to common environments and regions)"`
+	PermuteMaxPerRoot int      `long:"permute-max" description:"Maximum number of permutations resolved per root domain" default:"1000"`
+
+	// Scheduling
+	QueueOrder     string   `long:"queue-order" description:"Order in which queued tasks are crawled" choice:"priority" choice:"fifo" default:"priority"`
+	BoostedSources []string `long:"boost-source" description:"Discovery source prefix crawled first among tasks of equal depth (repeatable)" default:"tls:" default:"dns:"`
+
 	Protocols []string
 
 	// HTTP
 	HTTPTimeout     int    `long:"http-timeout" description:"HTTP request timeout in seconds" default:"10"`
 	MaxResponseSize int64  `long:"max-response-size" description:"Maximum HTTP response size in bytes" default:"10485760"`
 	UserAgent       string `long:"user-agent" description:"HTTP User-Agent header" default:"SubdomainCrawler/2.0"`
+	Insecure        bool   `long:"insecure" description:"Accept invalid TLS certificates so their names can still be harvested"`
+	RedirectPolicy  string `long:"redirect-policy" description:"Which HTTP redirects to follow" choice:"follow" choice:"none" choice:"in-scope" default:"follow"`
+	MaxRedirects    int    `long:"max-redirects" description:"Maximum number of HTTP redirects to follow" default:"10"`
+
+	VHostProbe    bool `long:"vhost-probe" description:"After crawling, request names without public DNS and wordlist names from the discovered IPs of each root domain, and report those served as distinct virtual hosts; HTTPS probes send each name as SNI without verifying certificates"`
+	VHostMaxNames int  `long:"vhost-max-names" description:"Maximum number of names probed per root domain by --vhost-probe" default:"1000"`
+	VHostWorkers  int  `long:"vhost-workers" description:"Number of concurrent requests per probed IP" default:"8"`
 
 	// Real HTTP timeout duration (not parsed from flags directly)
 	HTTPTimeoutDuration time.Duration
 
 	// DNS
-	DNSTimeout int `long:"dns-timeout" description:"DNS query timeout in seconds" default:"5"`
+
+	DNSServers    []string `long:"resolver" description:"DNS server as IP, host:port, [IPv6]:port, a udp://, tcp://, tls:// (DoT) or https:// (DoH) URL, or \"system\" for the nameservers, search, ndots, timeout and attempts of /etc/resolv.conf (repeatable)"`
+	ResolversFile string   `long:"resolvers-file" description:"File with DNS servers, one per line"`
+	DNSTimeout    int      `long:"dns-timeout" description:"DNS query timeout in seconds" default:"5"`
+	RecordTypes   []string `long:"record-type" description:"DNS record type to query for each subdomain besides A and AAAA, which are always queried; replaces the default MX, NS and TXT (repeatable)"`
+	EDNSSize      uint16   `long:"edns-size" description:"EDNS0 UDP payload size advertised in DNS queries; truncated answers are retried over TCP (0 disables EDNS0)" default:"1232"`
+
+	DNSRace       bool   `long:"dns-race" description:"Send each DNS query to the two best servers at once and take the first answer"`
+	DNSQuarantine int    `long:"dns-quarantine" description:"Seconds to stop using a DNS server that gives hijacked or inconsistent answers" default:"300"`
+	DNSCanary     string `long:"dns-canary" description:"Domain without wildcard records used to detect NXDOMAIN-hijacking DNS servers (empty disables)" default:"example.com"`
+
+	Iterative   bool     `long:"iterative" description:"Resolve names by walking from the root servers to their authoritative nameservers instead of asking the DNS servers"`
+	RootHints   []string `long:"root-hint" description:"Root server address used by --iterative (repeatable; defaults to the IANA root servers)"`
+	PinnedRoots []string `long:"pin-root" description:"Root domain whose authoritative nameservers --iterative queries directly once found (repeatable)"`
+
+	ZoneTransfer bool `long:"zone-transfer" description:"Attempt AXFR and IXFR zone transfers from the nameservers of each root domain before crawling"`
+	ZoneWalk     bool `long:"zone-walk" description:"Enumerate DNSSEC-signed root domains through their NSEC chain, or match their NSEC3 hashes against the subdomain wordlist, before crawling"`
+
+	PTRSweep     bool     `long:"ptr-sweep" description:"Look up the PTR names of the address blocks around discovered IPs and crawl those in scope"`
+	PTRPrefix    int      `long:"ptr-prefix" description:"Prefix length of the IPv4 blocks swept by --ptr-sweep, from 22 (1024 addresses) to 32" default:"24"`
+	PTRWorkers   int      `long:"ptr-workers" description:"Number of concurrent PTR lookups per swept block" default:"16"`
+	PTRBlocks    int      `long:"ptr-blocks" description:"Number of address blocks swept at once" default:"4"`
+	PTRSkipCIDRs []string `long:"ptr-skip-cidr" description:"CIDR block never swept, in addition to the known CDN ranges (repeatable)"`
+
+	DNSCacheSize   int `long:"dns-cache-size" description:"Number of DNS resolutions cached for the TTL of their records (0 disables caching)" default:"100000"`
+	DNSCacheMaxTTL int `long:"dns-cache-max-ttl" description:"Maximum seconds a DNS resolution is cached" default:"3600"`
 
 	// Real DNS timeout duration
-	DNSTimeoutDuration time.Duration
-	DNSServers         []string
+	DNSTimeoutDuration     time.Duration
+	DNSQuarantineDuration  time.Duration
+	DNSCacheMaxTTLDuration time.Duration
+
+	// Wildcard
+	WildcardMode   string `long:"wildcard" description:"How to handle subdomains matching a wildcard DNS fingerprint" choice:"tag" choice:"drop" choice:"off" default:"tag"`
+	WildcardProbes int    `long:"wildcard-probes" description:"Number of random labels probed per parent domain" default:"2"`
+
+	// Rate limiting (requests per second, 0 = unlimited)
+	RateLimit          float64 `long:"rate-limit" description:"Maximum HTTP requests and DNS queries per second overall" default:"0"`
+	RootRateLimit      float64 `long:"root-rate-limit" description:"Maximum HTTP requests per second per root domain" default:"0"`
+	IPRateLimit        float64 `long:"ip-rate-limit" description:"Maximum HTTP requests per second per IP address" default:"0"`
+	DNSServerRateLimit float64 `long:"dns-rate-limit" description:"Maximum DNS queries per second per DNS server" default:"0"`
+
+	// Retries
+	Retries       int `long:"retries" description:"Maximum retries of a timed out or server-side failed HTTP request or DNS query" default:"2"`
+	RetryDelay    int `long:"retry-delay" description:"Base retry backoff in milliseconds, doubled after every failure" default:"500"`
+	RetryMaxDelay int `long:"retry-max-delay" description:"Maximum retry backoff in seconds; longer Retry-After requests are not retried" default:"30"`
+
+	// Real retry backoff durations
+	RetryDelayDuration    time.Duration
+	RetryMaxDelayDuration time.Duration
 
 	// Dedup
 	BloomFilterSize uint64  `long:"bloom-size" description:"Bloom filter size (number of expected elements)" default:"1000000"`
@@ -47,6 +120,15 @@ type Config struct {
 	// Real bloom filter size (uint)
 	RealBloomFilterSize uint
 
+	// Checkpointing
+	SessionDir         string `long:"session-dir" description:"Directory to save resumable crawl checkpoints in" default:"session"`
+	Resume             string `long:"resume" description:"Resume the crawl checkpointed in the given session directory; guesses, zone expansions and PTR sweeps still pending when it stopped are not resumed"`
+	Force              bool   `long:"force" description:"Start a new crawl even if --session-dir holds the checkpoint of another, discarding it"`
+	CheckpointInterval int    `long:"checkpoint-interval" description:"Checkpoint interval in seconds" default:"16"`
+
+	// Real checkpoint interval duration
+	CheckpointIntervalDuration time.Duration
+
 	// UI
 	NoDashboard bool `long:"no-dashboard" description:"Disable interactive TUI dashboard"`
 }
@@ -71,6 +153,18 @@ func ParseFlags() (*Config, error) {
 	// Convert timeouts
 	cfg.HTTPTimeoutDuration = time.Duration(cfg.HTTPTimeout) * time.Second
 	cfg.DNSTimeoutDuration = time.Duration(cfg.DNSTimeout) * time.Second
+	cfg.DNSQuarantineDuration = time.Duration(cfg.DNSQuarantine) * time.Second
+	cfg.DNSCacheMaxTTLDuration = time.Duration(cfg.DNSCacheMaxTTL) * time.Second
+
+	cfg.CheckpointIntervalDuration = time.Duration(cfg.CheckpointInterval) * time.Second
+
+	cfg.RetryDelayDuration = time.Duration(cfg.RetryDelay) * time.Millisecond
+	cfg.RetryMaxDelayDuration = time.Duration(cfg.RetryMaxDelay) * time.Second
+
+	// Resuming continues checkpointing into the same session
+	if cfg.Resume != "" {
+		cfg.SessionDir = cfg.Resume
+	}
 
 	// Set bloom filter size
 	cfg.RealBloomFilterSize = uint(cfg.BloomFilterSize)
@@ -96,6 +190,54 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("max depth must be >= 0, got %d", c.MaxDepth)
 	}
 
+	if c.BruteForceWorkers <= 0 {
+		return fmt.Errorf("brute force workers must be > 0, got %d", c.BruteForceWorkers)
+	}
+
+	if c.RecursiveDepth < 0 {
+		return fmt.Errorf("recursion depth must be >= 0, got %d", c.RecursiveDepth)
+	}
+
+	if c.RecursiveMinChildren <= 0 {
+		return fmt.Errorf("recursion children must be > 0, got %d", c.RecursiveMinChildren)
+	}
+
+	if c.PTRPrefix < 22 || c.PTRPrefix > 32 {
+		return fmt.Errorf("PTR sweep prefix must be between 22 and 32, got %d", c.PTRPrefix)
+	}
+
+	if c.PTRWorkers <= 0 {
+		return fmt.Errorf("PTR workers must be > 0, got %d", c.PTRWorkers)
+	}
+
+	if c.PTRBlocks <= 0 {
+		return fmt.Errorf("PTR blocks must be > 0, got %d", c.PTRBlocks)
+	}
+
+	for _, cidr := range c.PTRSkipCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid PTR skip range: %w", err)
+		}
+	}
+
+	if c.VHostMaxNames <= 0 {
+		return fmt.Errorf("vhost names per root must be > 0, got %d", c.VHostMaxNames)
+	}
+
+	if c.VHostWorkers <= 0 {
+		return fmt.Errorf("vhost workers must be > 0, got %d", c.VHostWorkers)
+	}
+
+	if c.PermuteMaxPerRoot <= 0 {
+		return fmt.Errorf("permutations per root must be > 0, got %d", c.PermuteMaxPerRoot)
+	}
+
+	for _, wordlist := range c.Wordlists {
+		if _, err := os.Stat(wordlist); err != nil {
+			return fmt.Errorf("invalid wordlist: %w", err)
+		}
+	}
+
 	if c.QueueSize <= 0 {
 		return fmt.Errorf("queue size must be > 0, got %d", c.QueueSize)
 	}
@@ -108,6 +250,55 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("DNS timeout must be > 0, got %s", c.DNSTimeoutDuration)
 	}
 
+	if c.DNSQuarantineDuration <= 0 {
+		return fmt.Errorf("DNS quarantine must be > 0, got %s", c.DNSQuarantineDuration)
+	}
+
+	if c.DNSCacheSize < 0 {
+		return fmt.Errorf("DNS cache size must be >= 0, got %d", c.DNSCacheSize)
+	}
+
+	if c.DNSCacheSize > 0 && c.DNSCacheMaxTTLDuration <= 0 {
+		return fmt.Errorf("DNS cache max TTL must be > 0, got %s", c.DNSCacheMaxTTLDuration)
+	}
+
+	if c.MaxRedirects <= 0 {
+		return fmt.Errorf("max redirects must be > 0, got %d", c.MaxRedirects)
+	}
+
+	if c.WildcardProbes <= 0 {
+		return fmt.Errorf("wildcard probes must be > 0, got %d", c.WildcardProbes)
+	}
+
+	for _, recordType := range c.RecordTypes {
+		if _, ok := dns.StringToType[strings.ToUpper(recordType)]; !ok {
+			return fmt.Errorf("unsupported DNS record type: %s", recordType)
+		}
+	}
+
+	if c.CheckpointIntervalDuration <= 0 {
+		return fmt.Errorf("checkpoint interval must be > 0, got %s", c.CheckpointIntervalDuration)
+	}
+
+	if c.Retries < 0 {
+		return fmt.Errorf("retries must be >= 0, got %d", c.Retries)
+	}
+
+	if c.RetryDelayDuration <= 0 || c.RetryMaxDelayDuration < c.RetryDelayDuration {
+		return fmt.Errorf("retry delay must be > 0 and <= retry max delay, got %s and %s", c.RetryDelayDuration, c.RetryMaxDelayDuration)
+	}
+
+	for flag, rate := range map[string]float64{
+		"rate-limit":      c.RateLimit,
+		"root-rate-limit": c.RootRateLimit,
+		"ip-rate-limit":   c.IPRateLimit,
+		"dns-rate-limit":  c.DNSServerRateLimit,
+	} {
+		if rate < 0 {
+			return fmt.Errorf("%s must be >= 0, got %f", flag, rate)
+		}
+	}
+
 	if c.MaxResponseSize <= 0 {
 		return fmt.Errorf("max response size must be > 0, got %d", c.MaxResponseSize)
 	}
@@ -169,9 +169,11 @@ func (d *Dashboard) renderGeneralStats(width, height int) string {
 		fmt.Sprintf("Queue Length:      %d", d.metrics.QueueLength),
 		fmt.Sprintf("Active Workers:    %d / %d", d.metrics.ActiveWorkers, d.metrics.TotalWorkers),
 		fmt.Sprintf("Tasks Enqueued:    %d", d.metrics.TasksEnqueued),
+		fmt.Sprintf("Spilled / Dropped: %d / %d", d.metrics.TasksSpilled, d.metrics.TasksDropped),
 		fmt.Sprintf("Tasks Processed:   %d", d.metrics.TasksProcessed),
 		fmt.Sprintf("Unique Subdomains: %d", d.metrics.UniqueSubdomains),
 		fmt.Sprintf("Errors:            %d", d.metrics.ErrorCount),
+		fmt.Sprintf("Throttled:         %s", d.metrics.ThrottledTime.Round(time.Second)),
 	}
 
 	// Calculate task rate
@@ -220,6 +222,12 @@ func (d *Dashboard) renderHTTPStats(width, height int) string {
 		)
 	}
 
+	if d.metrics.VHostProbes > 0 {
+		stats = append(stats,
+			fmt.Sprintf("Virtual Hosts:     %d found / %d probes", d.metrics.VHostsFound, d.metrics.VHostProbes),
+		)
+	}
+
 	return statStyle.Render(strings.Join(stats, "\n"))
 }
 
@@ -235,6 +243,44 @@ func (d *Dashboard) renderDNSStats(width, height int) string {
 		"🔍 DNS Statistics",
 		"",
 		fmt.Sprintf("Total Queries:     %d", d.metrics.DNSRequests),
+		fmt.Sprintf("Wildcard Matches:  %d", d.metrics.WildcardCount),
+	}
+
+	if d.metrics.BruteForced > 0 {
+		stats = append(stats,
+			fmt.Sprintf("Brute Force:       %d found / %d resolved", d.metrics.BruteForceFound, d.metrics.BruteForced),
+		)
+	}
+
+	if d.metrics.Permutations > 0 {
+		stats = append(stats,
+			fmt.Sprintf("Permutations:      %d found / %d resolved", d.metrics.PermutationsFound, d.metrics.Permutations),
+		)
+	}
+
+	if d.metrics.Recursed > 0 {
+		stats = append(stats,
+			fmt.Sprintf("Recursive:         %d found / %d resolved", d.metrics.RecursedFound, d.metrics.Recursed),
+		)
+	}
+
+	if d.metrics.PTRBlocks > 0 {
+		stats = append(stats,
+			fmt.Sprintf("PTR Sweeps:        %d names / %d blocks", d.metrics.PTRNames, d.metrics.PTRBlocks),
+		)
+	}
+
+	// Cache hit rate
+	if lookups := d.metrics.DNSCacheHits + d.metrics.DNSCacheCoalesced + d.metrics.DNSCacheMisses; lookups > 0 {
+		hitRate := float64(d.metrics.DNSCacheHits) / float64(lookups) * 100
+		stats = append(stats,
+			fmt.Sprintf("Cache Hits:        %d / %d (%.1f%%)", d.metrics.DNSCacheHits, lookups, hitRate),
+		)
+		if d.metrics.DNSCacheCoalesced > 0 {
+			stats = append(stats,
+				fmt.Sprintf("Cache Coalesced:   %d", d.metrics.DNSCacheCoalesced),
+			)
+		}
 	}
 
 	// Calculate DNS rate
@@ -247,6 +293,19 @@ func (d *Dashboard) renderDNSStats(width, height int) string {
 		)
 	}
 
+	// Per-server health
+	if len(d.metrics.DNSServers) > 0 {
+		stats = append(stats, "", "Servers:")
+		for _, server := range d.metrics.DNSServers {
+			line := fmt.Sprintf("  %-21s %5.0fms  q:%d err:%d sf:%d",
+				server.Server, server.LatencyMs, server.Queries, server.Errors, server.ServFails)
+			if server.Quarantined {
+				line += " [quarantined]"
+			}
+			stats = append(stats, line)
+		}
+	}
+
 	return statStyle.Render(strings.Join(stats, "\n"))
 }
 